@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"codeberg.org/splitringresonator/multiband/internal/config"
+	"codeberg.org/splitringresonator/multiband/internal/logging"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// cfg is the configuration the command runs with: the config file, with the
+// environment and the command's flags over it
+var cfg = config.Default()
+
+// logs is where subsystems log, as configured
+var logs = logging.Default()
+
+// configPath is the config file to read: --config, else $MULTIBAND_CONFIG,
+// else the one in the config directory
+func configPath(cmd *cobra.Command) string {
+	if path, _ := cmd.Flags().GetString("config"); path != "" {
+		return path
+	}
+	if path := os.Getenv(config.EnvPrefix + "CONFIG"); path != "" {
+		return path
+	}
+	return defaultConfigPath()
+}
+
+// defaultConfigPath is the config file in the config directory, which
+// nodes may run without
+func defaultConfigPath() string {
+	if configDir() == "" {
+		return ""
+	}
+	return filepath.Join(configDir(), config.Filename)
+}
+
+// loadConfig reads the config file at path with the environment over it,
+// and checks the result. Only the file in the config directory may be
+// missing; one asked for by name must be there.
+func loadConfig(path string) (*config.Config, error) {
+	c := config.Default()
+	if path != "" {
+		var err error
+		c, err = config.Load(path)
+		if errors.Is(err, fs.ErrNotExist) && path == defaultConfigPath() {
+			c, err = config.Default(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := c.ApplyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	return c, c.Validate()
+}
+
+// applyConfig loads the configuration for cmd, run before every command
+func applyConfig(cmd *cobra.Command, args []string) error {
+	c, err := loadConfig(configPath(cmd))
+	if err != nil {
+		// the command line is fine, the file is not
+		cmd.SilenceUsage = true
+		return err
+	}
+	if err := c.ApplyFlags(cmd.Flags()); err != nil {
+		return err
+	}
+	l, err := logging.New(c.Logging.Log())
+	if err != nil {
+		cmd.SilenceUsage = true
+		return err
+	}
+	cfg, logs = c, l
+	slog.SetDefault(logs.Logger("multiband"))
+	return nil
+}
+
+// closeLogs finishes the log file, if there is one
+func closeLogs(cmd *cobra.Command, args []string) error {
+	return logs.Close()
+}
+
+// configReloader reloads the configuration cmd runs with, its flags still
+// taking precedence
+func configReloader(cmd *cobra.Command) *config.Reloader {
+	path := configPath(cmd)
+	return config.NewReloader(cfg, func() (*config.Config, error) {
+		c, err := loadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		return c, c.ApplyFlags(cmd.Flags())
+	})
+}
+
+// watchConfig reloads the configuration when the file at path changes or
+// on SIGHUP, logging what changed and applying log levels, until ctx is done
+func watchConfig(ctx context.Context, reloader *config.Reloader, path string) {
+	logger := logs.Logger("config")
+	reloader.SetLogger(logger)
+	reloader.OnApply(ctx, func(prev, next *config.Config) error {
+		return logs.SetLevels(next.Logging.Levels)
+	})
+	go func() {
+		for r := range reloader.Subscribe(ctx) {
+			if r.Error != "" {
+				logger.Error("config rejected", "trigger", r.Trigger, "err", r.Error)
+				continue
+			}
+			logger.Info("config reloaded", "trigger", r.Trigger, "changes", len(r.Changes))
+			for _, c := range r.Changes {
+				logger.Info("config changed", "setting", c.Setting, "action", c.Action, "detail", c.Detail, "restart", c.Restart)
+			}
+		}
+	}()
+	if err := reloader.Watch(ctx, path); err != nil {
+		logger.Warn("not watching config file", "path", path, "err", err)
+	}
+}
+
+// bindConfig has a flag of cmd default to a setting in the config file
+func bindConfig(cmd *cobra.Command, flag, key string) {
+	config.BindFlag(cmd.Flags(), flag, key)
+}
+
+var configCmd = &cobra.Command{
+	Use:     "config",
+	GroupID: "tools",
+	Short:   "Check and set up the configuration file",
+	Long: `Check and set up the configuration file, multiband.yaml in the config
+directory unless --config or $MULTIBAND_CONFIG says otherwise.
+
+Every setting can be overridden by an environment variable named after it,
+eg. MULTIBAND_API_DOCS_LISTEN for api.docs.listen, and flags override both
+for the command they are given to.`,
+	// the file is read by each command here, so a broken one can be checked
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		return nil
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:     "validate [file]",
+	Short:   "Check the configuration file",
+	Example: "  multiband config validate ./node.yaml",
+	Args:    cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := configPath(cmd)
+		if len(args) > 0 {
+			path = args[0]
+		}
+		if _, err := os.Stat(path); err != nil {
+			return err
+		}
+		if _, err := loadConfig(path); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%s: ok\n", path)
+		return nil
+	},
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the configuration in effect",
+	Long: `Print the configuration in effect: the file, with the environment over
+it and defaults filled in. Secrets are masked.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := configPath(cmd)
+		c, err := loadConfig(path)
+		if err != nil {
+			return err
+		}
+		for _, l := range []*config.Listener{&c.API.Docs, &c.API.Metrics} {
+			if l.Token != "" {
+				l.Token = "********"
+			}
+			if l.BasicAuth != "" {
+				l.BasicAuth = "********"
+			}
+		}
+
+		raw, err := c.Marshal()
+		if err != nil {
+			return err
+		}
+		w := cmd.OutOrStdout()
+		switch outFormat, _ := cmd.Flags().GetString("output"); outFormat {
+		case "json":
+			var v any
+			if err := yaml.Unmarshal(raw, &v); err != nil {
+				return err
+			}
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(v)
+		case "", "yaml":
+			if c.Path() == "" {
+				fmt.Fprintf(w, "# no file at %s, defaults shown\n", path)
+			} else {
+				fmt.Fprintf(w, "# %s\n", c.Path())
+			}
+			_, err = w.Write(raw)
+			return err
+		default:
+			return fmt.Errorf("unknown output format %q, expected json or yaml", outFormat)
+		}
+	},
+}
+
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Write a configuration file to fill in",
+	Long: `Write a configuration file to fill in, with every section commented out,
+and the JSON Schema beside it for editors to complete and check it with.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := configPath(cmd)
+		if path == "" {
+			return errors.New("no config directory, give a file with --config")
+		}
+		force, _ := cmd.Flags().GetBool("force")
+		if _, err := os.Stat(path); err == nil && !force {
+			return fmt.Errorf("%s exists, --force to replace it", path)
+		} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		schema, err := config.Schema()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(config.Template), 0o600); err != nil {
+			return err
+		}
+		schemaPath := filepath.Join(filepath.Dir(path), config.SchemaFilename)
+		if err := os.WriteFile(schemaPath, append(schema, '\n'), 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s and %s\n", path, schemaPath)
+		return nil
+	},
+}
+
+var configSchemaCmd = &cobra.Command{
+	Use:     "schema",
+	Short:   "Print the JSON Schema of the configuration file",
+	Example: "  multiband config schema > ~/.config/multiband/" + config.SchemaFilename,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		schema, err := config.Schema()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(cmd.OutOrStdout(), "%s\n", schema)
+		return err
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd, configShowCmd, configInitCmd, configSchemaCmd)
+	configInitCmd.Flags().Bool("force", false, "replace the file if it exists")
+}
@@ -1,226 +1,296 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
-	stdlib_html "html"
-	"io/fs"
-	"io/ioutil"
+	"io"
 	"net/http"
-	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"sort"
 	"strings"
-	"text/template"
-	"time"
+	"syscall"
+	"text/tabwriter"
 
 	"codeberg.org/splitringresonator/multiband/docs"
 	docs_cli "codeberg.org/splitringresonator/multiband/internal/cli/docs"
+	"codeberg.org/splitringresonator/multiband/internal/docsite"
+	"codeberg.org/splitringresonator/multiband/internal/server"
+	"codeberg.org/splitringresonator/multiband/internal/version"
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/gomarkdown/markdown"
-	"github.com/gomarkdown/markdown/html"
-	"github.com/gomarkdown/markdown/parser"
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
 )
 
-type mdHandler struct {
-	fs       http.FileSystem
-	renderer *html.Renderer
-	parser   *parser.Parser
-}
+var docsServeCmd = &cobra.Command{
+	Use:     "serve",
+	GroupID: "docs",
+	Short:   "Serve embedded docs over HTTP",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := serverConfigFromFlags(cmd)
+		if err != nil {
+			return err
+		}
 
-func newMDRenderer() *html.Renderer {
-	// create HTML renderer with extensions
-	htmlFlags := html.CommonFlags | html.HrefTargetBlank
-	opts := html.RendererOptions{Flags: htmlFlags}
-	renderer := html.NewRenderer(opts)
-	return renderer
-}
+		logger := logs.Logger("docs.http")
 
-type anyDirs interface {
-	len() int
-	name(i int) string
-	isDir(i int) bool
+		handler := docsite.NewHandler(docs.Docs)
+		handler.SetPrivate(cfg.Auth())
+		if err := handler.Prerender(); err != nil {
+			return err
+		}
+		metrics, err := cmd.Flags().GetBool("metrics")
+		if err != nil {
+			return err
+		}
+
+		srv, err := server.New(cfg, docsMux(handler, metrics), logger)
+		if err != nil {
+			return err
+		}
+
+		l, err := server.Listen(cfg)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		logger.Info("serving documentation", "url", cfg.URL())
+		if err := server.Serve(ctx, srv, l, cfg.ShutdownTimeout); err != nil {
+			return err
+		}
+		logger.Info("shut down")
+		return nil
+	},
 }
 
-type fileInfoDirs []fs.FileInfo
-
-func (d fileInfoDirs) len() int          { return len(d) }
-func (d fileInfoDirs) isDir(i int) bool  { return d[i].IsDir() }
-func (d fileInfoDirs) name(i int) string { return d[i].Name() }
-
-type dirEntryDirs []fs.DirEntry
-
-func (d dirEntryDirs) len() int          { return len(d) }
-func (d dirEntryDirs) isDir(i int) bool  { return d[i].IsDir() }
-func (d dirEntryDirs) name(i int) string { return d[i].Name() }
-
-func (h *mdHandler) dirList(w http.ResponseWriter, r *http.Request, path string, f http.File) {
-	// Prefer to use ReadDir instead of Readdir,
-	// because the former doesn't require calling
-	// Stat on every entry of a directory on Unix.
-	var dirs anyDirs
-	var err error
-	if d, ok := f.(fs.ReadDirFile); ok {
-		var list dirEntryDirs
-		list, err = d.ReadDir(-1)
-		dirs = list
-	} else {
-		var list fileInfoDirs
-		list, err = f.Readdir(-1)
-		dirs = list
+// docsMux serves the docs, and the metrics at /metrics if asked to
+func docsMux(docs http.Handler, metrics bool) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/", stats.HTTP("docs", docs))
+	if metrics {
+		mux.Handle("/metrics", stats.Handler())
 	}
+	return mux
+}
 
+// serverConfigFromFlags reads the listener flags shared by commands that
+// expose an HTTP server
+func serverConfigFromFlags(cmd *cobra.Command) (server.Config, error) {
+	var cfg server.Config
+	flags := cmd.Flags()
+
+	port, err := flags.GetInt("port")
 	if err != nil {
-		http.Error(w, "Error reading directory", http.StatusInternalServerError)
-		return
+		return cfg, err
 	}
-	sort.Slice(dirs, func(i, j int) bool { return dirs.name(i) < dirs.name(j) })
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	fmt.Fprintf(w, "<!doctype html>\n")
-	fmt.Fprintf(w, "<meta name=\"viewport\" content=\"width=device-width\">\n")
-	fmt.Fprintf(w, "<pre>\n")
-	if path != "/" {
-		fmt.Fprintf(w, "<a href=\"%s\">..</a>\n", filepath.Dir(path))
+	if cfg.Listen, err = flags.GetString("listen"); err != nil {
+		return cfg, err
 	}
-	for i, n := 0, dirs.len(); i < n; i++ {
-		name := dirs.name(i)
-		displayName := name
-		if dirs.isDir(i) {
-			displayName += "/"
-		}
-		// name may contain '?' or '#', which must be escaped to remain
-		// part of the URL path, and not indicate the start of a query
-		// string or fragment.
-		url := url.URL{Path: filepath.Join(path, name)}
-		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", url.String(), stdlib_html.EscapeString(displayName))
+	if cfg.Listen == "" {
+		cfg.Listen = fmt.Sprintf("127.0.0.1:%d", port)
+	}
+	if cfg.TLSCert, err = flags.GetString("tls-cert"); err != nil {
+		return cfg, err
+	}
+	if cfg.TLSKey, err = flags.GetString("tls-key"); err != nil {
+		return cfg, err
+	}
+	if cfg.SelfSigned, err = flags.GetBool("tls-self-signed"); err != nil {
+		return cfg, err
+	}
+	if cfg.BasicAuth, err = flags.GetString("basic-auth"); err != nil {
+		return cfg, err
+	}
+	if cfg.Token, err = flags.GetString("token"); err != nil {
+		return cfg, err
+	}
+	if cfg.ShutdownTimeout, err = flags.GetDuration("shutdown-timeout"); err != nil {
+		return cfg, err
 	}
-	fmt.Fprintf(w, "</pre>\n")
+
+	return cfg, nil
 }
 
-func (h mdHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Extract the filename from the request URL path
-	filename := r.URL.Path
-	//if filename != "/" && strings.HasSuffix(filename, "/") {
-	//	filename = filename[1:] // Remove leading slash
-	//}
-
-	file, err := h.fs.Open(filename)
-	if os.IsNotExist(err) {
-		http.Error(w, "File not found", http.StatusNotFound)
-		return
-	}
-	defer file.Close()
+func addServerFlags(cmd *cobra.Command) {
+	cmd.Flags().String("listen", "", "address to listen on, host:port or unix:/path/to.sock (default 127.0.0.1:<port>)")
+	cmd.Flags().String("tls-cert", "", "PEM encoded certificate to serve TLS with")
+	cmd.Flags().String("tls-key", "", "PEM encoded private key for --tls-cert")
+	cmd.Flags().Bool("tls-self-signed", false, "serve TLS with an ephemeral self signed certificate")
+	cmd.Flags().String("basic-auth", "", "require HTTP basic auth, as user:password")
+	cmd.Flags().String("token", "", "require an Authorization: Bearer token")
+	cmd.Flags().Duration("shutdown-timeout", server.DefaultShutdownTimeout, "time allowed for in-flight requests on shutdown")
+	bindConfig(cmd, "listen", "api.docs.listen")
+	bindConfig(cmd, "tls-cert", "api.docs.tls_cert")
+	bindConfig(cmd, "tls-key", "api.docs.tls_key")
+	bindConfig(cmd, "tls-self-signed", "api.docs.tls_self_signed")
+	bindConfig(cmd, "basic-auth", "api.docs.basic_auth")
+	bindConfig(cmd, "token", "api.docs.token")
+	bindConfig(cmd, "shutdown-timeout", "api.docs.shutdown_timeout")
+}
 
-	d, err := file.Stat()
+// docsStatePath is where the docs browser keeps bookmarks and history
+func docsStatePath() (string, error) {
+	if cfg.Storage.State == "" {
+		return docs_cli.StatePath()
+	}
+	dir, err := cfg.StateDir()
 	if err != nil {
-		http.Error(w, "Stat error", http.StatusInternalServerError)
-		return
+		return "", err
 	}
+	return filepath.Join(dir, "docs.json"), nil
+}
 
-	if d.IsDir() {
-		modtime := d.ModTime()
-		if !(modtime.IsZero() || modtime.Equal(time.Unix(0, 0))) {
-			w.Header().Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+var docsExportCmd = &cobra.Command{
+	Use:     "export",
+	GroupID: "docs",
+	Short:   "Export embedded docs as a static site or ebook",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out, err := cmd.Flags().GetString("out")
+		if err != nil {
+			return err
+		}
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return err
+		}
+		baseURL, err := cmd.Flags().GetString("base-url")
+		if err != nil {
+			return err
 		}
-		h.dirList(w, r, filename, file)
-		//h.serveIndex(w, r)
-		return
-	}
 
-	raw, err := ioutil.ReadAll(file)
-	if err != nil {
-		http.Error(w, "Error", http.StatusInternalServerError)
-	}
+		title := "Multiband Documentation"
+		if version.Short != "" {
+			title += " " + version.Short
+		}
 
-	// create markdown parser with extensions
-	extensions := parser.CommonExtensions | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock
-	parser := parser.NewWithExtensions(extensions)
+		if err := docsite.Export(docs.Docs, out, docsite.ExportOptions{
+			Format:   docsite.Format(format),
+			Title:    title,
+			BaseURL:  baseURL,
+			Modified: version.BuiltAt(),
+		}); err != nil {
+			return err
+		}
 
-	doc := parser.Parse(raw)
-	w.Header().Set("Content-Type", "text/html")
-	fmt.Fprintf(w, "%s", markdown.Render(doc, h.renderer))
+		fmt.Fprintf(os.Stderr, "Documentation exported to %s\n", out)
+		return nil
+	},
 }
 
-func (h *mdHandler) serveIndex(w http.ResponseWriter, r *http.Request) {
-	// List the contents of the directory
-	path := r.URL.Path[1:] // Remove leading slash
-	dirEntries, err := h.fs.Open(path)
-	if os.IsNotExist(err) {
-		http.Error(w, "File not found", http.StatusNotFound)
-		return
-	} else if err != nil {
-		http.Error(w, "Could not list directory contents.", http.StatusInternalServerError)
-		return
-	}
-	defer dirEntries.Close()
+var docsLsCmd = &cobra.Command{
+	Use:     "ls",
+	GroupID: "docs",
+	Short:   "List embedded docs",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outFormat, _ := cmd.Flags().GetString("output")
+		return listDocs(os.Stdout, outFormat)
+	},
+}
+
+// docEntry is a row of `docs ls`
+type docEntry struct {
+	Path     string `json:"path"`
+	Title    string `json:"title"`
+	Words    int    `json:"words"`
+	Revision string `json:"revision,omitempty"`
+	Date     string `json:"date,omitempty"`
+}
 
-	// Read the directory entries
-	fileInfos, err := dirEntries.Readdir(-1)
+func listDocs(w io.Writer, outFormat string) error {
+	pages, err := docsite.Pages(docs.Docs)
 	if err != nil {
-		http.Error(w, "Could not read directory entries.", http.StatusInternalServerError)
-		return
+		return err
 	}
-
-	// Define a template to render the directory listing
-	indexTemplate := `<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <title>Index of {{ .Path }}</title>
-</head>
-<body>
-    <h1>Index of {{ .Path }}</h1>
-    <ul>
-        {{range .Files}}
-            <li><a href="{{ .Name }}">{{ .Name }}</a></li>
-        {{end}}
-    </ul>
-</body>
-</html>`
-
-	// Parse the template and execute it with the directory path and file info
-	t := template.Must(template.New("index").Parse(indexTemplate))
-	err = t.ExecuteTemplate(w, "index", map[string]interface{}{
-		"Path":  path,
-		"Files": getFileInfos(fileInfos),
-	})
+	revisions, err := docsite.ParseRevisions(docs.Revisions)
 	if err != nil {
-		http.Error(w, "Could not render template.", http.StatusInternalServerError)
+		return err
 	}
-}
 
-type fileInfoTemplate struct {
-	Name string
-}
+	entries := []docEntry{}
+	for _, p := range pages {
+		_, body := docsite.FrontMatter(p.Raw)
+		entries = append(entries, docEntry{
+			Path:     p.Path,
+			Title:    p.Title,
+			Words:    docsite.WordCount(body),
+			Revision: revisions[p.Path].Revision,
+			Date:     revisions[p.Path].Date,
+		})
+	}
 
-func getFileInfos(fileInfos []os.FileInfo) []fileInfoTemplate {
-	var files []fileInfoTemplate
-	for _, fi := range fileInfos {
-		if !fi.IsDir() {
-			files = append(files, fileInfoTemplate{Name: fi.Name()})
+	switch outFormat {
+	case "json":
+		return json.NewEncoder(w).Encode(entries)
+	case "name":
+		for _, e := range entries {
+			fmt.Fprintln(w, e.Path)
+		}
+		return nil
+	case "":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "PATH\tTITLE\tWORDS\tREVISION")
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", e.Path, e.Title, e.Words, e.Revision)
 		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q, expected json or name", outFormat)
 	}
-	return files
 }
 
-var docsServeCmd = &cobra.Command{
-	Use:     "serve",
+var docsCatCmd = &cobra.Command{
+	Use:     "cat <path>",
 	GroupID: "docs",
-	Short:   "Serve embedded docs over HTTP",
+	Short:   "Print an embedded doc",
+	Example: "  multiband docs cat architecture/api --render=plain | grep identity",
+	Args:    cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		host := "127.0.0.1"
-		port, err := cmd.Flags().GetInt("port")
+		mode, _ := cmd.Flags().GetString("render")
+		width, _ := cmd.Flags().GetInt("width")
+
+		isTerminal := term.IsTerminal(int(os.Stdout.Fd()))
+		if mode == "" {
+			mode = docs_cli.RenderPlain
+			if isTerminal {
+				mode = docs_cli.RenderANSI
+			}
+		}
+		if width <= 0 {
+			width = 80
+			if isTerminal {
+				if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+					width = w
+				}
+			}
+		}
+
+		if mode == docs_cli.RenderANSI {
+			if _, err := loadTheme(cmd); err != nil {
+				return err
+			}
+		}
+
+		pages, err := docsite.Pages(docs.Docs)
+		if err != nil {
+			return err
+		}
+		page, err := docsite.Find(pages, args[0])
 		if err != nil {
 			return err
 		}
 
-		fmt.Fprintf(os.Stderr, "Documentation served at http://%s:%d/\nctrl-c to exit\n", host, port)
-
-		http.Handle("/", mdHandler{fs: http.FS(docs.Docs), renderer: newMDRenderer()})
-		return http.ListenAndServe(fmt.Sprintf("%s:%d", host, port), nil)
+		out, err := docs_cli.Render(page, mode, width)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(out)
+		return err
 	},
 }
 
@@ -230,56 +300,46 @@ var docsCmd = &cobra.Command{
 	Short:   "View built-in documentation",
 	Args:    cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if !term.IsTerminal(int(os.Stdout.Fd())) {
+			// nothing to browse with, so print the listing for scripts instead
+			outFormat, _ := cmd.Flags().GetString("output")
+			return listDocs(os.Stdout, outFormat)
+		}
 
-		items := []string{}
-
-		if err := fs.WalkDir(docs.Docs, ".", func(path string, d fs.DirEntry, err error) error {
-			if d.IsDir() {
-				name := d.Name()
-
-				if name == "." || name == ".." {
-					return nil
-				}
-
-				return nil // keep walking
-			}
-
-			if !d.IsDir() {
-				if !strings.HasSuffix(d.Name(), ".md") {
-					return nil
-				}
+		var width, height uint
+		if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+			width = uint(w)  //nolint:gosec
+			height = uint(h) //nolint:gosec
+		}
 
-				items = append(items, path)
-			}
-			return nil
-		}); err != nil {
+		keys, err := loadTheme(cmd)
+		if err != nil {
 			return err
 		}
 
-		var width, height uint
-		isTerminal := term.IsTerminal(int(os.Stdout.Fd()))
-		if isTerminal {
-			w, h, err := term.GetSize(int(os.Stdout.Fd()))
-			if err == nil {
-				width = uint(w)  //nolint:gosec
-				height = uint(h) //nolint:gosec
+		m := docs_cli.NewModel(width, height)
+		m.SetKeyMap(keys.Docs)
+		if statePath, err := docsStatePath(); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: not saving bookmarks or history: %s\n", err)
+		} else if err := m.UseState(statePath); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: ignoring %s: %s\n", statePath, err)
+		}
+		if resume, _ := cmd.Flags().GetBool("resume"); resume {
+			if err := m.Resume(); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: cannot resume: %s\n", err)
 			}
-
-			//if width > 120 {
-			//	width = 120
-			//}
 		}
-		//if width == 0 {
-		//	width = 80
-		//}
 
-		height = 0 // TODO: debug why using reported term height makes pager layout hard to manage with header
-		p := tea.NewProgram(docs_cli.NewModel(width, height))
+		p := tea.NewProgram(m)
 
-		if _, err := p.Run(); err != nil {
+		final, err := p.Run()
+		if err != nil {
 			return err
 		}
 
+		if m, ok := final.(docs_cli.Model); ok {
+			return m.SaveState()
+		}
 		return nil
 	},
 }
@@ -291,5 +351,26 @@ func init() {
 		Title: "Documentation",
 	})
 	docsServeCmd.Flags().Int("port", 8080, "port to listen on")
+	docsServeCmd.Flags().Bool("metrics", false, "also serve Prometheus metrics at /metrics, in place of any page there")
+	addServerFlags(docsServeCmd)
 	docsCmd.AddCommand(docsServeCmd)
+
+	formats := []string{}
+	for _, f := range docsite.Formats {
+		formats = append(formats, string(f))
+	}
+	docsExportCmd.Flags().String("out", "./site", "output directory")
+	docsExportCmd.Flags().String("format", string(docsite.FormatHTML), strings.Join(formats, "|"))
+	docsExportCmd.Flags().String("base-url", "", "URL the export is published at, for sitemap.xml (none is written without it)")
+	docsCmd.AddCommand(docsExportCmd)
+
+	docsCmd.Flags().Bool("resume", false, "reopen the document read last")
+	bindConfig(docsCmd, "resume", "docs.resume")
+	docsCmd.AddCommand(docsLsCmd)
+
+	docsCatCmd.Flags().String("render", "", strings.Join(docs_cli.RenderModes, "|")+" (default ansi on a terminal, otherwise plain)")
+	docsCatCmd.Flags().Int("width", 0, "column to wrap rendered output at (default terminal width, otherwise 80)")
+	bindConfig(docsCatCmd, "render", "docs.render")
+	bindConfig(docsCatCmd, "width", "docs.width")
+	docsCmd.AddCommand(docsCatCmd)
 }
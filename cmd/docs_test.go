@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDocsMuxMetrics(t *testing.T) {
+	docs := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("docs page")) //nolint:errcheck
+	})
+	for _, tc := range []struct {
+		name    string
+		metrics bool
+		want    string
+	}{
+		{"without --metrics", false, "docs page"},
+		{"with --metrics", true, "multiband_build_info"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			docsMux(docs, tc.metrics).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+			if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), tc.want) {
+				t.Errorf("/metrics served %d %q, want %q in it", rec.Code, rec.Body.String(), tc.want)
+			}
+		})
+	}
+}
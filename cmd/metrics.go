@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"codeberg.org/splitringresonator/multiband/internal/config"
+	"codeberg.org/splitringresonator/multiband/internal/metrics"
+	"codeberg.org/splitringresonator/multiband/internal/server"
+)
+
+// stats are the node's metrics, served at /metrics
+var stats = metrics.New()
+
+// listenerConfig is how the server package exposes the listener l
+func listenerConfig(l config.Listener) server.Config {
+	return server.Config{
+		Listen:          l.Listen,
+		TLSCert:         config.Expand(l.TLSCert),
+		TLSKey:          config.Expand(l.TLSKey),
+		SelfSigned:      l.TLSSelfSigned,
+		BasicAuth:       l.BasicAuth,
+		Token:           l.Token,
+		ShutdownTimeout: time.Duration(l.ShutdownTimeout),
+	}
+}
+
+// serveMetrics serves /metrics on api.metrics until ctx is done, if it has
+// a listen address
+func serveMetrics(ctx context.Context) error {
+	c := listenerConfig(cfg.API.Metrics)
+	if c.Listen == "" {
+		return nil
+	}
+	logger := logs.Logger("metrics")
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", stats.Handler())
+	srv, err := server.New(c, mux, logger)
+	if err != nil {
+		return err
+	}
+	l, err := server.Listen(c)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("serving metrics", "url", c.URL()+"metrics")
+	go func() {
+		if err := server.Serve(ctx, srv, l, c.ShutdownTimeout); err != nil {
+			logger.Error("serving metrics", "err", err)
+		}
+	}()
+	return nil
+}
@@ -18,7 +18,15 @@ package cmd
 import (
 	"embed"
 	"os"
+	"path/filepath"
+	"strings"
 
+	docs_cli "codeberg.org/splitringresonator/multiband/internal/cli/docs"
+	"codeberg.org/splitringresonator/multiband/internal/cli/keymap"
+	"codeberg.org/splitringresonator/multiband/internal/cli/theme"
+	"codeberg.org/splitringresonator/multiband/internal/cli/tui"
+	"codeberg.org/splitringresonator/multiband/internal/config"
+	"codeberg.org/splitringresonator/multiband/internal/logging"
 	"codeberg.org/splitringresonator/multiband/internal/version"
 	"github.com/spf13/cobra"
 )
@@ -28,6 +36,9 @@ var rootCmd = &cobra.Command{
 	Short:   "Experimental communications platform",
 	Example: ``, //TODO
 	Version: version.Verbose(),
+
+	PersistentPreRunE:  applyConfig,
+	PersistentPostRunE: closeLogs,
 }
 
 func Root() *cobra.Command {
@@ -41,6 +52,30 @@ func Execute(docsFS embed.FS) {
 	}
 }
 
+// configDir is where theme and keymap files are looked for, or empty if
+// there is no user config directory
+func configDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "multiband")
+}
+
+// loadTheme applies the --theme to every TUI and returns the keymap from the
+// config directory
+func loadTheme(cmd *cobra.Command) (keymap.KeyMap, error) {
+	name, _ := cmd.Flags().GetString("theme")
+	t, err := theme.Resolve(name, configDir())
+	if err != nil {
+		return keymap.KeyMap{}, err
+	}
+	docs_cli.SetTheme(t)
+	tui.SetTheme(t)
+
+	return keymap.Load(configDir())
+}
+
 func init() {
 	rootCmd.AddGroup(&cobra.Group{
 		ID:    "docs",
@@ -51,6 +86,15 @@ func init() {
 	})
 	rootCmd.AddCommand(docsCmd)
 	rootCmd.AddCommand(tuiCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.PersistentFlags().String("config", "", "configuration file (default "+config.Filename+" in the config directory, or $"+config.EnvPrefix+"CONFIG)")
+	rootCmd.PersistentFlags().String("log-level", "", "log level of each subsystem, eg. iface.rnode=debug,queue=info, and of the rest alone, eg. warn (default info)")
+	rootCmd.PersistentFlags().String("log-format", "", "how log entries are written: "+strings.Join(logging.Formats, ", ")+" (default text)")
+	rootCmd.PersistentFlags().String("log-file", "", "file to log to instead of stderr, rotated as it grows")
+	config.BindFlag(rootCmd.PersistentFlags(), "log-level", "logging.levels")
+	config.BindFlag(rootCmd.PersistentFlags(), "log-format", "logging.format")
+	config.BindFlag(rootCmd.PersistentFlags(), "log-file", "logging.file")
 	rootCmd.PersistentFlags().StringP("output", "o", "", "Output format")
 	rootCmd.PersistentFlags().BoolP("anon", "A", false, "Generate single use identity for this session")
+	rootCmd.PersistentFlags().String("theme", "", "TUI theme: "+strings.Join(theme.Names(), ", ")+", or a theme file (default "+theme.Filename+" in the config directory)")
 }
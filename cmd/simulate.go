@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"codeberg.org/splitringresonator/multiband/internal/chat"
+	"codeberg.org/splitringresonator/multiband/internal/cli/tui"
+	"codeberg.org/splitringresonator/multiband/internal/config"
+	"codeberg.org/splitringresonator/multiband/internal/link"
+)
+
+// simNode is a node of simulated interfaces and an in-memory message
+// store, shared by every console attached to it
+type simNode struct {
+	links link.Feed
+	chat  chat.Backend
+
+	mu       sync.Mutex
+	next     int
+	consoles map[int]*simConsole
+}
+
+// simConsole is a console attached to the node
+type simConsole struct {
+	samples chan link.Sample
+	updates chan chat.Message
+	// pending are the updates not handed to the console yet, in order and
+	// only the latest of each message, and wake tells relay of more
+	pending []chat.Message
+	wake    chan struct{}
+}
+
+// simulateNode runs a simulated node until ctx is done, following reloads
+// of the interfaces and routing
+func simulateNode(ctx context.Context, reloader *config.Reloader) *simNode {
+	interfaces := simulated(reloader.Current())
+	seed := uint64(time.Now().UnixNano())
+	sim := link.NewSim(seed, interfaces...)
+	sim.SetLogger(func(name string) *slog.Logger { return logs.Logger("iface." + name) })
+	go sim.Run(ctx, time.Second)
+
+	mem := chat.NewMemory(names(interfaces)...)
+	mem.SetRoute(reloader.Current().Routing.Via)
+	mem.SetLogger(logs.Logger("queue"))
+	mem.SetTracer(traces.Tracer("queue"))
+	go mem.Simulate(ctx, time.Second, seed)
+
+	reloader.OnApply(ctx, func(prev, next *config.Config) error {
+		interfaces := simulated(next)
+		if err := sim.Configure(interfaces); err != nil {
+			return err
+		}
+		mem.SetNetworks(names(interfaces)...)
+		mem.SetRoute(next.Routing.Via)
+		return nil
+	})
+
+	n := &simNode{
+		links:    stats.Links(ctx, sim),
+		chat:     stats.Chat(ctx, mem),
+		consoles: map[int]*simConsole{},
+	}
+	go n.run(ctx)
+	return n
+}
+
+// run hands every sample and update to the consoles attached. Those not
+// keeping up miss samples while their channel is full, but are handed the
+// latest update of every message, however far behind.
+func (n *simNode) run(ctx context.Context) {
+	logger := logs.Logger("simulate")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s, ok := <-n.links.Samples():
+			if !ok {
+				return
+			}
+			n.mu.Lock()
+			for _, c := range n.consoles {
+				select {
+				case c.samples <- s:
+				default:
+					logger.Debug("console behind, sample dropped", "iface", s.Interface)
+				}
+			}
+			n.mu.Unlock()
+		case m, ok := <-n.chat.Updates():
+			if !ok {
+				return
+			}
+			n.mu.Lock()
+			for _, c := range n.consoles {
+				if i := slices.IndexFunc(c.pending, func(p chat.Message) bool { return p.ID == m.ID }); i >= 0 {
+					c.pending[i] = m
+				} else {
+					c.pending = append(c.pending, m)
+				}
+				select {
+				case c.wake <- struct{}{}:
+				default:
+				}
+			}
+			n.mu.Unlock()
+		}
+	}
+}
+
+// relay hands c its pending updates until ctx is done
+func (n *simNode) relay(ctx context.Context, c *simConsole) {
+	defer close(c.updates)
+	for {
+		n.mu.Lock()
+		if len(c.pending) == 0 {
+			n.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.wake:
+			}
+			continue
+		}
+		m := c.pending[0]
+		c.pending = c.pending[1:]
+		n.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case c.updates <- m:
+		}
+	}
+}
+
+// attach drives env from the node until ctx is done
+func (n *simNode) attach(ctx context.Context, env *tui.Env) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	id := n.next
+	n.next++
+	c := &simConsole{
+		samples: make(chan link.Sample, 64),
+		updates: make(chan chat.Message),
+		wake:    make(chan struct{}, 1),
+	}
+	n.consoles[id] = c
+	go n.relay(ctx, c)
+	context.AfterFunc(ctx, func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		delete(n.consoles, id)
+		close(c.samples)
+	})
+	env.Links = attachedFeed{Feed: n.links, samples: c.samples}
+	env.Chat = attachedChat{Backend: n.chat, updates: c.updates}
+}
+
+// attachedFeed is the node's feed as one console follows it
+type attachedFeed struct {
+	link.Feed
+	samples chan link.Sample
+}
+
+func (f attachedFeed) Samples() <-chan link.Sample { return f.samples }
+
+// attachedChat is the node's message store as one console follows it
+type attachedChat struct {
+	chat.Backend
+	updates chan chat.Message
+}
+
+func (c attachedChat) Updates() <-chan chat.Message { return c.updates }
+
+// simulated is the interfaces configured, or the demo node without any
+func simulated(c *config.Config) []link.Interface {
+	if len(c.Interfaces) == 0 {
+		return link.Demo
+	}
+	return c.Links()
+}
+
+func names(interfaces []link.Interface) []string {
+	names := []string{}
+	for _, i := range interfaces {
+		names = append(names, i.Name)
+	}
+	return names
+}
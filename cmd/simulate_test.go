@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"codeberg.org/splitringresonator/multiband/internal/chat"
+	"codeberg.org/splitringresonator/multiband/internal/cli/tui"
+	"codeberg.org/splitringresonator/multiband/internal/link"
+)
+
+// fakeChat hands out the updates sent on its channel
+type fakeChat struct {
+	chat.Backend
+	updates chan chat.Message
+}
+
+func (c fakeChat) Updates() <-chan chat.Message { return c.updates }
+
+// fakeLinks hands out no samples
+type fakeLinks struct{ link.Feed }
+
+func (fakeLinks) Samples() <-chan link.Sample { return nil }
+
+func TestSimNodeKeepsStatus(t *testing.T) {
+	const n = 200
+	updates := make(chan chat.Message)
+	node := &simNode{links: fakeLinks{}, chat: fakeChat{updates: updates}, consoles: map[int]*simConsole{}}
+	go node.run(t.Context())
+	env := &tui.Env{}
+	node.attach(t.Context(), env)
+
+	// the console reads nothing while every message is queued, sent and acked
+	for _, s := range []chat.Status{chat.Queued, chat.Sent, chat.Acked} {
+		for i := range n {
+			updates <- chat.Message{ID: strconv.Itoa(i), Status: s}
+		}
+	}
+
+	last := map[string]chat.Status{}
+	for len(last) < n || withStatus(last, chat.Acked) < n {
+		select {
+		case m := <-env.Chat.Updates():
+			last[m.ID] = m.Status
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d of %d messages acked for the console", withStatus(last, chat.Acked), n)
+		}
+	}
+}
+
+// withStatus counts the messages last seen with status s
+func withStatus(last map[string]chat.Status, s chat.Status) int {
+	count := 0
+	for _, got := range last {
+		if got == s {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"codeberg.org/splitringresonator/multiband/internal/tracing"
+)
+
+// traceFlushTimeout bounds how long exiting waits on spans not exported yet
+const traceFlushTimeout = 5 * time.Second
+
+// traces are where messages are traced, off unless startTracing set them up
+var traces = tracing.Off()
+
+// startTracing exports traces as configured. The function returned flushes
+// the spans left, logging what could not be sent.
+func startTracing() (func(), error) {
+	t, err := tracing.New(cfg.Tracing.Trace())
+	if err != nil {
+		return nil, err
+	}
+	traces = t
+	if cfg.Tracing.Exporter != "" {
+		logs.Logger("tracing").Info("exporting traces", "exporter", cfg.Tracing.Exporter)
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), traceFlushTimeout)
+		defer cancel()
+		if err := t.Close(ctx); err != nil {
+			logs.Logger("tracing").Warn("flushing traces", "err", err)
+		}
+	}, nil
+}
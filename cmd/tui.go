@@ -1,38 +1,327 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"net"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 
+	"codeberg.org/splitringresonator/multiband/internal/alert"
+	"codeberg.org/splitringresonator/multiband/internal/chat"
+	"codeberg.org/splitringresonator/multiband/internal/cli/headless"
+	"codeberg.org/splitringresonator/multiband/internal/cli/remote"
 	"codeberg.org/splitringresonator/multiband/internal/cli/tui"
+	"codeberg.org/splitringresonator/multiband/internal/config"
+	"codeberg.org/splitringresonator/multiband/internal/tracing"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 	"github.com/mattn/go-isatty"
+	"github.com/muesli/termenv"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
 )
 
 var tuiCmd = &cobra.Command{
 	Use:     "tui",
 	GroupID: "tools",
 	Short:   "Surf the waves in style",
+	Long: `Surf the waves in style.
+
+Alerts are raised by the rules under alerts in the config file, eg.
+
+  alerts:
+    - name: HQ
+      when: message from @hq
+    - when: keyword SOS
+      hook: notify-send "$MULTIBAND_ALERT_TEXT"
+    - when: interface down >5m
+    - when: battery <20%
+      silent: true
+
+Each alert is shown over the console for a few seconds, rings the terminal
+bell unless its rule is silent, and is listed on the Alerts screen. Press r
+there to read the rules again. Rules that do not parse leave the console
+without alerts, as its status bar says.
+
+The config file is read again when it is saved or the process gets SIGHUP.
+Changes to interfaces, routing and alert rules are applied as the console
+runs, leaving untouched interfaces running; other sections take a restart.
+A file that does not validate is rejected as a whole. Each reload is logged
+and shown in the status bar.
+
+With --metrics, or api.metrics in the config file, Prometheus metrics of
+the interfaces and the message queue are served at /metrics.
+
+With --trace, or tracing in the config file, every message sent is traced
+from the queue through scheduling and each transmit attempt to the peer's
+ack, and exported over OTLP to a collector or as JSON lines (stdout, to
+stderr unless tracing.file says otherwise). Messages carry their trace as
+a compact ID, so nodes passing them on add to the same trace, and received
+messages are traced as part of it.
+
+The console has the terminal, so the log is only written out when it goes
+to a file (--log-file). The Logs screen shows the latest entries either way.
+
+When stdout is not a terminal, the console is driven over a line protocol
+instead: one command per line on stdin, answered on stdout with tab
+separated rows and "ok", or "error: ...". Events such as incoming messages
+are written as JSON lines as they happen. Send "help" for the commands.`,
+	Example: "  printf 'send @bob hello\\nquit\\n' | multiband tui --simulate",
 	Args:    cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		var opts []tea.ProgramOption
+		identity := "no identity loaded"
+		if id, ok := cfg.DefaultIdentity(); ok {
+			identity = id.Name
+		}
+		if anon, _ := cmd.Flags().GetBool("anon"); anon {
+			identity = "anonymous (single use)"
+		}
+
+		ctx, cancel := context.WithCancel(cmd.Context())
+		defer cancel()
+
+		reloader := configReloader(cmd)
+		go watchConfig(ctx, reloader, configPath(cmd))
+		if err := serveMetrics(ctx); err != nil {
+			return err
+		}
+		flush, err := startTracing()
+		if err != nil {
+			return err
+		}
+		defer flush()
+
+		env := tui.Env{Identity: identity, Terminal: os.Stdout, DocsState: docsState(), Logs: logs.Ring()}
+		if simulate, _ := cmd.Flags().GetBool("simulate"); simulate {
+			simulateNode(ctx, reloader).attach(ctx, &env)
+		}
+		env.Reload = func() config.Report { return reloader.Reload("console") }
+		env.Reloads = reloader.Subscribe(ctx)
+		env.Reports = reloader.Reports
 
 		if !isatty.IsTerminal(os.Stdout.Fd()) {
-			opts = []tea.ProgramOption{tea.WithoutRenderer()}
-		} else {
-			log.SetOutput(io.Discard)
+			if env.Chat == nil {
+				env.Chat = chat.NewMemory()
+			}
+			return headless.Run(ctx, cmd.InOrStdin(), cmd.OutOrStdout(), headless.Config{
+				Identity: env.Identity,
+				Chat:     env.Chat,
+				Links:    env.Links,
+				Reload:   env.Reload,
+				Reloads:  env.Reloads,
+				Reports:  env.Reports,
+			})
+		}
+		// the console has the terminal, and shows the log itself
+		if !logs.ToFile() {
+			logs.SetOutput(io.Discard)
 		}
 
-		p := tea.NewProgram(tui.NewModel(), opts...)
-		if _, err := p.Run(); err != nil {
+		keys, err := loadTheme(cmd)
+		if err != nil {
 			return err
 		}
+		env.Keys = keys
+		openAlerts(ctx, &env, alertRules(configPath(cmd)), reloader, logs.Logger("tui"))
 
+		p := tea.NewProgram(tui.NewModel(env), tea.WithAltScreen())
+		final, err := p.Run()
+		if err != nil {
+			return err
+		}
+
+		if err := final.(tui.Model).Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: not saving docs state: %s\n", err)
+		}
 		return nil
 	},
 }
 
+var tuiServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Host the console over SSH",
+	Long: `Host the console over SSH, for operators to attach to the node from
+anywhere with an SSH client and nothing else installed.
+
+Logins are checked against an authorized_keys file, read afresh every time,
+and each key is mapped to the identity its operator uses: the value of an
+identity="name" option on the key's line, which must name one of the node's
+identities, else the key's comment. Every identity keeps its own docs
+bookmarks and history. Sessions with a PTY get the console, sized to it,
+and sessions without one, like ssh -T, get the line protocol described in
+"multiband tui --help". With --simulate, every session attaches to the one
+simulated node.`,
+	Example: `  multiband tui serve --ssh :2222
+  ssh -p 2222 pi.local`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		addr, err := cmd.Flags().GetString("ssh")
+		if err != nil {
+			return err
+		}
+		hostKeyPath, err := cmd.Flags().GetString("host-key")
+		if err != nil {
+			return err
+		}
+		authorizedKeys, err := cmd.Flags().GetString("authorized-keys")
+		if err != nil {
+			return err
+		}
+		hostKeyPath, authorizedKeys = config.Expand(hostKeyPath), config.Expand(authorizedKeys)
+		if hostKeyPath == "" {
+			hostKeyPath = filepath.Join(configDir(), "ssh_host_ed25519_key")
+		}
+		if authorizedKeys == "" {
+			authorizedKeys = filepath.Join(configDir(), "authorized_keys")
+		}
+		simulate, _ := cmd.Flags().GetBool("simulate")
+
+		keys, err := loadTheme(cmd)
+		if err != nil {
+			return err
+		}
+		// sessions are drawn for the client's terminal, not whatever the
+		// server is running in
+		lipgloss.SetColorProfile(termenv.ANSI256)
+		lipgloss.SetHasDarkBackground(true)
+
+		hostKey, err := remote.LoadHostKey(hostKeyPath)
+		if err != nil {
+			return err
+		}
+		identities := []string{}
+		for _, id := range cfg.Identities {
+			identities = append(identities, id.Name)
+		}
+		authorized, err := remote.LoadAuthorizedKeys(authorizedKeys)
+		if err != nil {
+			return err
+		}
+		if err := remote.CheckIdentities(authorized, identities); err != nil {
+			return fmt.Errorf("%s: %w", authorizedKeys, err)
+		}
+		rules := alertRules(configPath(cmd))
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		logger := logs.Logger("tui.ssh")
+		reloader := configReloader(cmd)
+		go watchConfig(ctx, reloader, configPath(cmd))
+		if err := serveMetrics(ctx); err != nil {
+			return err
+		}
+		flush, err := startTracing()
+		if err != nil {
+			return err
+		}
+		defer flush()
+
+		// sessions attach to the one node, as they would to a real one
+		var node *simNode
+		if simulate {
+			node = simulateNode(ctx, reloader)
+		}
+
+		srv := remote.NewServer(remote.Config{
+			HostKey:        hostKey,
+			AuthorizedKeys: authorizedKeys,
+			Identities:     identities,
+			Logger:         logger,
+			Env: func(ctx context.Context, identity string) tui.Env {
+				env := tui.Env{Identity: identity, Keys: keys, DocsState: sessionDocsState(identity), Logs: logs.Ring()}
+				if node != nil {
+					node.attach(ctx, &env)
+				}
+				env.Reload = func() config.Report { return reloader.Reload(identity + " over SSH") }
+				env.Reloads = reloader.Subscribe(ctx)
+				env.Reports = reloader.Reports
+				openAlerts(ctx, &env, rules, reloader, logger.With("identity", identity))
+				return env
+			},
+		})
+
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("serving console over SSH", "addr", l.Addr(), "host_key", ssh.FingerprintSHA256(hostKey.PublicKey()))
+		if err := srv.Serve(ctx, l); err != nil {
+			return err
+		}
+		logger.Info("shut down")
+		return nil
+	},
+}
+
+// alertRules reads the alert rules from the config file at path, so they
+// can be read again while the console runs
+func alertRules(path string) alert.Source {
+	return func() ([]alert.Rule, error) {
+		c, err := loadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		return c.Alerts, nil
+	}
+}
+
+// docsState is where the console keeps the docs browser's state, or empty
+// for the default
+func docsState() string {
+	path, err := docsStatePath()
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// sessionDocsState is where the docs browser of identity's SSH sessions
+// keeps its state, apart from other operators' bookmarks and history
+func sessionDocsState(identity string) string {
+	path := docsState()
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + url.PathEscape(identity) + ext
+}
+
+// openAlerts gives the console the alert rules, which reloads replace.
+// Rules that cannot be read leave it without alerts, saying so in its
+// status bar rather than keeping the console from starting.
+func openAlerts(ctx context.Context, env *tui.Env, rules alert.Source, reloader *config.Reloader, logger *slog.Logger) {
+	alerts, err := alert.Open(rules)
+	if err != nil {
+		logger.Warn("no alerts", "err", err)
+		env.Status = "no alerts: " + err.Error()
+		return
+	}
+	env.Alerts = alerts
+	reloader.OnApply(ctx, func(prev, next *config.Config) error {
+		return alerts.SetRules(next.Alerts...)
+	})
+}
+
 func init() {
+	tuiCmd.AddCommand(tuiServeCmd)
+	tuiCmd.PersistentFlags().Bool("simulate", false, "drive the console from simulated interfaces and an in-memory message store")
+	tuiCmd.PersistentFlags().String("metrics", "", "address to serve Prometheus metrics on at /metrics, off if empty")
+	config.BindFlag(tuiCmd.PersistentFlags(), "metrics", "api.metrics.listen")
+	tuiCmd.PersistentFlags().String("trace", "", "export traces of messages: "+strings.Join(tracing.Exporters, " or ")+", off if empty")
+	config.BindFlag(tuiCmd.PersistentFlags(), "trace", "tracing.exporter")
+	tuiServeCmd.Flags().String("ssh", ":2222", "address to serve SSH on")
+	tuiServeCmd.Flags().String("host-key", "", "private host key, generated if missing (default ssh_host_ed25519_key in the config directory)")
+	tuiServeCmd.Flags().String("authorized-keys", "", "public keys allowed to log in, and their identities (default authorized_keys in the config directory)")
+	bindConfig(tuiServeCmd, "ssh", "api.ssh.listen")
+	bindConfig(tuiServeCmd, "host-key", "api.ssh.host_key")
+	bindConfig(tuiServeCmd, "authorized-keys", "api.ssh.authorized_keys")
 }
@@ -6,3 +6,9 @@ import (
 
 //go:embed */*
 var Docs embed.FS
+
+// Revisions is the manifest of the last commit to touch each document,
+// regenerated by `make docs`
+//
+//go:embed revisions.json
+var Revisions []byte
@@ -0,0 +1,402 @@
+// Package alert raises alerts when messages arrive or links misbehave, by
+// rules such as "message from @hq" or "interface down >5m"
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"codeberg.org/splitringresonator/multiband/internal/chat"
+	"codeberg.org/splitringresonator/multiband/internal/link"
+)
+
+// MaxHistory is how many alerts are remembered
+const MaxHistory = 200
+
+// HookTimeout bounds how long a hook may run for
+const HookTimeout = 30 * time.Second
+
+var ErrBadRule = errors.New("bad rule")
+
+// Rule raises an alert when its condition is met. When is one of:
+//
+//	message [from @peer]
+//	keyword <word or phrase> [from @peer]
+//	interface [name] down [>duration]
+//	battery [interface] <percent%
+//
+// Keywords match whole words in any script, ignoring case. Interface and battery rules
+// fire once when their condition is met, and again only after it clears.
+// The doc tags describe the fields in the config file schema.
+type Rule struct {
+	Name   string `yaml:"name,omitempty" doc:"shown with the alert, the condition itself if empty"`
+	When   string `yaml:"when" doc:"message [from @peer], keyword <text> [from @peer], interface [name] down [>duration] or battery [interface] <percent%"`
+	Hook   string `yaml:"hook,omitempty" doc:"shell command run on the alert, given MULTIBAND_ALERT_RULE, MULTIBAND_ALERT_TEXT and MULTIBAND_ALERT_TIME"`
+	Silent bool   `yaml:"silent,omitempty" doc:"do not ring the terminal bell"`
+}
+
+func (r Rule) title() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.When
+}
+
+// Check reports what is wrong with a rule, if anything
+func Check(r Rule) error {
+	_, err := compile(r)
+	return err
+}
+
+// Source reads the rules afresh, eg. from the config file
+type Source func() ([]Rule, error)
+
+type Alert struct {
+	Time time.Time
+	// Rule is the name of the rule raising the alert
+	Rule string
+	Text string
+	Hook string
+	Bell bool
+}
+
+type kind uint8
+
+const (
+	onMessage kind = iota
+	onKeyword
+	onDown
+	onBattery
+)
+
+// condition is a rule parsed
+type condition struct {
+	Rule
+	kind      kind
+	peer      string
+	keyword   string
+	iface     string
+	after     time.Duration
+	threshold float64
+}
+
+func compile(r Rule) (condition, error) {
+	c := condition{Rule: r}
+	words := strings.Fields(r.When)
+	if len(words) == 0 {
+		return c, fmt.Errorf("%w: no condition", ErrBadRule)
+	}
+
+	// message and keyword rules may end with the peer they apply to
+	from := func(words []string) ([]string, error) {
+		n := len(words)
+		if n >= 2 && words[n-2] == "from" {
+			c.peer = strings.TrimPrefix(words[n-1], "@")
+			return words[:n-2], nil
+		}
+		for _, w := range words {
+			if w == "from" {
+				return nil, fmt.Errorf("%w %q: expected from @peer last", ErrBadRule, r.When)
+			}
+		}
+		return words, nil
+	}
+
+	var err error
+	switch words[0] {
+	case "message":
+		c.kind = onMessage
+		if words, err = from(words[1:]); err != nil {
+			return c, err
+		}
+		if len(words) > 0 {
+			return c, fmt.Errorf("%w %q: expected message [from @peer]", ErrBadRule, r.When)
+		}
+
+	case "keyword":
+		c.kind = onKeyword
+		if words, err = from(words[1:]); err != nil {
+			return c, err
+		}
+		if len(words) == 0 {
+			return c, fmt.Errorf("%w %q: expected keyword <word> [from @peer]", ErrBadRule, r.When)
+		}
+		c.keyword = strings.Join(words, " ")
+
+	case "interface":
+		c.kind = onDown
+		words = words[1:]
+		if len(words) > 0 && words[0] != "down" {
+			c.iface, words = words[0], words[1:]
+		}
+		if len(words) == 0 || words[0] != "down" || len(words) > 2 {
+			return c, fmt.Errorf("%w %q: expected interface [name] down [>duration]", ErrBadRule, r.When)
+		}
+		if len(words) == 2 {
+			d, ok := strings.CutPrefix(words[1], ">")
+			if c.after, err = time.ParseDuration(d); !ok || err != nil || c.after < 0 {
+				return c, fmt.Errorf("%w %q: expected a duration like >5m", ErrBadRule, r.When)
+			}
+		}
+
+	case "battery":
+		c.kind = onBattery
+		words = words[1:]
+		if len(words) == 2 {
+			c.iface, words = words[0], words[1:]
+		}
+		if len(words) != 1 {
+			return c, fmt.Errorf("%w %q: expected battery [interface] <percent%%", ErrBadRule, r.When)
+		}
+		p, ok := strings.CutPrefix(words[0], "<")
+		if c.threshold, err = strconv.ParseFloat(strings.TrimSuffix(p, "%"), 64); !ok || err != nil {
+			return c, fmt.Errorf("%w %q: expected a percentage like <20%%", ErrBadRule, r.When)
+		}
+
+	default:
+		return c, fmt.Errorf("%w %q: expected message, keyword, interface or battery", ErrBadRule, r.When)
+	}
+	return c, nil
+}
+
+// Engine checks messages and samples against the rules, and remembers the
+// alerts raised
+type Engine struct {
+	source Source
+
+	mu      sync.Mutex
+	rules   []condition
+	history []Alert
+	// since is when each interface was first seen down
+	since map[string]time.Time
+	// fired is the interface and battery conditions already alerted on,
+	// until they clear
+	fired map[string]bool
+}
+
+// NewEngine checks for the given rules
+func NewEngine(rules ...Rule) (*Engine, error) {
+	e := &Engine{since: map[string]time.Time{}, fired: map[string]bool{}}
+	return e, e.SetRules(rules...)
+}
+
+// Open checks for the rules from source, which Reload reads again
+func Open(source Source) (*Engine, error) {
+	rules, err := source()
+	if err != nil {
+		return nil, err
+	}
+	e, err := NewEngine(rules...)
+	if err != nil {
+		return nil, err
+	}
+	e.source = source
+	return e, nil
+}
+
+// Reload reads the rules from the source again, keeping the rules in use if
+// they are broken, and returns how many rules there are now
+func (e *Engine) Reload() (int, error) {
+	if e.source == nil {
+		return len(e.Rules()), nil
+	}
+	rules, err := e.source()
+	if err != nil {
+		return len(e.Rules()), err
+	}
+	if err := e.SetRules(rules...); err != nil {
+		return len(e.Rules()), err
+	}
+	return len(rules), nil
+}
+
+// SetRules replaces the rules, or leaves them be if any is bad
+func (e *Engine) SetRules(rules ...Rule) error {
+	conds := []condition{}
+	for _, r := range rules {
+		c, err := compile(r)
+		if err != nil {
+			return err
+		}
+		conds = append(conds, c)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = conds
+	return nil
+}
+
+func (e *Engine) Rules() []Rule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rules := []Rule{}
+	for _, c := range e.rules {
+		rules = append(rules, c.Rule)
+	}
+	return rules
+}
+
+// History is the alerts raised, most recent last
+func (e *Engine) History() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Alert{}, e.history...)
+}
+
+func (e *Engine) Clear() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.history = nil
+}
+
+// raise records an alert, with e.mu held
+func (e *Engine) raise(c condition, at time.Time, text string) Alert {
+	a := Alert{Time: at, Rule: c.title(), Text: text, Hook: c.Hook, Bell: !c.Silent}
+	e.history = append(e.history, a)
+	if len(e.history) > MaxHistory {
+		e.history = e.history[len(e.history)-MaxHistory:]
+	}
+	return a
+}
+
+// Message checks a message from the backend, raising alerts for those
+// arriving. name is how the peer announced itself, if it has.
+func (e *Engine) Message(m chat.Message, name string) []Alert {
+	if m.Outgoing {
+		return nil
+	}
+	from := m.Peer
+	if name != "" {
+		from = name
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	alerts := []Alert{}
+	for _, c := range e.rules {
+		if c.kind != onMessage && c.kind != onKeyword {
+			continue
+		}
+		if c.peer != "" && !strings.EqualFold(c.peer, m.Peer) && !strings.EqualFold(c.peer, name) {
+			continue
+		}
+		if c.kind == onKeyword && !containsWord(m.Body, c.keyword) {
+			continue
+		}
+		alerts = append(alerts, e.raise(c, m.Time, from+": "+m.Body))
+	}
+	return alerts
+}
+
+// containsWord reports whether s contains keyword, ignoring case, not run
+// into letters or digits around it. Keywords starting or ending in
+// punctuation, like SOS!, need no boundary on that side.
+func containsWord(s, keyword string) bool {
+	text, kw := []rune(s), []rune(keyword)
+	if len(kw) == 0 {
+		return false
+	}
+	first, last := isWord(kw[0]), isWord(kw[len(kw)-1])
+	for i := 0; i+len(kw) <= len(text); i++ {
+		end := i + len(kw)
+		if !strings.EqualFold(string(text[i:end]), keyword) {
+			continue
+		}
+		if first && i > 0 && isWord(text[i-1]) {
+			continue
+		}
+		if last && end < len(text) && isWord(text[end]) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// isWord reports whether r is part of a word, in any script
+func isWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '_'
+}
+
+// Sample checks a sample from the link feed. Feeds report every interface
+// regularly, down or not, so down rules fire on time.
+func (e *Engine) Sample(s link.Sample) []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if s.State == link.Down {
+		if _, ok := e.since[s.Interface]; !ok {
+			e.since[s.Interface] = s.Time
+		}
+	} else {
+		delete(e.since, s.Interface)
+	}
+
+	alerts := []Alert{}
+	for _, c := range e.rules {
+		if c.iface != "" && c.iface != s.Interface {
+			continue
+		}
+		key := c.When + "\x00" + s.Interface
+		switch c.kind {
+		case onDown:
+			since, down := e.since[s.Interface]
+			if !down {
+				delete(e.fired, key)
+				continue
+			}
+			if e.fired[key] || s.Time.Sub(since) < c.after {
+				continue
+			}
+			e.fired[key] = true
+			text := s.Interface + " down"
+			if c.after > 0 {
+				text += " for " + s.Time.Sub(since).Round(time.Second).String()
+			}
+			alerts = append(alerts, e.raise(c, s.Time, text))
+
+		case onBattery:
+			if s.Battery < 0 || s.Battery >= c.threshold {
+				delete(e.fired, key)
+				continue
+			}
+			if e.fired[key] {
+				continue
+			}
+			e.fired[key] = true
+			alerts = append(alerts, e.raise(c, s.Time, fmt.Sprintf("%s battery at %.0f%%", s.Interface, s.Battery)))
+		}
+	}
+	return alerts
+}
+
+// RunHook runs the hook of an alert, if it has one
+func RunHook(ctx context.Context, a Alert) error {
+	if a.Hook == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, HookTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", a.Hook)
+	cmd.Env = append(os.Environ(),
+		"MULTIBAND_ALERT_RULE="+a.Rule,
+		"MULTIBAND_ALERT_TEXT="+a.Text,
+		"MULTIBAND_ALERT_TIME="+a.Time.Format(time.RFC3339),
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("hook of %s: %w: %s", a.Rule, err, msg)
+		}
+		return fmt.Errorf("hook of %s: %w", a.Rule, err)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package alert
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"codeberg.org/splitringresonator/multiband/internal/chat"
+	"codeberg.org/splitringresonator/multiband/internal/link"
+)
+
+var t0 = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func engine(t *testing.T, rules ...Rule) *Engine {
+	t.Helper()
+	e, err := NewEngine(rules...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func texts(alerts []Alert) []string {
+	out := []string{}
+	for _, a := range alerts {
+		out = append(out, a.Rule+": "+a.Text)
+	}
+	return out
+}
+
+func TestCheck(t *testing.T) {
+	for _, when := range []string{
+		"message",
+		"message from @hq",
+		"keyword sos",
+		"keyword need help from hq",
+		"interface down",
+		"interface lora0 down",
+		"interface down >5m",
+		"interface lora0 down >90s",
+		"battery <20%",
+		"battery lora0 <15",
+	} {
+		if err := Check(Rule{When: when}); err != nil {
+			t.Errorf("Check(%q): %v", when, err)
+		}
+	}
+
+	for _, when := range []string{
+		"",
+		"sometimes",
+		"message hq",
+		"message from",
+		"keyword",
+		"keyword from @hq",
+		"keyword from @hq help",
+		"interface",
+		"interface lora0",
+		"interface down 5m",
+		"interface down >soon",
+		"interface down >-5m",
+		"interface lora0 down >5m extra",
+		"battery",
+		"battery 20%",
+		"battery <low",
+		"battery lora0 tnc0 <20%",
+	} {
+		if err := Check(Rule{When: when}); !errors.Is(err, ErrBadRule) {
+			t.Errorf("Check(%q) = %v, want ErrBadRule", when, err)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	e := engine(t,
+		Rule{When: "message"},
+		Rule{Name: "from hq", When: "message from @hq"},
+	)
+
+	got := texts(e.Message(chat.Message{Peer: "a1b2", Body: "hello", Time: t0}, ""))
+	if want := []string{"message: a1b2: hello"}; !slices.Equal(got, want) {
+		t.Errorf("message from a1b2 = %q, want %q", got, want)
+	}
+
+	// the rule may name the peer by address or by announced name
+	for _, m := range []struct{ peer, name, from string }{
+		{"HQ", "", "HQ"},
+		{"c3d4", "hq", "hq"},
+	} {
+		got := texts(e.Message(chat.Message{Peer: m.peer, Body: "status?", Time: t0}, m.name))
+		want := []string{"message: " + m.from + ": status?", "from hq: " + m.from + ": status?"}
+		if !slices.Equal(got, want) {
+			t.Errorf("message from %s (%q) = %q, want %q", m.peer, m.name, got, want)
+		}
+	}
+
+	if got := e.Message(chat.Message{Peer: "hq", Outgoing: true, Body: "sent", Time: t0}, ""); len(got) != 0 {
+		t.Errorf("outgoing message raised %q", texts(got))
+	}
+}
+
+func TestKeyword(t *testing.T) {
+	for _, tc := range []struct {
+		when, body string
+		want       bool
+	}{
+		{"keyword sos", "SOS", true},
+		{"keyword sos", "sos, please", true},
+		{"keyword sos", "(sos)", true},
+		{"keyword sos", "sosa", false},
+		{"keyword sos", "asos", false},
+		{"keyword sos", "sos_", false},
+		{"keyword sos", "sos2", false},
+		{"keyword SOS!", "SOS!", true},
+		{"keyword SOS!", "send sos! now", true},
+		{"keyword SOS!", "SOS!!", true},
+		{"keyword SOS!", "SOS", false},
+		{"keyword SOS!", "xSOS!", false},
+		{"keyword need help", "We NEED HELP here", true},
+		{"keyword need help", "need helpers", false},
+		{"keyword помощь", "Нужна ПОМОЩЬ!", true},
+		{"keyword помощь", "помощь", true},
+		{"keyword помощь", "помощью", false},
+		{"keyword помощь", "взаимопомощь", false},
+		{"keyword café", "CAFÉ at noon", true},
+		{"keyword café", "cafés", false},
+		// a combining accent is part of the word before it
+		{"keyword cafe", "café", false},
+		{"keyword 救命", "请 救命", true},
+		{"keyword 救命", "救命啊", false},
+		{"keyword 5", "at 5pm", false},
+		{"keyword 5", "at 5 pm", true},
+	} {
+		e := engine(t, Rule{When: tc.when})
+		got := len(e.Message(chat.Message{Peer: "a1b2", Body: tc.body, Time: t0}, "")) > 0
+		if got != tc.want {
+			t.Errorf("%q on %q = %v, want %v", tc.when, tc.body, got, tc.want)
+		}
+	}
+}
+
+func TestKeywordFrom(t *testing.T) {
+	e := engine(t, Rule{When: "keyword help from @hq"})
+	if got := e.Message(chat.Message{Peer: "a1b2", Body: "help", Time: t0}, ""); len(got) != 0 {
+		t.Errorf("help from a1b2 raised %q", texts(got))
+	}
+	if got := e.Message(chat.Message{Peer: "hq", Body: "help", Time: t0}, ""); len(got) != 1 {
+		t.Errorf("help from hq raised %q", texts(got))
+	}
+}
+
+func sample(iface string, at time.Duration, state link.State, battery float64) link.Sample {
+	return link.Sample{Interface: iface, Time: t0.Add(at), State: state, Battery: battery}
+}
+
+func TestDown(t *testing.T) {
+	e := engine(t,
+		Rule{When: "interface down"},
+		Rule{When: "interface lora0 down >5m"},
+	)
+	steps := []struct {
+		s    link.Sample
+		want []string
+	}{
+		{sample("lora0", 0, link.Up, -1), []string{}},
+		{sample("lora0", time.Minute, link.Down, -1), []string{"interface down: lora0 down"}},
+		// once only, until the interface comes back
+		{sample("lora0", 2*time.Minute, link.Down, -1), []string{}},
+		{sample("tcp0", 2*time.Minute, link.Down, -1), []string{"interface down: tcp0 down"}},
+		{sample("lora0", 6*time.Minute, link.Down, -1), []string{"interface lora0 down >5m: lora0 down for 5m0s"}},
+		{sample("lora0", 7*time.Minute, link.Down, -1), []string{}},
+		{sample("lora0", 8*time.Minute, link.Up, -1), []string{}},
+		{sample("lora0", 9*time.Minute, link.Down, -1), []string{"interface down: lora0 down"}},
+		// timed from going down again, not from the first time
+		{sample("lora0", 13*time.Minute, link.Down, -1), []string{}},
+		{sample("lora0", 14*time.Minute, link.Down, -1), []string{"interface lora0 down >5m: lora0 down for 5m0s"}},
+	}
+	for i, step := range steps {
+		if got := texts(e.Sample(step.s)); !slices.Equal(got, step.want) {
+			t.Errorf("step %d, %s %s at %s: got %q, want %q", i, step.s.Interface, step.s.State, step.s.Time.Sub(t0), got, step.want)
+		}
+	}
+}
+
+func TestBattery(t *testing.T) {
+	e := engine(t,
+		Rule{Name: "low", When: "battery <20%"},
+		Rule{When: "battery lora1 <50"},
+	)
+	steps := []struct {
+		s    link.Sample
+		want []string
+	}{
+		// no battery
+		{sample("tcp0", 0, link.Up, -1), []string{}},
+		{sample("lora0", 0, link.Up, 40), []string{}},
+		{sample("lora0", time.Minute, link.Up, 19.6), []string{"low: lora0 battery at 20%"}},
+		{sample("lora0", 2*time.Minute, link.Up, 10), []string{}},
+		{sample("lora0", 3*time.Minute, link.Up, 80), []string{}},
+		{sample("lora0", 4*time.Minute, link.Up, 5), []string{"low: lora0 battery at 5%"}},
+		{sample("lora1", 4*time.Minute, link.Up, 45), []string{"battery lora1 <50: lora1 battery at 45%"}},
+	}
+	for i, step := range steps {
+		if got := texts(e.Sample(step.s)); !slices.Equal(got, step.want) {
+			t.Errorf("step %d, %s at %.0f%%: got %q, want %q", i, step.s.Interface, step.s.Battery, got, step.want)
+		}
+	}
+}
+
+func TestAlert(t *testing.T) {
+	e := engine(t, Rule{When: "message", Hook: "true", Silent: true}, Rule{When: "keyword x"})
+	got := e.Message(chat.Message{Peer: "a1b2", Body: "x", Time: t0}, "")
+	want := []Alert{
+		{Time: t0, Rule: "message", Text: "a1b2: x", Hook: "true", Bell: false},
+		{Time: t0, Rule: "keyword x", Text: "a1b2: x", Bell: true},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("alerts = %+v, want %+v", got, want)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	e := engine(t, Rule{When: "message"})
+	for i := range MaxHistory + 10 {
+		e.Message(chat.Message{Peer: "a1b2", Body: "m", Time: t0.Add(time.Duration(i) * time.Second)}, "")
+	}
+	h := e.History()
+	if len(h) != MaxHistory {
+		t.Fatalf("history has %d alerts, want %d", len(h), MaxHistory)
+	}
+	if got, want := h[len(h)-1].Time, t0.Add((MaxHistory+9)*time.Second); !got.Equal(want) {
+		t.Errorf("last alert at %s, want %s", got, want)
+	}
+	e.Clear()
+	if h := e.History(); len(h) != 0 {
+		t.Errorf("history after Clear has %d alerts", len(h))
+	}
+}
+
+func TestReload(t *testing.T) {
+	rules := []Rule{{When: "message"}}
+	var fail error
+	e, err := Open(func() ([]Rule, error) { return rules, fail })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules = []Rule{{When: "message"}, {When: "battery <10%"}}
+	if n, err := e.Reload(); n != 2 || err != nil {
+		t.Errorf("Reload = %d, %v, want 2 rules", n, err)
+	}
+
+	// broken rules leave those in use be
+	rules = []Rule{{When: "nonsense"}}
+	if n, err := e.Reload(); n != 2 || !errors.Is(err, ErrBadRule) {
+		t.Errorf("Reload of a bad rule = %d, %v, want 2, ErrBadRule", n, err)
+	}
+	fail = errors.New("unreadable")
+	if n, err := e.Reload(); n != 2 || !errors.Is(err, fail) {
+		t.Errorf("Reload of an unreadable source = %d, %v", n, err)
+	}
+	if got := e.Rules(); len(got) != 2 || got[1].When != "battery <10%" {
+		t.Errorf("rules = %+v", got)
+	}
+}
@@ -0,0 +1,95 @@
+// Package chat is the messaging model behind the console: conversations
+// with peers, and the delivery of each message over one of the networks
+package chat
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrUnknownNetwork = errors.New("unknown network")
+	ErrUnknownMessage = errors.New("unknown message")
+)
+
+// Status is how far a message has got towards its peer
+type Status uint8
+
+const (
+	// Queued messages are waiting for a path to the peer
+	Queued Status = iota
+	// Sent messages have left on a network, again on every retry
+	Sent
+	// Acked messages have been confirmed by the peer
+	Acked
+	// Failed messages will not be retried
+	Failed
+)
+
+func (s Status) String() string {
+	switch s {
+	case Queued:
+		return "queued"
+	case Sent:
+		return "sent"
+	case Acked:
+		return "acked"
+	case Failed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+type Attachment struct {
+	Name string
+	Data []byte
+}
+
+type Message struct {
+	ID string
+	// Peer is the address of the other end of the conversation
+	Peer     string
+	Outgoing bool
+	Body     string
+	Time     time.Time
+	Status   Status
+	// Network carried the message, or is to carry it once it leaves
+	Network    string
+	Attachment *Attachment
+	// Attempts counts the times an outgoing message was transmitted
+	Attempts int
+	// Trace is the compact trace the message was sent in, carried along so
+	// every node it passes through adds to the same trace
+	Trace string
+}
+
+type Conversation struct {
+	Peer string
+	// Name is how the peer announced itself, if it has
+	Name   string
+	Unread int
+	Last   time.Time
+}
+
+// Title is the name of the peer, or its address
+func (c Conversation) Title() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Peer
+}
+
+// Backend sends and stores messages. Updates delivers every message that
+// arrives or changes status, whoever sent it.
+type Backend interface {
+	// Conversations are listed most recent first
+	Conversations() ([]Conversation, error)
+	// Messages are listed oldest first
+	Messages(peer string) ([]Message, error)
+	MarkRead(peer string) error
+	// Send queues m, on its network or the backend's choice if it has none,
+	// and returns it as stored
+	Send(m Message) (Message, error)
+	Networks() []string
+	Updates() <-chan Message
+}
@@ -0,0 +1,415 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"codeberg.org/splitringresonator/multiband/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// MaxAttempts is how many times Simulate sends a message before failing it
+const MaxAttempts = 3
+
+// MaxPending is how many updates wait for a reader, the oldest dropped past
+// it so a backend nobody reads from holds on to only so many
+const MaxPending = 1024
+
+// Memory is a backend keeping everything in memory and sending nothing.
+// Messages stay queued until SetStatus or Simulate moves them on, and
+// Receive stands in for a peer, so the console can be driven without a
+// network. Updates are queued for whoever reads them, so none of these
+// wait on a reader, up to MaxPending.
+type Memory struct {
+	mu       sync.Mutex
+	networks []string
+	messages map[string][]Message
+	names    map[string]string
+	unread   map[string]int
+	next     int
+	updates  chan Message
+	// pending are the updates not handed to Updates yet, in order, and
+	// pumping whether a goroutine is handing them out
+	pending []Message
+	pumping bool
+	// closed stops the pump, once Close is called
+	closed chan struct{}
+	once   sync.Once
+	// route lists the networks to try for a peer, by routing policy
+	route  func(peer, name string) []string
+	logger *slog.Logger
+	tracer trace.Tracer
+	// deliveries are the spans of outgoing messages not acked or failed yet
+	deliveries map[string]*delivery
+}
+
+// delivery is the trace of an outgoing message: the span of the whole of
+// it, and of the transmit attempt awaiting an ack
+type delivery struct {
+	ctx     context.Context
+	span    trace.Span
+	attempt trace.Span
+}
+
+func NewMemory(networks ...string) *Memory {
+	return &Memory{
+		networks: networks,
+		messages: map[string][]Message{},
+		names:    map[string]string{},
+		unread:   map[string]int{},
+		updates:  make(chan Message, 64),
+		closed:   make(chan struct{}),
+		logger:   slog.New(slog.DiscardHandler),
+		tracer:   noop.NewTracerProvider().Tracer(""),
+
+		deliveries: map[string]*delivery{},
+	}
+}
+
+// SetLogger has the queue log messages as they go in and move on
+func (b *Memory) SetLogger(logger *slog.Logger) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.logger = logger
+}
+
+// SetTracer has the queue trace each message it sends, from queueing to
+// the peer's ack, and those received
+func (b *Memory) SetTracer(tracer trace.Tracer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tracer = tracer
+}
+
+func (b *Memory) Conversations() ([]Conversation, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	convs := []Conversation{}
+	for peer, msgs := range b.messages {
+		convs = append(convs, Conversation{
+			Peer:   peer,
+			Name:   b.names[peer],
+			Unread: b.unread[peer],
+			Last:   msgs[len(msgs)-1].Time,
+		})
+	}
+	slices.SortFunc(convs, func(a, b Conversation) int {
+		return b.Last.Compare(a.Last)
+	})
+	return convs, nil
+}
+
+func (b *Memory) Messages(peer string) ([]Message, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.messages[peer]), nil
+}
+
+func (b *Memory) MarkRead(peer string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.unread, peer)
+	return nil
+}
+
+// SetRoute has messages sent without a network go over the first of the
+// networks route lists for their peer, known as name if it announced one
+func (b *Memory) SetRoute(route func(peer, name string) []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.route = route
+}
+
+// SetNetworks replaces the networks messages can be sent over, as
+// interfaces come and go. Messages already stored keep theirs.
+func (b *Memory) SetNetworks(networks ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.networks = networks
+}
+
+func (b *Memory) Send(m Message) (Message, error) {
+	b.mu.Lock()
+	route, name, networks, tracer := b.route, b.names[m.Peer], b.networks, b.tracer
+	b.mu.Unlock()
+
+	// a message passed on carries the trace it was sent in
+	ctx, span := tracer.Start(tracing.Remote(context.Background(), m.Trace), "message",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("peer", m.Peer)))
+	m.Trace = tracing.Compact(span.SpanContext())
+
+	_, schedule := tracer.Start(ctx, "schedule")
+	if m.Network == "" && route != nil {
+		via := route(m.Peer, name)
+		if len(via) > 0 {
+			schedule.SetAttributes(attribute.StringSlice("via", via))
+		}
+		for _, n := range via {
+			if slices.Contains(networks, n) {
+				m.Network = n
+				break
+			}
+		}
+	}
+	if m.Network == "" && len(networks) > 0 {
+		m.Network = networks[0]
+	}
+	if m.Network != "" && !slices.Contains(networks, m.Network) {
+		err := fmt.Errorf("%w %q", ErrUnknownNetwork, m.Network)
+		for _, s := range []trace.Span{schedule, span} {
+			s.RecordError(err)
+			s.SetStatus(codes.Error, err.Error())
+			s.End()
+		}
+		return m, err
+	}
+	schedule.SetAttributes(attribute.String("network", m.Network))
+	schedule.End()
+	span.SetAttributes(attribute.String("network", m.Network))
+
+	m.Outgoing = true
+	m.Status = Queued
+	_, queue := tracer.Start(ctx, "queue")
+	m = b.store(m, &delivery{ctx: ctx, span: span})
+	span.SetAttributes(attribute.String("id", m.ID))
+	queue.End()
+	logger := b.log()
+	if m.Trace != "" {
+		logger = logger.With("trace", m.Trace)
+	}
+	logger.Info("queued", "id", m.ID, "peer", m.Peer, "network", m.Network)
+	return m, nil
+}
+
+// Receive stores m as sent by its peer, known as name if not empty. Its
+// receipt is traced as part of the trace it carries, if any.
+func (b *Memory) Receive(m Message, name string) Message {
+	m.Outgoing = false
+	m.Status = Acked
+
+	b.mu.Lock()
+	b.unread[m.Peer]++
+	if name != "" {
+		b.names[m.Peer] = name
+	}
+	tracer := b.tracer
+	b.mu.Unlock()
+
+	_, span := tracer.Start(tracing.Remote(context.Background(), m.Trace), "receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("peer", m.Peer), attribute.String("network", m.Network)))
+	defer span.End()
+	if sc := span.SpanContext(); sc.IsValid() {
+		m.Trace = tracing.Compact(sc)
+	}
+	return b.store(m, nil)
+}
+
+// SetStatus moves the message with the given ID on, counting an attempt
+// each time it is sent
+func (b *Memory) SetStatus(id string, s Status) error {
+	b.mu.Lock()
+	for peer, msgs := range b.messages {
+		for i := range msgs {
+			if msgs[i].ID == id {
+				msgs[i].Status = s
+				if s == Sent {
+					msgs[i].Attempts++
+				}
+				m := msgs[i]
+				b.messages[peer] = msgs
+				// traced under the lock, as Simulate and abandon move the
+				// same delivery on
+				if d := b.deliveries[id]; d != nil {
+					d.trace(b.tracer, m)
+				}
+				if s == Acked || s == Failed {
+					delete(b.deliveries, id)
+				}
+				logger := b.logger
+				b.mu.Unlock()
+				logger.Debug("status", "id", id, "peer", peer, "status", s.String())
+				b.publish(m)
+				return nil
+			}
+		}
+	}
+	b.mu.Unlock()
+	return fmt.Errorf("%w %q", ErrUnknownMessage, id)
+}
+
+// trace follows m to its new status: every send is an attempt, lasting
+// until the ack or the next attempt, and the delivery ends once m is acked
+// or failed
+func (d *delivery) trace(tracer trace.Tracer, m Message) {
+	if d.attempt != nil {
+		if m.Status != Acked {
+			d.attempt.SetStatus(codes.Error, "no ack")
+		}
+		d.attempt.End()
+		d.attempt = nil
+	}
+	switch m.Status {
+	case Sent:
+		_, d.attempt = tracer.Start(d.ctx, "transmit",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(attribute.Int("attempt", m.Attempts), attribute.String("network", m.Network)))
+	case Acked:
+		_, ack := tracer.Start(d.ctx, "ack")
+		ack.End()
+		d.span.SetAttributes(attribute.Int("attempts", m.Attempts))
+		d.span.End()
+	case Failed:
+		d.span.SetAttributes(attribute.Int("attempts", m.Attempts))
+		d.span.SetStatus(codes.Error, "failed")
+		d.span.End()
+	}
+}
+
+// Simulate moves messages on every interval until ctx is done, as a lossy
+// network would: queued messages are sent, and sent ones acked three times
+// in four, else sent again until MaxAttempts have gone unacked
+func (b *Memory) Simulate(ctx context.Context, every time.Duration, seed uint64) {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			b.abandon("simulation stopped")
+			return
+		case <-t.C:
+		}
+
+		moves := map[string]Status{}
+		b.mu.Lock()
+		for _, msgs := range b.messages {
+			for _, m := range msgs {
+				switch {
+				case !m.Outgoing:
+				case m.Status == Queued:
+					moves[m.ID] = Sent
+				case m.Status != Sent:
+				case rng.IntN(4) > 0:
+					moves[m.ID] = Acked
+				case m.Attempts >= MaxAttempts:
+					moves[m.ID] = Failed
+				default:
+					moves[m.ID] = Sent
+				}
+			}
+		}
+		b.mu.Unlock()
+		for id, s := range moves {
+			b.SetStatus(id, s) //nolint:errcheck
+		}
+	}
+}
+
+// Close ends the traces of messages not acked or failed yet, as abandoned,
+// and stops handing out updates
+func (b *Memory) Close() error {
+	b.abandon("closed")
+	b.once.Do(func() { close(b.closed) })
+	return nil
+}
+
+// abandon ends the deliveries in flight in error, as nothing will move
+// them on any more
+func (b *Memory) abandon(reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	deliveries := b.deliveries
+	b.deliveries = map[string]*delivery{}
+
+	for _, d := range deliveries {
+		if d.attempt != nil {
+			d.attempt.SetStatus(codes.Error, reason)
+			d.attempt.End()
+		}
+		d.span.SetStatus(codes.Error, reason)
+		d.span.End()
+	}
+}
+
+func (b *Memory) log() *slog.Logger {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.logger
+}
+
+func (b *Memory) Networks() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.networks)
+}
+
+func (b *Memory) Updates() <-chan Message {
+	return b.updates
+}
+
+// store keeps m under a new ID, with the trace of its delivery if outgoing
+func (b *Memory) store(m Message, d *delivery) Message {
+	b.mu.Lock()
+	b.next++
+	m.ID = strconv.Itoa(b.next)
+	if m.Time.IsZero() {
+		m.Time = time.Now()
+	}
+	b.messages[m.Peer] = append(b.messages[m.Peer], m)
+	if d != nil {
+		b.deliveries[m.ID] = d
+	}
+	b.mu.Unlock()
+
+	b.publish(m)
+	return m
+}
+
+// publish queues m for Updates. Callers, like a console sending from its
+// update loop, would otherwise wait on themselves to read it. Past
+// MaxPending the oldest update waiting is dropped.
+func (b *Memory) publish(m Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.pending) >= MaxPending {
+		b.pending = slices.Delete(b.pending, 0, len(b.pending)-MaxPending+1)
+	}
+	b.pending = append(b.pending, m)
+	if !b.pumping {
+		b.pumping = true
+		go b.pump()
+	}
+}
+
+// pump hands the pending updates out in order, until there are none or
+// the backend is closed
+func (b *Memory) pump() {
+	for {
+		b.mu.Lock()
+		if len(b.pending) == 0 {
+			b.pumping = false
+			b.mu.Unlock()
+			return
+		}
+		m := b.pending[0]
+		b.pending = b.pending[1:]
+		b.mu.Unlock()
+		select {
+		case b.updates <- m:
+		case <-b.closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package chat
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUpdatesDoNotBlock(t *testing.T) {
+	const n = 500
+	b := NewMemory("lora")
+
+	// nobody reads updates while the messages go in and move on
+	done := make(chan error, 1)
+	go func() {
+		for i := range n {
+			m, err := b.Send(Message{Peer: "bob", Body: strconv.Itoa(i)})
+			if err != nil {
+				done <- err
+				return
+			}
+			if err := b.SetStatus(m.ID, Sent); err != nil {
+				done <- err
+				return
+			}
+		}
+		b.Receive(Message{Peer: "bob", Body: "thanks"}, "Bob")
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("sending blocked on updates nobody read")
+	}
+
+	// every update still turns up, in order
+	for i := range 2*n + 1 {
+		select {
+		case m := <-b.Updates():
+			id, status := strconv.Itoa(i/2+1), Queued
+			if i%2 == 1 {
+				status = Sent
+			}
+			if i == 2*n {
+				id, status = strconv.Itoa(n+1), Acked
+			}
+			if m.ID != id || m.Status != status {
+				t.Fatalf("update %d is %s %s, want %s %s", i, m.ID, m.Status, id, status)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("update %d never came", i)
+		}
+	}
+}
+
+func TestUpdatesDropOldest(t *testing.T) {
+	const n = 3 * MaxPending
+	b := NewMemory("lora")
+	defer b.Close() //nolint:errcheck
+
+	// nobody reads updates, so only the newest are kept waiting
+	for i := range n {
+		if _, err := b.Send(Message{Peer: "bob", Body: strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.mu.Lock()
+	pending := len(b.pending)
+	b.mu.Unlock()
+	if pending > MaxPending {
+		t.Fatalf("%d updates pending, want at most %d", pending, MaxPending)
+	}
+
+	got := 0
+	for {
+		select {
+		case m := <-b.Updates():
+			got++
+			if m.ID != strconv.Itoa(n) {
+				continue
+			}
+			if got >= n {
+				t.Errorf("all %d updates kept", got)
+			}
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatalf("newest update never came, after %d", got)
+		}
+	}
+}
+
+func TestSimulateConcurrently(t *testing.T) {
+	b, spans := traced(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	simulated := make(chan struct{})
+	go func() {
+		b.Simulate(ctx, time.Microsecond, 1)
+		close(simulated)
+	}()
+	go func() {
+		for range b.Updates() {
+		}
+	}()
+
+	ids := []string{}
+	for i := range 50 {
+		m, err := b.Send(Message{Peer: "bob", Body: strconv.Itoa(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, m.ID)
+	}
+	// moving the same messages on by hand while the simulation does too
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				for _, id := range ids {
+					b.SetStatus(id, Sent) //nolint:errcheck
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	cancel()
+	<-simulated
+
+	ended := 0
+	for _, s := range spans() {
+		if s.Name == "message" {
+			ended++
+		}
+	}
+	if ended != len(ids) {
+		t.Errorf("%d of %d deliveries ended", ended, len(ids))
+	}
+}
@@ -0,0 +1,217 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"codeberg.org/splitringresonator/multiband/internal/tracing"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// span is what the stdout exporter writes of a span
+type span struct {
+	Name        string
+	SpanContext struct{ TraceID, SpanID string }
+	Parent      struct{ TraceID, SpanID string }
+	Status      struct{ Code, Description string }
+	Attributes  []struct {
+		Key   string
+		Value struct{ Value any }
+	}
+}
+
+func (s span) attr(key string) any {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			return a.Value.Value
+		}
+	}
+	return nil
+}
+
+// traced is a Memory tracing into a buffer, and the spans it wrote there
+func traced(t *testing.T) (*Memory, func() []span) {
+	t.Helper()
+	out := &bytes.Buffer{}
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	b := NewMemory("lora", "tcp")
+	b.SetTracer(provider.Tracer("queue"))
+
+	return b, func() []span {
+		t.Helper()
+		if err := provider.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		spans := []span{}
+		dec := json.NewDecoder(out)
+		for {
+			var s span
+			if err := dec.Decode(&s); errors.Is(err, io.EOF) {
+				return spans
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			spans = append(spans, s)
+		}
+	}
+}
+
+// tree is the spans of a trace by name, children of root or root itself
+func tree(t *testing.T, spans []span, root span) map[string][]span {
+	t.Helper()
+	byName := map[string][]span{}
+	for _, s := range spans {
+		if s.SpanContext.TraceID != root.SpanContext.TraceID {
+			continue
+		}
+		if s.SpanContext.SpanID != root.SpanContext.SpanID && s.Parent.SpanID != root.SpanContext.SpanID {
+			t.Errorf("%s span is not a child of %s", s.Name, root.Name)
+		}
+		byName[s.Name] = append(byName[s.Name], s)
+	}
+	return byName
+}
+
+func send(t *testing.T, b *Memory, peer string, statuses ...Status) Message {
+	t.Helper()
+	m, err := b.Send(Message{Peer: peer, Body: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if err := b.SetStatus(m.ID, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+// root is the message span m was sent in, by its compact trace
+func root(t *testing.T, spans []span, m Message) span {
+	t.Helper()
+	sc, err := tracing.Parse(m.Trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tracing.Compact(sc); got != m.Trace {
+		t.Errorf("Compact(Parse(%q)) = %q", m.Trace, got)
+	}
+	for _, s := range spans {
+		if s.Name == "message" && s.SpanContext.TraceID == sc.TraceID().String() && s.SpanContext.SpanID == sc.SpanID().String() {
+			return s
+		}
+	}
+	t.Fatalf("no message span for trace %q", m.Trace)
+	return span{}
+}
+
+func wantStatus(t *testing.T, s span, code, description string) {
+	t.Helper()
+	if s.Status.Code != code || s.Status.Description != description {
+		t.Errorf("%s span status %s %q, want %s %q", s.Name, s.Status.Code, s.Status.Description, code, description)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	b, spans := traced(t)
+	acked := send(t, b, "bob", Sent, Sent, Acked)
+	failed := send(t, b, "bob", Sent, Failed)
+	reply := b.Receive(Message{Peer: "bob", Body: "got it", Trace: acked.Trace}, "")
+	all := spans()
+
+	message := root(t, all, acked)
+	got := tree(t, all, message)
+	for name, n := range map[string]int{"message": 1, "schedule": 1, "queue": 1, "transmit": 2, "ack": 1, "receive": 1} {
+		if len(got[name]) != n {
+			t.Errorf("acked message has %d %s spans, want %d", len(got[name]), name, n)
+		}
+	}
+	wantStatus(t, message, "Unset", "")
+	if a := message.attr("attempts"); a != float64(2) {
+		t.Errorf("acked after %v attempts, want 2", a)
+	}
+	if a := message.attr("network"); a != "lora" {
+		t.Errorf("acked message sent over %v", a)
+	}
+	if transmit := got["transmit"]; len(transmit) == 2 {
+		wantStatus(t, transmit[0], "Error", "no ack")
+		wantStatus(t, transmit[1], "Unset", "")
+	}
+	// the reply is received in the trace it carries
+	if receive := got["receive"]; len(receive) == 1 {
+		sc, err := tracing.Parse(reply.Trace)
+		if err != nil || sc.SpanID().String() != receive[0].SpanContext.SpanID {
+			t.Errorf("reply carries %q, want the receive span %s", reply.Trace, receive[0].SpanContext.SpanID)
+		}
+	}
+
+	message = root(t, all, failed)
+	got = tree(t, all, message)
+	wantStatus(t, message, "Error", "failed")
+	if transmit := got["transmit"]; len(transmit) != 1 {
+		t.Errorf("failed message has %d transmit spans, want 1", len(transmit))
+	} else {
+		wantStatus(t, transmit[0], "Error", "no ack")
+	}
+	if len(got["ack"]) != 0 {
+		t.Errorf("failed message acked")
+	}
+}
+
+func TestTraceUnknownNetwork(t *testing.T) {
+	b, spans := traced(t)
+	if _, err := b.Send(Message{Peer: "bob", Network: "carrier-pigeon"}); !errors.Is(err, ErrUnknownNetwork) {
+		t.Fatalf("Send = %v", err)
+	}
+	for _, s := range spans() {
+		if s.Name != "message" && s.Name != "schedule" {
+			t.Errorf("%s span traced for a message never queued", s.Name)
+		}
+		if s.Status.Code != "Error" {
+			t.Errorf("%s span status %s, want Error", s.Name, s.Status.Code)
+		}
+	}
+}
+
+func TestTraceAbandoned(t *testing.T) {
+	for _, tc := range []struct {
+		name, reason string
+		stop         func(*Memory)
+	}{
+		{"close", "closed", func(b *Memory) { b.Close() }}, //nolint:errcheck
+		{"simulate", "simulation stopped", func(b *Memory) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			b.Simulate(ctx, time.Hour, 1)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, spans := traced(t)
+			queued := send(t, b, "bob")
+			sent := send(t, b, "bob", Sent)
+			done := send(t, b, "bob", Sent, Acked)
+			tc.stop(b)
+			all := spans()
+
+			for _, m := range []Message{queued, sent} {
+				wantStatus(t, root(t, all, m), "Error", tc.reason)
+			}
+			if transmit := tree(t, all, root(t, all, sent))["transmit"]; len(transmit) != 1 {
+				t.Errorf("abandoned message has %d transmit spans, want 1", len(transmit))
+			} else {
+				wantStatus(t, transmit[0], "Error", tc.reason)
+			}
+			wantStatus(t, root(t, all, done), "Unset", "")
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package docs
+
+import (
+	"fmt"
+
+	"codeberg.org/splitringresonator/multiband/internal/docsite"
+	"codeberg.org/splitringresonator/multiband/internal/preprocess"
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/glamour/styles"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// Render modes for printing a document outside of the browser
+const (
+	RenderANSI     = "ansi"
+	RenderPlain    = "plain"
+	RenderHTML     = "html"
+	RenderMarkdown = "markdown"
+)
+
+// glamourMargin is the left and right margin of glamour's document styles
+const glamourMargin = 2
+
+var RenderModes = []string{RenderANSI, RenderPlain, RenderHTML, RenderMarkdown}
+
+// Render formats a document for printing, wrapped at width where that applies
+func Render(p docsite.Page, mode string, width int) ([]byte, error) {
+	_, body := docsite.FrontMatter(p.Raw)
+
+	var style glamour.TermRendererOption
+	profile := lipgloss.ColorProfile()
+	switch mode {
+	case RenderMarkdown:
+		return p.Raw, nil
+	case RenderHTML:
+		return docsite.Renderer{}.Render(p.Raw), nil
+	case RenderANSI:
+		style = currentTheme.GlamourStyle()
+	case RenderPlain:
+		style = glamour.WithStandardStyle(styles.NoTTYStyle)
+		profile = termenv.Ascii
+	default:
+		return nil, fmt.Errorf("unknown render mode %q", mode)
+	}
+
+	renderer, err := glamour.NewTermRenderer(
+		style,
+		glamour.WithColorProfile(profile),
+		glamour.WithWordWrap(width),
+		glamour.WithBaseURL(p.Path),
+		glamour.WithPreservedNewLines(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	body = preprocess.Markdown(body, preprocess.Options{Diagrams: preprocess.Text, Width: width - 2*glamourMargin})
+	out, err := renderer.RenderBytes(body)
+	if err != nil {
+		return nil, fmt.Errorf("rendering %s: %w", p.Path, err)
+	}
+	return out, nil
+}
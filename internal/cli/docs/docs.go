@@ -2,47 +2,81 @@ package docs
 
 import (
 	"fmt"
+	"io"
 	"io/fs"
+	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"codeberg.org/splitringresonator/multiband/docs"
+	"codeberg.org/splitringresonator/multiband/internal/cli/keymap"
+	"codeberg.org/splitringresonator/multiband/internal/cli/theme"
+	"codeberg.org/splitringresonator/multiband/internal/docsite"
+	"codeberg.org/splitringresonator/multiband/internal/preprocess"
 	"codeberg.org/splitringresonator/multiband/internal/version"
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/glamour"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 )
 
 var (
+	titleStyle     lipgloss.Style
+	headerStyle    lipgloss.Style
+	errorTextStyle lipgloss.Style
+	infoStyle      lipgloss.Style
+	//	itemStyle         = lipgloss.NewStyle().PaddingLeft(4)
+	//	selectedItemStyle = lipgloss.NewStyle().PaddingLeft(2).Foreground(lipgloss.Color("170"))
+	statusStyle     lipgloss.Style
+	paginationStyle = list.DefaultStyles().PaginationStyle.PaddingLeft(4)
+	helpStyle       = list.DefaultStyles().HelpStyle.PaddingLeft(4).PaddingBottom(1)
+
+	// currentTheme also provides the glamour style documents render with
+	currentTheme theme.Theme
+)
+
+func init() {
+	SetTheme(theme.Default)
+}
+
+// SetTheme restyles the browser. It applies to models created afterwards.
+func SetTheme(t theme.Theme) {
+	currentTheme = t
+
 	titleStyle = lipgloss.NewStyle().
-			Margin(1, 2).
-			AlignHorizontal(lipgloss.Center).
-			Background(lipgloss.Color("5"))
+		Margin(1, 2).
+		AlignHorizontal(lipgloss.Center).
+		Foreground(t.Text()).
+		Background(t.Primary())
 	headerStyle = lipgloss.NewStyle().
-			Margin(1, 2).
-			AlignHorizontal(lipgloss.Center).
-			Foreground(lipgloss.Color("5"))
+		Margin(1, 2).
+		AlignHorizontal(lipgloss.Center).
+		Foreground(t.Primary())
 	errorTextStyle = lipgloss.NewStyle().
-			Margin(2, 2).
-			AlignHorizontal(lipgloss.Center).
-			AlignVertical(lipgloss.Center).
-			Foreground(lipgloss.Color("9"))
+		Margin(2, 2).
+		AlignHorizontal(lipgloss.Center).
+		AlignVertical(lipgloss.Center).
+		Foreground(t.Error())
 	infoStyle = func() lipgloss.Style {
-		b := lipgloss.RoundedBorder()
+		b := t.BorderStyle()
 		b.Left = "┤"
 		return titleStyle.BorderStyle(b)
 	}()
-	//BorderStyle(lipgloss.RoundedBorder()).
-	//BorderForeground(lipgloss.Color("62"))
-	//
-	//PaddingRight(2)
-	//	itemStyle         = lipgloss.NewStyle().PaddingLeft(4)
-	//	selectedItemStyle = lipgloss.NewStyle().PaddingLeft(2).Foreground(lipgloss.Color("170"))
-	paginationStyle = list.DefaultStyles().PaginationStyle.PaddingLeft(4)
-	helpStyle       = list.DefaultStyles().HelpStyle.PaddingLeft(4).PaddingBottom(1)
-)
+	statusStyle = lipgloss.NewStyle().
+		PaddingLeft(2).
+		Foreground(t.Primary())
+	paneStyle = lipgloss.NewStyle().
+		BorderStyle(t.BorderStyle()).
+		BorderLeft(true).
+		BorderForeground(t.Primary()).
+		PaddingLeft(1)
+}
 
 type Origin uint8
 
@@ -53,37 +87,46 @@ const (
 )
 
 type item struct {
-	title                      string
+	title, path                string
 	origin                     Origin
 	content, snippet, revision *string
+	words                      int
+	// depth indents the item under its category in the tree view
+	depth      int
+	bookmarked bool
 
 	err error
 }
 
 func (i item) FilterValue() string {
 	if i.content != nil {
-		return i.title + *i.content
+		return i.title + i.path + *i.content
 	}
 
 	if i.snippet != nil {
-		return i.title + *i.snippet
+		return i.title + i.path + *i.snippet
 	}
 
-	return i.title
+	return i.title + i.path
 }
 
 func (i item) Description() string {
 	if i.err != nil {
 		return i.err.Error()
 	}
-	if i.snippet != nil {
-		return *i.snippet
+
+	parts := []string{i.path, fmt.Sprintf("%d words", i.words)}
+	if i.revision != nil && *i.revision != "" {
+		parts = append(parts, "rev "+*i.revision)
 	}
-	return ""
+	return strings.Repeat("  ", i.depth) + strings.Join(parts, " · ")
 }
 
 func (i item) Title() string {
 	trinkets := []string{}
+	if i.bookmarked {
+		trinkets = append(trinkets, "★")
+	}
 
 	/*
 		switch origin := i.origin; origin {
@@ -95,10 +138,11 @@ func (i item) Title() string {
 		}
 	*/
 
+	title := strings.Repeat("  ", i.depth) + i.title
 	if len(trinkets) > 0 {
-		return fmt.Sprintf("%s (%s)", i.title, strings.Join(trinkets, " "))
+		return fmt.Sprintf("%s (%s)", title, strings.Join(trinkets, " "))
 	} else {
-		return i.title
+		return title
 	}
 }
 
@@ -136,6 +180,46 @@ type Model struct {
 	width      uint
 	height     uint
 
+	// links found in rawContent, and which one is selected (-1 for none)
+	links   []link
+	linkIdx int
+	// back and forward are stacks of pages for history navigation
+	back, forward []string
+	status        string
+
+	// in-page search, active while the input is focused
+	searching bool
+	input     textinput.Model
+	query     string
+	matches   []match
+	matchIdx  int
+
+	// table of contents overlay
+	showTOC  bool
+	headings []heading
+	tocIdx   int
+
+	categories []category
+
+	// state persists bookmarks, positions and history to statePath
+	state     State
+	statePath string
+
+	// split shows the list and a rendered preview side by side on wide terminals
+	split       bool
+	preview     viewport.Model
+	previewPath string
+
+	keys keymap.Docs
+	help help.Model
+	// embedded browsers leave quitting to the program around them, quit
+	// closing the page instead
+	embedded bool
+	// out is the terminal the program draws on, stdout if nil. Remote
+	// browsers copy links there rather than open them on this machine.
+	out    io.Writer
+	remote bool
+
 	list     list.Model
 	viewport viewport.Model
 }
@@ -145,61 +229,275 @@ func (m Model) Init() tea.Cmd {
 }
 
 func (m Model) getRenderer() (*glamour.TermRenderer, error) {
-	const glamourGutter = 2
-	glamourRenderWidth := int(m.width) - m.viewport.Style.GetHorizontalFrameSize() - glamourGutter
+	return m.getRendererFor(m.choice)
+}
+
+const glamourGutter = 2
+
+func (m Model) getRendererFor(path string) (*glamour.TermRenderer, error) {
+	glamourRenderWidth := m.paneWidth() - m.viewport.Style.GetHorizontalFrameSize() - glamourGutter
 
 	return glamour.NewTermRenderer(
-		glamour.WithAutoStyle(),
+		currentTheme.GlamourStyle(),
 		glamour.WithColorProfile(lipgloss.ColorProfile()),
 		glamour.WithWordWrap(glamourRenderWidth),
-		glamour.WithWordWrap(int(m.width)), //nolint:gosec
-		glamour.WithBaseURL(m.choice),
+		glamour.WithWordWrap(m.paneWidth()),
+		glamour.WithBaseURL(path),
 		glamour.WithPreservedNewLines(),
 	)
 }
 
-func (m Model) renderContent() string {
+// render renders an arbitrary document, as shown in the preview pane
+func (m Model) render(raw, path string) (string, error) {
+	renderer, err := m.getRendererFor(path)
+	if err != nil {
+		return "", err
+	}
+	_, body := docsite.FrontMatter([]byte(raw))
+	return renderer.Render(m.prepare(string(body)))
+}
+
+// prepare draws diagrams and reflows tables to fit the pane, leaving room for
+// the document margins glamour adds
+func (m Model) prepare(raw string) string {
+	width := m.paneWidth() - m.viewport.Style.GetHorizontalFrameSize() - glamourGutter - 2*glamourMargin
+	return string(preprocess.Markdown([]byte(raw), preprocess.Options{Diagrams: preprocess.Text, Width: width}))
+}
+
+// renderContent renders the current document, highlighting the selected
+// link. It also returns the line the link landed on, or -1.
+func (m Model) renderContent() (string, int) {
 	if m.choice == "" {
-		return ""
+		return "", -1
 	}
 
 	renderer, err := m.getRenderer()
 
 	if err != nil {
-		return errorTextStyle.Render(err.Error())
+		return errorTextStyle.Render(err.Error()), -1
 	}
 
-	str, err := renderer.Render(m.rawContent)
+	raw := m.rawContent
+	if m.linkIdx >= 0 && m.linkIdx < len(m.links) {
+		raw = markLink(raw, m.links[m.linkIdx])
+	}
+
+	str, err := renderer.Render(m.prepare(raw))
 	if err != nil {
-		return errorTextStyle.Render(err.Error())
+		return errorTextStyle.Render(err.Error()), -1
 	}
 
-	return str
+	return highlightMarks(str)
+}
+
+// refresh re-renders the current document into the viewport, recomputing
+// search matches and heading positions for the new layout. It returns the
+// line of the selected link, or -1.
+func (m *Model) refresh() int {
+	str, linkLine := m.renderContent()
+	plain := strings.Split(ansi.Strip(str), "\n")
+	m.matches = findMatches(plain, m.query)
+	m.headings = findHeadings(m.rawContent, plain)
+	if m.matchIdx >= len(m.matches) {
+		m.matchIdx = 0
+	}
+	m.viewport.SetContent(highlightMatches(str, m.matches))
+	return linkLine
+}
+
+// scrollTo brings line into view, roughly centred, if it is not already visible
+func (m *Model) scrollTo(line int) {
+	if line >= 0 && (line < m.viewport.YOffset || line >= m.viewport.YOffset+m.viewport.Height) {
+		m.viewport.SetYOffset(max(0, line-m.viewport.Height/2))
+	}
+}
+
+// jumpMatch moves to the next (delta 1) or previous (delta -1) search match
+func (m *Model) jumpMatch(delta int) {
+	if len(m.matches) == 0 {
+		if m.query != "" {
+			m.status = fmt.Sprintf("no matches for %q", m.query)
+		}
+		return
+	}
+	m.matchIdx = (m.matchIdx + delta + len(m.matches)) % len(m.matches)
+	m.scrollTo(m.matches[m.matchIdx].line)
+	m.status = ""
+}
+
+// search runs query against the current page and jumps to the first match
+// at or below the top of the viewport
+func (m *Model) search(query string) {
+	m.query = query
+	m.refresh()
+	m.matchIdx = 0
+	for i, mt := range m.matches {
+		if mt.line >= m.viewport.YOffset {
+			m.matchIdx = i
+			break
+		}
+	}
+	m.jumpMatch(0)
 }
 
 func (m *Model) updateWindowSize(msg tea.WindowSizeMsg) {
-	m.viewport.Style.Height(msg.Height)
-	m.list.SetHeight(msg.Height)
-	m.list.SetWidth(msg.Width)
 	m.width = uint(msg.Width)
 	m.height = uint(msg.Height)
+	m.split = msg.Width >= splitMinWidth
+
+	m.viewport.Style.Height(msg.Height)
+	// the list is drawn below a blank line
+	m.list.SetSize(m.listWidth(), msg.Height-1)
+
+	// https://github.com/charmbracelet/bubbletea/blob/c2414242/examples/pager/main.go#L52
+	headerHeight := lipgloss.Height(m.headerView())
+	footerHeight := lipgloss.Height(m.footerView())
+	verticalMarginHeight := headerHeight + footerHeight
+
+	offset := m.viewport.YOffset
+	if !m.initalized {
+		// Since this program is using the full size of the viewport we
+		// need to wait until we've received the window dimensions before
+		// we can initialize the viewport. The initial dimensions come in
+		// quickly, though asynchronously, which is why we wait for them
+		// here.
+		m.viewport = viewport.New(m.paneWidth(), msg.Height-verticalMarginHeight)
+		m.viewport.YPosition = headerHeight
+		m.bindViewport()
+		m.initalized = true
+	} else {
+		m.viewport.Width = m.paneWidth()
+		m.viewport.Height = msg.Height - verticalMarginHeight
+	}
+	m.preview.Width = m.viewport.Width
+	m.preview.Height = m.viewport.Height
+	m.help.Width = m.paneWidth() - statusStyle.GetHorizontalFrameSize()
 
 	if m.choice != "" {
-		// adjust width of viewport or rendered content
-		m.viewport.SetContent(m.renderContent())
+		// adjust width of viewport or rendered content, keeping the position
+		m.refresh()
+		m.viewport.SetYOffset(offset)
 	}
+
+	// rerender the preview at the new width
+	m.previewPath = ""
+	m.updatePreview()
 }
 
 func (m *Model) loadSelection(path string) error {
+	return m.open(path, true)
+}
+
+// open shows the document at path in the pager. When record is set, the
+// current page is pushed onto the back stack and the forward stack cleared.
+func (m *Model) open(path string, record bool) error {
+	content, err := m.content(path)
+	if err != nil {
+		m.status = err.Error()
+		return err
+	}
+
+	if record {
+		if m.choice != "" {
+			m.back = append(m.back, m.choice)
+		}
+		m.forward = nil
+	}
+	m.rememberPosition()
+
+	_, body := docsite.FrontMatter([]byte(content))
+
 	m.choice = path
 	m.history = append(m.history, m.choice)
+	m.rawContent = string(body)
+	m.links = parseLinks(m.rawContent)
+	m.linkIdx = -1
+	m.status = ""
+	m.query, m.matchIdx = "", 0
+	m.showTOC = false
+	m.refresh()
+	m.viewport.GotoTop()
+	if pos, ok := m.state.Positions[path]; ok {
+		m.viewport.SetYOffset(pos)
+	}
 
-	m.rawContent = string(*m.list.SelectedItem().(item).content)
-	m.viewport.SetContent(m.renderContent())
+	return nil
+}
+
+// content looks up a loaded document, falling back to the embedded docs
+func (m *Model) content(path string) (string, error) {
+	if i, ok := m.document(path); ok && i.content != nil {
+		return *i.content, nil
+	}
+	dat, err := docs.Docs.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(dat), nil
+}
+
+// cycleLink moves the link selection by delta, wrapping around, and scrolls
+// the selected link into view
+func (m *Model) cycleLink(delta int) {
+	if len(m.links) == 0 {
+		m.status = "no links on this page"
+		return
+	}
+	if m.linkIdx < 0 && delta < 0 {
+		m.linkIdx = 0
+	}
+	m.linkIdx = (m.linkIdx + delta + len(m.links)) % len(m.links)
 
+	l := m.links[m.linkIdx]
+	m.status = fmt.Sprintf("link %d/%d: %s", m.linkIdx+1, len(m.links), l.dest)
+
+	m.scrollTo(m.refresh())
+}
+
+// followLink opens the selected link, inside the pager for relative
+// documents, or through the OS for anything else
+func (m *Model) followLink() tea.Cmd {
+	if m.linkIdx < 0 || m.linkIdx >= len(m.links) {
+		return nil
+	}
+	l := m.links[m.linkIdx]
+	if l.external() {
+		return openURL(m.output(), m.remote, l.dest)
+	}
+	if p, ok := resolveLink(m.choice, l.dest); ok {
+		m.open(p, true)
+		return nil
+	}
+	m.status = fmt.Sprintf("cannot follow %s", l.dest)
 	return nil
 }
 
+func (m *Model) goBack() {
+	if len(m.back) == 0 {
+		m.status = "no previous page"
+		return
+	}
+	prev, cur := m.back[len(m.back)-1], m.choice
+	if m.open(prev, false) != nil {
+		return
+	}
+	m.back = m.back[:len(m.back)-1]
+	m.forward = append(m.forward, cur)
+}
+
+func (m *Model) goForward() {
+	if len(m.forward) == 0 {
+		m.status = "no next page"
+		return
+	}
+	next, cur := m.forward[len(m.forward)-1], m.choice
+	if m.open(next, false) != nil {
+		return
+	}
+	m.forward = m.forward[:len(m.forward)-1]
+	m.back = append(m.back, cur)
+}
+
 func (m *Model) headerView() string {
 	title := titleStyle.Render("Mr. Pager")
 	line := strings.Repeat("─", max(0, m.viewport.Width-lipgloss.Width(title)))
@@ -219,30 +517,21 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	)
 
 	switch msg := msg.(type) {
+	case statusMsg:
+		m.status = string(msg)
+		return m, nil
+
 	case tea.WindowSizeMsg:
 		m.updateWindowSize(msg)
 
-		// https://github.com/charmbracelet/bubbletea/blob/c2414242/examples/pager/main.go#L52
-		headerHeight := lipgloss.Height(m.headerView())
-		footerHeight := lipgloss.Height(m.footerView())
-		verticalMarginHeight := headerHeight + footerHeight
-
-		if !m.initalized {
-			// Since this program is using the full size of the viewport we
-			// need to wait until we've received the window dimensions before
-			// we can initialize the viewport. The initial dimensions come in
-			// quickly, though asynchronously, which is why we wait for them
-			// here.
-			m.viewport = viewport.New(msg.Width, msg.Height-verticalMarginHeight)
-			m.viewport.YPosition = headerHeight
-			m.viewport.SetContent(m.renderContent())
-			m.initalized = true
-		} else {
-			m.viewport.Width = msg.Width
-			m.viewport.Height = msg.Height - verticalMarginHeight
+	case tea.KeyMsg:
+		if m.searching {
+			return m.updateSearch(msg)
+		}
+		if m.showTOC {
+			return m.updateTOC(msg), nil
 		}
 
-	case tea.KeyMsg:
 		if m.list.FilterState() == list.Filtering {
 			// Don't match any of the keys below if we're actively filtering in the list
 			break
@@ -253,30 +542,133 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		//break
 		//}
 
-		switch keypress := msg.String(); keypress {
+		switch k := m.keys; {
 
-		case "esc":
+		case key.Matches(msg, k.Close):
 			if m.choice != "" {
-				m.choice = ""
+				m.closePage()
 				// do not propagate event down to pager, to avoid exiting
 				return m, nil
 			}
 
-		case "ctrl+f":
-			m.viewport.HalfPageDown()
+		case m.embedded && key.Matches(msg, k.Quit):
+			if m.choice != "" {
+				m.closePage()
+			}
+			return m, nil
+
+		case key.Matches(msg, k.NextLink):
+			if m.choice != "" {
+				m.cycleLink(1)
+				return m, nil
+			}
+
+		case key.Matches(msg, k.PrevLink):
+			if m.choice != "" {
+				m.cycleLink(-1)
+				return m, nil
+			}
+
+		case key.Matches(msg, k.Back):
+			if m.choice != "" {
+				m.goBack()
+				return m, nil
+			}
 
-		case "ctrl+b":
-			m.viewport.HalfPageUp()
+		case key.Matches(msg, k.Forward):
+			if m.choice != "" {
+				m.goForward()
+				return m, nil
+			}
+
+		case key.Matches(msg, k.Search):
+			if m.choice != "" {
+				m.searching = true
+				m.input.SetValue("")
+				return m, m.input.Focus()
+			}
+
+		case key.Matches(msg, k.NextMatch):
+			if m.choice != "" && m.query != "" {
+				m.jumpMatch(1)
+				return m, nil
+			}
+
+		case key.Matches(msg, k.PrevMatch):
+			if m.choice != "" && m.query != "" {
+				m.jumpMatch(-1)
+				return m, nil
+			}
 
-		case "q", "ctrl+c":
+		case key.Matches(msg, k.TOC):
+			if m.choice != "" {
+				if len(m.headings) == 0 {
+					m.status = "no headings on this page"
+					return m, nil
+				}
+				m.showTOC = true
+				m.tocIdx = 0
+				return m, nil
+			}
+
+		case key.Matches(msg, k.CopyLink):
+			if m.choice != "" && m.linkIdx >= 0 {
+				return m, copyURL(m.output(), m.links[m.linkIdx].dest)
+			}
+
+		case key.Matches(msg, k.Bookmark):
+			if m.choice != "" {
+				m.toggleBookmark(m.choice)
+				return m, nil
+			}
+			if i, ok := m.list.SelectedItem().(item); ok {
+				m.toggleBookmark(i.path)
+				return m, m.list.NewStatusMessage(m.status)
+			}
+
+		case key.Matches(msg, k.Help):
+			if m.choice != "" {
+				m.help.ShowAll = !m.help.ShowAll
+				return m, nil
+			}
+
+		case key.Matches(msg, k.HalfDown):
+			if m.choice == "" && m.split {
+				m.preview.HalfPageDown()
+			} else {
+				m.viewport.HalfPageDown()
+			}
+
+		case key.Matches(msg, k.HalfUp):
+			if m.choice == "" && m.split {
+				m.preview.HalfPageUp()
+			} else {
+				m.viewport.HalfPageUp()
+			}
+
+		case key.Matches(msg, k.Quit):
 			m.quitting = true
 			cmds = append(cmds, tea.Quit)
 
-		case "enter":
+		case key.Matches(msg, k.Toggle):
+			if m.choice == "" {
+				if c, ok := m.list.SelectedItem().(categoryItem); ok {
+					m.toggleCategory(c.index)
+					return m, nil
+				}
+			}
+
+		case key.Matches(msg, k.Open):
 			if m.choice == "" {
-				if i, ok := m.list.SelectedItem().(item); ok {
-					m.loadSelection(i.title)
+				switch i := m.list.SelectedItem().(type) {
+				case item:
+					m.loadSelection(i.path)
+				case categoryItem:
+					m.toggleCategory(i.index)
+					return m, nil
 				}
+			} else {
+				return m, m.followLink()
 			}
 
 		}
@@ -286,24 +678,110 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.viewport, cmd = m.viewport.Update(msg)
 		cmds = append(cmds, cmd)
 	} else {
+		// filter across every document, then fall back to the tree
+		filtering := m.list.FilterState() != list.Unfiltered
+		if k, ok := msg.(tea.KeyMsg); ok && !filtering && key.Matches(k, m.list.KeyMap.Filter) {
+			cmds = append(cmds, m.list.SetItems(m.flatItems()))
+		}
 		m.list, cmd = m.list.Update(msg)
 		cmds = append(cmds, cmd)
+		if filtering && m.list.FilterState() == list.Unfiltered {
+			cmds = append(cmds, m.list.SetItems(m.treeItems()))
+		}
+		m.updatePreview()
 	}
 
 	return m, tea.Batch(cmds...)
 }
 
+func (m Model) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		m.searching = false
+		m.input.Blur()
+		m.search(m.input.Value())
+		return m, nil
+	case "esc":
+		m.searching = false
+		m.input.Blur()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m Model) updateTOC(msg tea.KeyMsg) tea.Model {
+	switch k := m.keys; {
+	case key.Matches(msg, k.Up):
+		if m.tocIdx > 0 {
+			m.tocIdx--
+		}
+	case key.Matches(msg, k.Down):
+		if m.tocIdx < len(m.headings)-1 {
+			m.tocIdx++
+		}
+	case key.Matches(msg, k.Open):
+		m.showTOC = false
+		if line := m.headings[m.tocIdx].line; line >= 0 {
+			m.viewport.SetYOffset(line)
+		}
+	case key.Matches(msg, k.Close, k.TOC, k.Quit):
+		m.showTOC = false
+	}
+	return m
+}
+
+func (m Model) tocView() string {
+	var b strings.Builder
+	for i, h := range m.headings {
+		cursor := "  "
+		if i == m.tocIdx {
+			cursor = "> "
+		}
+		row := fmt.Sprintf("%s%s%s", cursor, strings.Repeat("  ", h.level-1), h.text)
+		if i == m.tocIdx {
+			row = statusStyle.Render(row)
+		}
+		b.WriteString(row + "\n")
+	}
+	return b.String()
+}
+
 func (m Model) View() string {
 	if m.choice != "" {
 		pct := fmt.Sprintf("%.0f%%", (float32(m.viewport.YOffset+m.viewport.VisibleLineCount())/float32(m.viewport.TotalLineCount()))*100.0)
 		ln := fmt.Sprintf("ln:%d:%d:%d", m.viewport.YOffset, m.viewport.YOffset+m.viewport.VisibleLineCount(), m.viewport.TotalLineCount())
-		return headerStyle.Render(fmt.Sprintf("> %s@%s (%s %s)", m.choice, version.Short, pct, ln)) + "\n" + m.viewport.View()
+		if len(m.matches) > 0 {
+			ln += fmt.Sprintf(" /%s %d/%d@ln:%d", m.query, m.matchIdx+1, len(m.matches), m.matches[m.matchIdx].line)
+		}
+		header := headerStyle.Render(fmt.Sprintf("> %s@%s (%s %s)", m.choice, version.Short, pct, ln))
+
+		view := header + "\n" + m.viewport.View()
+		if m.showTOC {
+			view = header + "\n" + m.tocView()
+		} else if m.searching {
+			view += "\n" + m.input.View()
+		} else if m.status != "" {
+			view += "\n" + statusStyle.Render(m.status)
+		} else {
+			view += "\n" + statusStyle.Render(m.help.View(m.keys))
+		}
+
+		if m.split {
+			return m.splitView(view)
+		}
+		return view
 	}
 
 	if m.quitting {
-		return strings.Join(m.history, "\n")
+		return ""
 	}
 
+	if m.split {
+		return m.splitView(m.previewView())
+	}
 	return "\n" + m.list.View()
 }
 
@@ -315,7 +793,12 @@ func NewModel(width uint, height uint) Model {
 		height = 20
 	}
 
-	items := []list.Item{}
+	revisions, err := docsite.ParseRevisions(docs.Revisions)
+	if err != nil {
+		revisions = map[string]docsite.Revision{}
+	}
+
+	docItems := []item{}
 
 	fs.WalkDir(docs.Docs, ".", func(path string, d fs.DirEntry, err error) error {
 		if d.IsDir() {
@@ -334,30 +817,40 @@ func NewModel(width uint, height uint) Model {
 			}
 
 			dat, err := docs.Docs.ReadFile(path)
-			var content, snippet string
+			var content string
 			if dat != nil {
 				content = string(dat)
-				snipLength := 60
-				if len(content) < snipLength {
-					snippet = content
-				} else {
-					snippet = strings.ReplaceAll(content, "\n", " ")[:snipLength] + "..."
-				}
 			}
 
-			items = append(items, item{
-				title:    path,
-				revision: &version.Short,
+			revision := version.Short
+			if rev, ok := revisions[path]; ok {
+				revision = rev.Revision
+			}
+
+			docItems = append(docItems, item{
+				title:    docsite.Title(dat, path),
+				path:     path,
+				revision: &revision,
 				origin:   OriginEmbedded,
-				snippet:  &snippet,
 				content:  &content,
+				words:    docsite.WordCount(dat),
 				err:      err,
 			})
 		}
 		return nil
 	})
 
-	l := list.New(items, list.NewDefaultDelegate(), int(width), int(height))
+	m := Model{categories: groupItems(docItems)}
+	items := m.treeItems()
+
+	delegate := list.NewDefaultDelegate()
+	delegate.Styles.SelectedTitle = delegate.Styles.SelectedTitle.
+		Foreground(currentTheme.Primary()).
+		BorderForeground(currentTheme.Primary()).
+		Border(currentTheme.BorderStyle(), false, false, false, true)
+	delegate.Styles.SelectedDesc = delegate.Styles.SelectedTitle
+
+	l := list.New(items, delegate, int(width), int(height))
 	l.Title = fmt.Sprintf("Multiband Embedded Documentation Browser %s, compiled %s", version.Short, version.BuiltAt().Format(time.RFC3339))
 	l.SetShowStatusBar(true)
 	l.SetFilteringEnabled(true)
@@ -366,7 +859,11 @@ func NewModel(width uint, height uint) Model {
 	l.Styles.HelpStyle = helpStyle
 
 	l.SetWidth(int(width))
-	l.SetHeight(int(height))
+	// the list is drawn below a blank line
+	l.SetHeight(int(height) - 1)
+
+	input := textinput.New()
+	input.Prompt = "/"
 
 	vp := viewport.New(int(width), int(height-(uint(headerStyle.GetHeight()))))
 	vp.Style = lipgloss.NewStyle()
@@ -374,11 +871,85 @@ func NewModel(width uint, height uint) Model {
 	//BorderForeground(lipgloss.Color("62")).
 	//PaddingRight(2)
 
-	return Model{
-		width:    width,
-		height:   height,
-		viewport: vp,
-		list:     l,
-		history:  []string{},
+	m.width = width
+	m.height = height
+	m.viewport = vp
+	m.preview = viewport.New(vp.Width, vp.Height)
+	m.list = l
+	m.history = []string{}
+	m.linkIdx = -1
+	m.input = input
+	m.help = help.New()
+	m.help.Styles.ShortKey = m.help.Styles.ShortKey.Foreground(currentTheme.Primary())
+	m.help.Styles.FullKey = m.help.Styles.FullKey.Foreground(currentTheme.Primary())
+	m.help.Styles.ShortDesc = m.help.Styles.ShortDesc.Foreground(currentTheme.Muted())
+	m.help.Styles.FullDesc = m.help.Styles.FullDesc.Foreground(currentTheme.Muted())
+	m.SetKeyMap(keymap.Default().Docs)
+	return m
+}
+
+// SetKeyMap rebinds the browser keys, including those shown in the list help
+func (m *Model) SetKeyMap(k keymap.Docs) {
+	m.keys = k
+	if m.embedded {
+		m.embedKeys()
 	}
+	m.list.AdditionalShortHelpKeys = k.ListHelp
+	m.list.AdditionalFullHelpKeys = k.ListHelp
+	m.list.KeyMap.CursorUp = k.Up
+	m.list.KeyMap.CursorDown = k.Down
+	m.bindViewport()
+}
+
+// SetEmbedded hands quitting over to the program embedding the browser
+func (m *Model) SetEmbedded() {
+	m.embedded = true
+	m.embedKeys()
+	m.list.DisableQuitKeybindings()
+}
+
+func (m *Model) closePage() {
+	m.rememberPosition()
+	m.choice = ""
+	m.back, m.forward = nil, nil
+}
+
+// embedKeys has quit close the page, leaving ctrl+c to the program around
+func (m *Model) embedKeys() {
+	keys := slices.DeleteFunc(slices.Clone(m.keys.Quit.Keys()), func(k string) bool { return k == "ctrl+c" })
+	m.keys.Quit.SetKeys(keys...)
+	m.keys.Quit.SetHelp(m.keys.Quit.Help().Key, "close")
+	m.keys.Quit.SetEnabled(len(keys) > 0)
+}
+
+// SetOutput has links copied to the clipboard of the terminal on w, the
+// program's output. remote browsers, eg. in sessions over SSH, copy links
+// rather than open them on this machine.
+func (m *Model) SetOutput(w io.Writer, remote bool) {
+	m.out = w
+	m.remote = remote
+}
+
+func (m Model) output() io.Writer {
+	if m.out == nil {
+		return os.Stdout
+	}
+	return m.out
+}
+
+// Bindings are the keys the browser acts on, for an embedding program to
+// leave to it
+func (m Model) Bindings() []key.Binding {
+	return slices.Concat(append(m.keys.FullHelp(), m.keys.ListHelp())...)
+}
+
+// Capturing reports whether keys are going to a text input or overlay, and
+// should not be intercepted by an embedding program
+func (m Model) Capturing() bool {
+	return m.searching || m.showTOC || m.list.FilterState() == list.Filtering
+}
+
+func (m *Model) bindViewport() {
+	m.viewport.KeyMap.Up = m.keys.Up
+	m.viewport.KeyMap.Down = m.keys.Down
 }
@@ -0,0 +1,78 @@
+package docs
+
+import (
+	"encoding/json"
+	"flag"
+	"path/filepath"
+	"testing"
+
+	"codeberg.org/splitringresonator/multiband/internal/cli/golden"
+	"codeberg.org/splitringresonator/multiband/internal/cli/theme"
+	"codeberg.org/splitringresonator/multiband/internal/version"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the frames drawn")
+
+// drawSameFrames has frames drawn the same whatever the terminal, version
+// or user running the tests
+func drawSameFrames(t *testing.T) {
+	profile, short := lipgloss.ColorProfile(), version.Short
+	t.Cleanup(func() {
+		lipgloss.SetColorProfile(profile)
+		version.Short = short
+	})
+	lipgloss.SetColorProfile(termenv.Ascii)
+	version.Short = "golden"
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	th := theme.Default
+	th.Glamour = json.RawMessage(`"dark"`)
+	SetTheme(th)
+}
+
+func TestGolden(t *testing.T) {
+	drawSameFrames(t)
+	for _, tc := range []struct {
+		name string
+		play func() *golden.Driver
+	}{
+		{"docs-list-pager-esc", func() *golden.Driver {
+			return golden.New(NewModel(0, 0), 80, 24).
+				Snapshot("list").
+				Type("j", "enter").
+				Snapshot("pager").
+				Type("ctrl+f").
+				Snapshot("half page down").
+				Type("esc").
+				Snapshot("back to list")
+		}},
+		{"docs-filter", func() *golden.Driver {
+			return golden.New(NewModel(0, 0), 80, 24).
+				Type("/", "getting").
+				Snapshot("filtering").
+				Type("enter").
+				Snapshot("filtered").
+				Type("esc").
+				Snapshot("filter cleared")
+		}},
+		{"docs-resize", func() *golden.Driver {
+			return golden.New(NewModel(0, 0), 80, 24).
+				Type("j", "enter").
+				Resize(140, 30).
+				Snapshot("split at 140x30").
+				Resize(60, 20).
+				Snapshot("narrow at 60x20").
+				Type("esc").
+				Resize(140, 30).
+				Snapshot("list split at 140x30")
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join("testdata", tc.name+".golden")
+			if err := golden.Compare(path, tc.play().Golden(), *update); err != nil {
+				t.Errorf("%v\nrun go test -update to accept the new frames", err)
+			}
+		})
+	}
+}
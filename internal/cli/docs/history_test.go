@@ -0,0 +1,43 @@
+package docs
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	m := NewModel(80, 24)
+	pages := []string{"recipe/getting-started.md", "architecture/overview.md", "architecture/api.md"}
+	for _, p := range pages {
+		if err := m.open(p, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := func(choice string, back, forward []string) {
+		t.Helper()
+		if m.choice != choice || !slices.Equal(m.back, back) || !slices.Equal(m.forward, forward) {
+			t.Fatalf("on %s, back %q, forward %q; want %s, %q, %q", m.choice, m.back, m.forward, choice, back, forward)
+		}
+	}
+	want(pages[2], pages[:2], nil)
+
+	m.goBack()
+	want(pages[1], pages[:1], pages[2:])
+	m.goForward()
+	want(pages[2], pages[:2], []string{})
+
+	// a page that no longer opens leaves the history as it was
+	m.back = append(m.back, "gone.md")
+	m.goBack()
+	want(pages[2], append(slices.Clone(pages[:2]), "gone.md"), []string{})
+	if m.status == "" {
+		t.Errorf("no status for the page that did not open")
+	}
+
+	m.back = pages[:2]
+	m.goBack()
+	m.forward = append(m.forward, "gone.md")
+	m.goForward()
+	want(pages[1], pages[:1], []string{pages[2], "gone.md"})
+}
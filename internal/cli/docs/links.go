@@ -0,0 +1,145 @@
+package docs
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/aymanbagabas/go-osc52/v2"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// private use runes bracketing the selected link while glamour renders
+	// it, swapped for reverse video afterwards
+	markStart = "\uE000"
+	markEnd   = "\uE001"
+)
+
+var (
+	mdLinkRe   = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)(?:\s+"[^"]*")?\)`)
+	fenceRe    = regexp.MustCompile("(?m)^\\s*```")
+	reverseOn  = "\x1b[7m"
+	reverseOff = "\x1b[27m"
+)
+
+type link struct {
+	text, dest string
+	// start and end are byte offsets of the label within the raw document
+	start, end int
+}
+
+// external reports whether the link leaves the embedded docs
+func (l link) external() bool {
+	u, err := url.Parse(l.dest)
+	return err != nil || u.Scheme != "" || u.Host != ""
+}
+
+// parseLinks finds inline markdown links outside of fenced code blocks
+func parseLinks(raw string) []link {
+	fenced := make([]bool, len(raw)+1)
+	inFence := false
+	last := 0
+	for _, loc := range fenceRe.FindAllStringIndex(raw, -1) {
+		for i := last; i < loc[0]; i++ {
+			fenced[i] = inFence
+		}
+		inFence = !inFence
+		last = loc[0]
+	}
+	for i := last; i < len(raw); i++ {
+		fenced[i] = inFence
+	}
+
+	links := []link{}
+	for _, m := range mdLinkRe.FindAllStringSubmatchIndex(raw, -1) {
+		if fenced[m[0]] {
+			continue
+		}
+		links = append(links, link{
+			text:  raw[m[2]:m[3]],
+			dest:  raw[m[4]:m[5]],
+			start: m[2],
+			end:   m[3],
+		})
+	}
+	return links
+}
+
+// markLink brackets the label of l in raw so it can be found after rendering
+func markLink(raw string, l link) string {
+	return raw[:l.start] + markStart + raw[l.start:l.end] + markEnd + raw[l.end:]
+}
+
+// highlightMarks swaps the markers for reverse video, returning the line the
+// mark starts on, or -1 if it was not found
+func highlightMarks(rendered string) (string, int) {
+	line := -1
+	if i := strings.Index(rendered, markStart); i >= 0 {
+		line = strings.Count(rendered[:i], "\n")
+	}
+	rendered = strings.ReplaceAll(rendered, markStart, reverseOn)
+	rendered = strings.ReplaceAll(rendered, markEnd, reverseOff)
+	return rendered, line
+}
+
+// resolveLink maps a relative link in the document at from onto a path
+// within docs.Docs, dropping any fragment
+func resolveLink(from, dest string) (string, bool) {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "" || u.Host != "" || !strings.HasSuffix(u.Path, ".md") {
+		return "", false
+	}
+	p := u.Path
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(path.Dir(from), p)
+	}
+	p = strings.TrimPrefix(path.Clean(p), "/")
+	if strings.HasPrefix(p, "../") {
+		return "", false
+	}
+	return p, true
+}
+
+type statusMsg string
+
+// openURL hands an external link to the operating system. When that is not
+// possible, eg. over ssh, the link is copied to the clipboard of the
+// terminal on out instead.
+func openURL(out io.Writer, remote bool, u string) tea.Cmd {
+	return func() tea.Msg {
+		if remote {
+			return copyURL(out, u)()
+		}
+		var c *exec.Cmd
+		switch runtime.GOOS {
+		case "darwin":
+			c = exec.Command("open", u)
+		case "windows":
+			c = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+		default:
+			c = exec.Command("xdg-open", u)
+		}
+		if os.Getenv("SSH_TTY") != "" || c.Start() != nil {
+			return copyURL(out, u)()
+		}
+		go c.Wait() //nolint:errcheck
+		return statusMsg(fmt.Sprintf("opened %s", u))
+	}
+}
+
+// copyURL places u on the clipboard of the terminal on out, using OSC52
+func copyURL(out io.Writer, u string) tea.Cmd {
+	return func() tea.Msg {
+		if _, err := osc52.New(u).WriteTo(out); err != nil {
+			return statusMsg(err.Error())
+		}
+		return statusMsg(fmt.Sprintf("copied %s", u))
+	}
+}
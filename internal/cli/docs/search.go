@@ -0,0 +1,184 @@
+package docs
+
+import (
+	"bufio"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+const (
+	matchOn  = "\x1b[30;43m"
+	matchOff = "\x1b[39;49m"
+)
+
+// match is an occurrence of the search query in the rendered page, with the
+// column range given in terminal cells
+type match struct {
+	line       int
+	start, end int
+}
+
+// findMatches searches the plain (ANSI stripped) lines of a rendered page,
+// case insensitively. Lines are compared rune by rune rather than lowercased
+// whole, as lowercasing can change their length in bytes.
+func findMatches(plain []string, query string) []match {
+	if query == "" {
+		return nil
+	}
+	n := utf8.RuneCountInString(query)
+
+	matches := []match{}
+	for ln, line := range plain {
+		// the byte offset of each rune, and of the end of the line
+		offsets := []int{}
+		for i := range line {
+			offsets = append(offsets, i)
+		}
+		offsets = append(offsets, len(line))
+
+		for r := 0; r+n < len(offsets); {
+			from, to := offsets[r], offsets[r+n]
+			if !strings.EqualFold(line[from:to], query) {
+				r++
+				continue
+			}
+			start := ansi.StringWidth(line[:from])
+			matches = append(matches, match{
+				line:  ln,
+				start: start,
+				end:   start + ansi.StringWidth(line[from:to]),
+			})
+			r += n
+		}
+	}
+	return matches
+}
+
+// highlightMatches wraps each match in the rendered lines with highlight
+// sequences, leaving the existing styling in place
+func highlightMatches(rendered string, matches []match) string {
+	if len(matches) == 0 {
+		return rendered
+	}
+
+	lines := strings.Split(rendered, "\n")
+	byLine := map[int][]match{}
+	for _, mt := range matches {
+		byLine[mt.line] = append(byLine[mt.line], mt)
+	}
+	for ln, mts := range byLine {
+		if ln >= len(lines) {
+			continue
+		}
+		inserts := map[int]string{}
+		for _, mt := range mts {
+			inserts[mt.start] += matchOn
+			inserts[mt.end] = matchOff + inserts[mt.end]
+		}
+		lines[ln] = insertAtCells(lines[ln], inserts)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// insertAtCells inserts strings before the given cell columns of s, skipping
+// over escape sequences so they are never split
+func insertAtCells(s string, inserts map[int]string) string {
+	var b strings.Builder
+	col := 0
+	for i := 0; i < len(s); {
+		if s[i] == '\x1b' {
+			n := escapeLen(s[i:])
+			b.WriteString(s[i : i+n])
+			i += n
+			continue
+		}
+		if ins, ok := inserts[col]; ok {
+			b.WriteString(ins)
+			delete(inserts, col)
+		}
+		cluster, _, width, _ := ansi.FirstGraphemeCluster(s[i:], -1)
+		b.WriteString(cluster)
+		col += width
+		i += len(cluster)
+	}
+	for _, ins := range inserts {
+		b.WriteString(ins)
+	}
+	return b.String()
+}
+
+// escapeLen returns the length of the escape sequence at the start of s
+func escapeLen(s string) int {
+	if len(s) < 2 {
+		return len(s)
+	}
+	switch s[1] {
+	case '[':
+		// CSI, terminated by a byte in 0x40-0x7e
+		for i := 2; i < len(s); i++ {
+			if s[i] >= 0x40 && s[i] <= 0x7e {
+				return i + 1
+			}
+		}
+	case ']':
+		// OSC, terminated by BEL or ST
+		for i := 2; i < len(s); i++ {
+			if s[i] == '\a' {
+				return i + 1
+			}
+			if s[i] == '\x1b' && i+1 < len(s) && s[i+1] == '\\' {
+				return i + 2
+			}
+		}
+	default:
+		return 2
+	}
+	return len(s)
+}
+
+type heading struct {
+	level int
+	text  string
+	// line within the rendered page, or -1 if it could not be located
+	line int
+}
+
+// findHeadings lists the markdown headings of raw, locating each in the
+// plain rendered lines. Headings are searched for in order, so repeated
+// titles resolve to successive occurrences.
+func findHeadings(raw string, plain []string) []heading {
+	headings := []heading{}
+	fenced := false
+	s := bufio.NewScanner(strings.NewReader(raw))
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			fenced = !fenced
+			continue
+		}
+		if fenced || !strings.HasPrefix(line, "#") {
+			continue
+		}
+		level := len(line) - len(strings.TrimLeft(line, "#"))
+		text := strings.TrimSpace(strings.Trim(line, "#"))
+		if level > 6 || text == "" {
+			continue
+		}
+		headings = append(headings, heading{level: level, text: text, line: -1})
+	}
+
+	from := 0
+	for i, h := range headings {
+		needle := strings.ToLower(strings.ReplaceAll(h.text, "`", ""))
+		for ln := from; ln < len(plain); ln++ {
+			if strings.Contains(strings.ToLower(plain[ln]), needle) {
+				headings[i].line = ln
+				from = ln + 1
+				break
+			}
+		}
+	}
+	return headings
+}
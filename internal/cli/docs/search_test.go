@@ -0,0 +1,42 @@
+package docs
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFindMatches(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		lines []string
+		query string
+		want  []match
+	}{
+		{"ascii", []string{"Hello hello", "nothing"}, "HELLO", []match{{0, 0, 5}, {0, 6, 11}}},
+		{"empty query", []string{"anything"}, "", nil},
+		// İ is two bytes, but lowercases to three
+		{"dotted capital I", []string{"İİİİ x"}, "x", []match{{0, 5, 6}}},
+		{"cyrillic", []string{"Нужна ПОМОЩЬ, помощь"}, "помощь", []match{{0, 6, 12}, {0, 14, 20}}},
+		{"wide runes", []string{"地図 map 地図"}, "地図", []match{{0, 0, 4}, {0, 9, 13}}},
+		// final sigma folds to sigma
+		{"greek sigma", []string{"ΟΔΟΣ οδος"}, "οδοσ", []match{{0, 0, 4}, {0, 5, 9}}},
+		{"no overlap", []string{"aaaa"}, "aa", []match{{0, 0, 2}, {0, 2, 4}}},
+		// the stray byte takes no cell
+		{"invalid utf-8", []string{"a\xffb x"}, "x", []match{{0, 3, 4}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := findMatches(tc.lines, tc.query)
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("findMatches(%q, %q) = %v, want %v", tc.lines, tc.query, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHighlightNonASCII(t *testing.T) {
+	lines := []string{"İİİİ x"}
+	got := highlightMatches(lines[0], findMatches(lines, "x"))
+	if want := "İİİİ " + matchOn + "x" + matchOff; got != want {
+		t.Errorf("highlightMatches = %q, want %q", got, want)
+	}
+}
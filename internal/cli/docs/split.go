@@ -0,0 +1,79 @@
+package docs
+
+import (
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	// splitMinWidth is the narrowest terminal that gets the two pane layout
+	splitMinWidth = 120
+	// splitGutter is the border and padding between the panes
+	splitGutter = 2
+)
+
+// paneStyle separates the panes, set by SetTheme
+var paneStyle lipgloss.Style
+
+// listWidth is how much of the terminal the document list takes
+func (m Model) listWidth() int {
+	if !m.split {
+		return int(m.width)
+	}
+	return min(50, int(m.width)*2/5)
+}
+
+// paneWidth is the width available to rendered documents
+func (m Model) paneWidth() int {
+	if !m.split {
+		return int(m.width)
+	}
+	return int(m.width) - m.listWidth() - splitGutter
+}
+
+// updatePreview renders the highlighted document into the preview pane,
+// when it has changed since the last call
+func (m *Model) updatePreview() {
+	if !m.split {
+		return
+	}
+
+	i, ok := m.list.SelectedItem().(item)
+	if !ok {
+		m.previewPath = ""
+		m.preview.SetContent("")
+		return
+	}
+	if i.path == m.previewPath || i.content == nil {
+		return
+	}
+
+	m.previewPath = i.path
+	str, err := m.render(*i.content, i.path)
+	if err != nil {
+		str = errorTextStyle.Render(err.Error())
+	}
+	m.preview.SetContent(str)
+	m.preview.GotoTop()
+}
+
+func (m Model) previewView() string {
+	header := headerStyle.Render("> " + m.previewPath)
+	if m.previewPath == "" {
+		header = headerStyle.Render("> select a document")
+	}
+	return header + "\n" + m.preview.View()
+}
+
+// splitView joins the list and the right hand pane, which shows the open
+// document when the pager has focus and a preview otherwise
+func (m Model) splitView(right string) string {
+	left := lipgloss.NewStyle().
+		Width(m.listWidth()).
+		MaxHeight(int(m.height)).
+		Render("\n" + m.list.View())
+	right = paneStyle.
+		Width(m.paneWidth() + paneStyle.GetPaddingLeft()).
+		MaxHeight(int(m.height)).
+		Render(right)
+	return lipgloss.JoinHorizontal(lipgloss.Top, left, right)
+}
@@ -0,0 +1,164 @@
+package docs
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/charmbracelet/bubbles/list"
+)
+
+// historyLimit caps how many opened pages are kept across sessions
+const historyLimit = 100
+
+// State is what the browser remembers between sessions
+type State struct {
+	// Positions is the scroll offset each document was left at
+	Positions map[string]int `json:"positions"`
+	Bookmarks []string       `json:"bookmarks"`
+	// History lists opened documents, oldest first
+	History []string `json:"history"`
+}
+
+// Last is the most recently opened document, if any
+func (s State) Last() string {
+	if len(s.History) == 0 {
+		return ""
+	}
+	return s.History[len(s.History)-1]
+}
+
+func (s State) bookmarked(path string) bool {
+	return slices.Contains(s.Bookmarks, path)
+}
+
+// StatePath is where the browser state is kept by default, under
+// $XDG_STATE_HOME or ~/.local/state
+func StatePath() (string, error) {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "multiband", "docs.json"), nil
+}
+
+// LoadState reads the state file at path. A missing file is an empty state.
+func LoadState(path string) (State, error) {
+	s := State{Positions: map[string]int{}}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return s, err
+	}
+	if s.Positions == nil {
+		s.Positions = map[string]int{}
+	}
+	return s, nil
+}
+
+// Save writes the state to path, replacing the previous file atomically
+func (s State) Save(path string) error {
+	if len(s.History) > historyLimit {
+		s.History = s.History[len(s.History)-historyLimit:]
+	}
+	raw, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".docs-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+	if _, err := tmp.Write(append(raw, '\n')); err != nil {
+		tmp.Close() //nolint:errcheck
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// UseState loads the state kept at path, so bookmarks are listed and
+// positions restored, and saved again by SaveState
+func (m *Model) UseState(path string) error {
+	s, err := LoadState(path)
+	if err != nil {
+		return err
+	}
+	m.state = s
+	m.statePath = path
+	m.list.SetItems(m.treeItems())
+	return nil
+}
+
+// Resume reopens the last document of the previous session
+func (m *Model) Resume() error {
+	last := m.state.Last()
+	if last == "" {
+		return nil
+	}
+	return m.open(last, false)
+}
+
+// SaveState records the session history and writes the state back, when one
+// was loaded with UseState
+func (m Model) SaveState() error {
+	if m.statePath == "" {
+		return nil
+	}
+	m.rememberPosition()
+	m.state.History = append(m.state.History, m.history...)
+	return m.state.Save(m.statePath)
+}
+
+// rememberPosition notes how far the open document was scrolled
+func (m *Model) rememberPosition() {
+	if m.choice == "" || m.state.Positions == nil {
+		return
+	}
+	m.state.Positions[m.choice] = m.viewport.YOffset
+}
+
+// toggleBookmark adds or removes path from the bookmarks
+func (m *Model) toggleBookmark(path string) {
+	if i := slices.Index(m.state.Bookmarks, path); i >= 0 {
+		m.state.Bookmarks = slices.Delete(m.state.Bookmarks, i, i+1)
+		m.status = "removed bookmark " + path
+	} else {
+		m.state.Bookmarks = append(m.state.Bookmarks, path)
+		m.status = "bookmarked " + path
+	}
+	if m.list.FilterState() != list.Unfiltered {
+		return
+	}
+
+	// keep the same row selected as bookmarks come and go above it
+	selected, _ := m.list.SelectedItem().(item)
+	idx := m.list.Index()
+	m.list.SetItems(m.treeItems())
+	for i, li := range m.list.Items() {
+		if d, ok := li.(item); ok && d.path == selected.path && d.depth == selected.depth {
+			idx = i
+			break
+		}
+	}
+	m.list.Select(min(idx, len(m.list.Items())-1))
+}
@@ -0,0 +1,119 @@
+package docs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+)
+
+// category groups documents by their top level directory in the docs tree
+type category struct {
+	name      string
+	docs      []item
+	collapsed bool
+}
+
+// categoryItem is the list row for a category, toggled open and closed
+type categoryItem struct {
+	index     int
+	name      string
+	count     int
+	collapsed bool
+}
+
+// FilterValue is empty, since categories drop out of the list while filtering
+func (c categoryItem) FilterValue() string { return "" }
+
+func (c categoryItem) Title() string {
+	marker := "▾"
+	if c.collapsed {
+		marker = "▸"
+	}
+	return fmt.Sprintf("%s %s", marker, c.name)
+}
+
+func (c categoryItem) Description() string {
+	if c.count == 1 {
+		return "1 document"
+	}
+	return fmt.Sprintf("%d documents", c.count)
+}
+
+// groupItems buckets documents into categories, preserving their order
+func groupItems(items []item) []category {
+	categories := []category{}
+	for _, i := range items {
+		name := "docs"
+		if dir, _, ok := strings.Cut(i.path, "/"); ok {
+			name = dir
+		}
+		if len(categories) == 0 || categories[len(categories)-1].name != name {
+			categories = append(categories, category{name: name})
+		}
+		c := &categories[len(categories)-1]
+		c.docs = append(c.docs, i)
+	}
+	return categories
+}
+
+// treeItems lays the bookmarks and then the categories out as list rows,
+// omitting the documents of collapsed categories
+func (m *Model) treeItems() []list.Item {
+	items := []list.Item{}
+	for _, b := range m.state.Bookmarks {
+		if d, ok := m.document(b); ok {
+			d.bookmarked = true
+			items = append(items, d)
+		}
+	}
+	for ci, c := range m.categories {
+		items = append(items, categoryItem{index: ci, name: c.name, count: len(c.docs), collapsed: c.collapsed})
+		if c.collapsed {
+			continue
+		}
+		for _, d := range c.docs {
+			d.depth = 1
+			d.bookmarked = m.state.bookmarked(d.path)
+			items = append(items, d)
+		}
+	}
+	return items
+}
+
+// flatItems lists every document regardless of collapsed categories, so
+// filtering searches them all
+func (m *Model) flatItems() []list.Item {
+	items := []list.Item{}
+	for _, c := range m.categories {
+		for _, d := range c.docs {
+			d.bookmarked = m.state.bookmarked(d.path)
+			items = append(items, d)
+		}
+	}
+	return items
+}
+
+// toggleCategory collapses or expands category ci, keeping it selected
+func (m *Model) toggleCategory(ci int) {
+	m.categories[ci].collapsed = !m.categories[ci].collapsed
+	m.list.SetItems(m.treeItems())
+	for idx, li := range m.list.Items() {
+		if c, ok := li.(categoryItem); ok && c.index == ci {
+			m.list.Select(idx)
+			break
+		}
+	}
+}
+
+// document looks up a document by path across all categories
+func (m *Model) document(path string) (item, bool) {
+	for _, c := range m.categories {
+		for _, d := range c.docs {
+			if d.path == path {
+				return d, true
+			}
+		}
+	}
+	return item{}, false
+}
@@ -0,0 +1,234 @@
+// Package golden drives Bubble Tea models without a terminal, capturing
+// frames for tests to compare against golden files
+package golden
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Skipped are the commands never run, by the function building them: those
+// waiting for time to pass, whose messages would otherwise turn up or not
+// depending on how busy the machine is
+var Skipped = []string{
+	"github.com/charmbracelet/bubbletea.Tick.",
+	"github.com/charmbracelet/bubbletea.Every.",
+	"github.com/charmbracelet/bubbles/cursor.(*Model).BlinkCmd.",
+}
+
+// CmdTimeout bounds how long any other command may run for. One still
+// running by then waits on something, and should be skipped.
+const CmdTimeout = 10 * time.Second
+
+// maxDepth stops commands answering each other forever
+const maxDepth = 16
+
+var ErrMismatch = errors.New("frames differ from golden file")
+
+type Frame struct {
+	Label string
+	View  string
+}
+
+// Driver feeds messages to a model the way the runtime would, running the
+// commands it returns and feeding their messages back in turn
+type Driver struct {
+	model  tea.Model
+	skip   []string
+	frames []Frame
+	quit   bool
+}
+
+// New starts m in a terminal of the given size. skip names the model's own
+// commands waiting on something, like reads from feeds, by the function
+// building them, to skip along with the Skipped ones.
+func New(m tea.Model, width, height int, skip ...string) *Driver {
+	d := &Driver{model: m, skip: append(slices.Clone(Skipped), skip...)}
+	d.run(m.Init(), 0)
+	return d.Send(tea.WindowSizeMsg{Width: width, Height: height})
+}
+
+func (d *Driver) Model() tea.Model { return d.model }
+
+// Quit reports whether the model asked to quit
+func (d *Driver) Quit() bool { return d.quit }
+
+// Send delivers msgs in order, and everything they lead to
+func (d *Driver) Send(msgs ...tea.Msg) *Driver {
+	for _, msg := range msgs {
+		d.update(msg, 0)
+	}
+	return d
+}
+
+// Type presses keys by name, eg. "j", "enter", "ctrl+c" or "alt+enter".
+// Names that are not keys are typed a rune at a time.
+func (d *Driver) Type(keys ...string) *Driver {
+	for _, k := range keys {
+		for _, msg := range Keys(k) {
+			d.update(msg, 0)
+		}
+	}
+	return d
+}
+
+func (d *Driver) Resize(width, height int) *Driver {
+	return d.Send(tea.WindowSizeMsg{Width: width, Height: height})
+}
+
+// Snapshot records the current frame under label
+func (d *Driver) Snapshot(label string) *Driver {
+	d.frames = append(d.frames, Frame{Label: label, View: normalize(d.model.View())})
+	return d
+}
+
+func (d *Driver) Frames() []Frame { return d.frames }
+
+// Golden is every frame recorded, as written to golden files
+func (d *Driver) Golden() []byte {
+	var b bytes.Buffer
+	for _, f := range d.frames {
+		fmt.Fprintf(&b, "-- %s --\n%s\n", f.Label, f.View)
+	}
+	return b.Bytes()
+}
+
+func (d *Driver) update(msg tea.Msg, depth int) {
+	if d.quit || msg == nil {
+		return
+	}
+	switch msg := msg.(type) {
+	case tea.QuitMsg:
+		d.quit = true
+		return
+	case tea.BatchMsg:
+		for _, cmd := range msg {
+			d.run(cmd, depth)
+		}
+		return
+	}
+
+	var cmd tea.Cmd
+	d.model, cmd = d.model.Update(msg)
+	d.run(cmd, depth)
+}
+
+func (d *Driver) run(cmd tea.Cmd, depth int) {
+	if cmd == nil || depth >= maxDepth {
+		return
+	}
+	name := runtime.FuncForPC(reflect.ValueOf(cmd).Pointer()).Name()
+	for _, prefix := range d.skip {
+		if strings.HasPrefix(name, prefix) {
+			return
+		}
+	}
+
+	done := make(chan tea.Msg, 1)
+	go func() { done <- cmd() }()
+	select {
+	case msg := <-done:
+		d.update(msg, depth+1)
+	case <-time.After(CmdTimeout):
+		panic(fmt.Sprintf("golden: %s still running after %s, skip it", name, CmdTimeout))
+	}
+}
+
+// normalize drops styling and trailing space, which vary with the terminal
+// and are invisible anyway
+func normalize(view string) string {
+	lines := strings.Split(ansi.Strip(view), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+var keyTypes = map[string]tea.KeyType{
+	"enter":     tea.KeyEnter,
+	"esc":       tea.KeyEscape,
+	"tab":       tea.KeyTab,
+	"shift+tab": tea.KeyShiftTab,
+	"backspace": tea.KeyBackspace,
+	"delete":    tea.KeyDelete,
+	"space":     tea.KeySpace,
+	"up":        tea.KeyUp,
+	"down":      tea.KeyDown,
+	"left":      tea.KeyLeft,
+	"right":     tea.KeyRight,
+	"home":      tea.KeyHome,
+	"end":       tea.KeyEnd,
+	"pgup":      tea.KeyPgUp,
+	"pgdown":    tea.KeyPgDown,
+	"ctrl+b":    tea.KeyCtrlB,
+	"ctrl+c":    tea.KeyCtrlC,
+	"ctrl+f":    tea.KeyCtrlF,
+	"ctrl+j":    tea.KeyCtrlJ,
+	"ctrl+k":    tea.KeyCtrlK,
+	"ctrl+n":    tea.KeyCtrlN,
+	"ctrl+p":    tea.KeyCtrlP,
+}
+
+// Keys is the key presses for a key name, or for typing text
+func Keys(name string) []tea.KeyMsg {
+	alt := false
+	if rest, ok := strings.CutPrefix(name, "alt+"); ok && len(rest) > 0 {
+		alt, name = true, rest
+	}
+	if t, ok := keyTypes[name]; ok {
+		if t == tea.KeySpace {
+			return []tea.KeyMsg{{Type: t, Runes: []rune{' '}, Alt: alt}}
+		}
+		return []tea.KeyMsg{{Type: t, Alt: alt}}
+	}
+	msgs := []tea.KeyMsg{}
+	for _, r := range name {
+		msgs = append(msgs, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}, Alt: alt})
+	}
+	return msgs
+}
+
+// Compare checks got against the golden file at path, or replaces the file
+// with it when update is set
+func Compare(path string, got []byte, update bool) error {
+	if update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(path, got, 0o644)
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(got, want) {
+		return nil
+	}
+
+	g, w := strings.Split(string(got), "\n"), strings.Split(string(want), "\n")
+	for i := 0; i < max(len(g), len(w)); i++ {
+		gl, wl := "", ""
+		if i < len(g) {
+			gl = g[i]
+		}
+		if i < len(w) {
+			wl = w[i]
+		}
+		if gl != wl {
+			return fmt.Errorf("%s:%d: %w\n  want %q\n   got %q", path, i+1, ErrMismatch, wl, gl)
+		}
+	}
+	return fmt.Errorf("%s: %w", path, ErrMismatch)
+}
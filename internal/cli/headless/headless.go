@@ -0,0 +1,412 @@
+// Package headless drives the console over a line protocol, for scripts,
+// expect and serial consoles without terminal capabilities.
+//
+// Every line read is a command. Its output is zero or more tab separated
+// lines followed by "ok", or a single "error: " line. Events are written as
+// JSON objects on lines of their own whenever they happen, so a line
+// starting with "{" is always an event.
+package headless
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"codeberg.org/splitringresonator/multiband/internal/chat"
+	"codeberg.org/splitringresonator/multiband/internal/config"
+	"codeberg.org/splitringresonator/multiband/internal/link"
+)
+
+// Usage lists the commands, as printed by help
+const Usage = `whoami                          the identity in use
+ls conversations                peer, name, unread, last message
+ls messages @peer               id, time, direction, status, network, body
+ls interfaces                   name, kind, state, packets in, packets out
+ls networks                     networks messages can be sent over
+ls reloads                      time, trigger, changes, error of the reloads so far
+send @peer [via network] text   queue a message, answering its id
+read @peer                      mark a conversation read
+up interface                    bring an interface up
+down interface                  take an interface down
+reload                          read the config file again, answering the changes
+help                            this list
+quit                            leave`
+
+var ErrUsage = errors.New("unknown command, try help")
+
+type Config struct {
+	Identity string
+	Chat     chat.Backend
+	// Links is optional
+	Links link.Feed
+	// Reload reads the configuration again, Reloads reports every reload
+	// and Reports lists those so far, if the configuration can be reloaded
+	Reload  func() config.Report
+	Reloads <-chan config.Report
+	Reports func() []config.Report
+}
+
+// Event is a line written when something happens, rather than in answer
+// to a command
+type Event struct {
+	// Event is ready, message, status, link or config
+	Event    string    `json:"event"`
+	Time     time.Time `json:"time"`
+	Identity string    `json:"identity,omitempty"`
+
+	ID         string `json:"id,omitempty"`
+	Peer       string `json:"peer,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Body       string `json:"body,omitempty"`
+	Status     string `json:"status,omitempty"`
+	Network    string `json:"network,omitempty"`
+	Attachment string `json:"attachment,omitempty"`
+	// Trace is the compact trace of the message, if it is traced
+	Trace string `json:"trace,omitempty"`
+
+	Interface string `json:"interface,omitempty"`
+	State     string `json:"state,omitempty"`
+
+	Trigger string          `json:"trigger,omitempty"`
+	Changes []config.Change `json:"changes,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+type session struct {
+	cfg Config
+
+	mu  sync.Mutex
+	out io.Writer
+	// latest is the last sample of each interface, to report changes of state
+	latest map[string]link.Sample
+}
+
+// Run answers the commands read from in until it ends, quit is read or ctx
+// is done
+func Run(ctx context.Context, in io.Reader, out io.Writer, cfg Config) error {
+	s := &session{cfg: cfg, out: out, latest: map[string]link.Sample{}}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.watchChat(ctx)
+	if cfg.Links != nil {
+		go s.watchLinks(ctx)
+	}
+	if cfg.Reloads != nil {
+		go s.watchConfig(ctx)
+	}
+
+	s.event(Event{Event: "ready", Identity: cfg.Identity})
+
+	// the scanner is left blocked on in once the session ends, but gives
+	// up the lines read after
+	lines := make(chan string)
+	errc := make(chan error, 1)
+	go func() {
+		sc := bufio.NewScanner(in)
+		for sc.Scan() {
+			select {
+			case lines <- sc.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+		errc <- sc.Err()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errc:
+			return err
+		case line := <-lines:
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if line == "quit" || line == "exit" {
+				return nil
+			}
+			rows, err := s.command(line)
+			s.reply(rows, err)
+		}
+	}
+}
+
+func (s *session) write(lines ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range lines {
+		fmt.Fprintln(s.out, l)
+	}
+}
+
+func (s *session) reply(rows []string, err error) {
+	if err != nil {
+		// keep the reply to one line, whatever the error says
+		s.write("error: " + strings.ReplaceAll(err.Error(), "\n", " "))
+		return
+	}
+	s.write(append(rows, "ok")...)
+}
+
+func (s *session) event(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	s.write(string(raw))
+}
+
+func (s *session) watchChat(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m, ok := <-s.cfg.Chat.Updates():
+			if !ok {
+				return
+			}
+			e := Event{
+				Event:   "status",
+				Time:    m.Time,
+				ID:      m.ID,
+				Peer:    m.Peer,
+				Status:  m.Status.String(),
+				Network: m.Network,
+				Trace:   m.Trace,
+			}
+			if !m.Outgoing {
+				e.Event = "message"
+				e.Name = s.name(m.Peer)
+				e.Body = m.Body
+				e.Status = ""
+				if m.Attachment != nil {
+					e.Attachment = m.Attachment.Name
+				}
+			}
+			s.event(e)
+		}
+	}
+}
+
+func (s *session) watchLinks(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sample, ok := <-s.cfg.Links.Samples():
+			if !ok {
+				return
+			}
+			s.mu.Lock()
+			prev, seen := s.latest[sample.Interface]
+			s.latest[sample.Interface] = sample
+			s.mu.Unlock()
+			if !seen || prev.State != sample.State {
+				s.event(Event{Event: "link", Time: sample.Time, Interface: sample.Interface, State: sample.State.String()})
+			}
+		}
+	}
+}
+
+func (s *session) watchConfig(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case r, ok := <-s.cfg.Reloads:
+			if !ok {
+				return
+			}
+			s.event(Event{Event: "config", Time: r.Time, Trigger: r.Trigger, Changes: r.Changes, Error: r.Error})
+		}
+	}
+}
+
+// name is what a peer announced itself as, if anything
+func (s *session) name(peer string) string {
+	convs, err := s.cfg.Chat.Conversations()
+	if err != nil {
+		return ""
+	}
+	for _, c := range convs {
+		if c.Peer == peer {
+			return c.Name
+		}
+	}
+	return ""
+}
+
+// peer resolves @name to the address of a conversation, by name or
+// address, or takes it as the address of a new one
+func (s *session) peer(arg string) (string, error) {
+	if !strings.HasPrefix(arg, "@") || len(arg) == 1 {
+		return "", fmt.Errorf("expected @peer, got %q", arg)
+	}
+	arg = arg[1:]
+	convs, err := s.cfg.Chat.Conversations()
+	if err != nil {
+		return "", err
+	}
+	for _, c := range convs {
+		if c.Peer == arg || strings.EqualFold(c.Name, arg) {
+			return c.Peer, nil
+		}
+	}
+	return arg, nil
+}
+
+func (s *session) command(line string) ([]string, error) {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case "help":
+		return strings.Split(Usage, "\n"), nil
+	case "whoami":
+		return []string{s.cfg.Identity}, nil
+	case "ls":
+		if len(fields) < 2 {
+			return nil, errors.New("usage: ls conversations|messages|interfaces|networks|reloads")
+		}
+		return s.ls(fields[1], fields[2:])
+	case "send":
+		return s.send(line)
+	case "read":
+		if len(fields) != 2 {
+			return nil, errors.New("usage: read @peer")
+		}
+		peer, err := s.peer(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.cfg.Chat.MarkRead(peer)
+	case "reload":
+		if s.cfg.Reload == nil {
+			return nil, errors.New("no config file to reload")
+		}
+		r := s.cfg.Reload()
+		if r.Error != "" {
+			return nil, errors.New(r.Error)
+		}
+		rows := []string{}
+		for _, c := range r.Changes {
+			rows = append(rows, c.String())
+		}
+		return rows, nil
+	case "up", "down":
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("usage: %s interface", fields[0])
+		}
+		if s.cfg.Links == nil {
+			return nil, errors.New("no interfaces")
+		}
+		return nil, s.cfg.Links.SetUp(fields[1], fields[0] == "up")
+	}
+	return nil, ErrUsage
+}
+
+func (s *session) ls(what string, args []string) ([]string, error) {
+	rows := []string{}
+	switch what {
+	case "conversations":
+		convs, err := s.cfg.Chat.Conversations()
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range convs {
+			rows = append(rows, fmt.Sprintf("%s\t%s\t%d\t%s", c.Peer, oneLine(c.Name), c.Unread, c.Last.Format(time.RFC3339)))
+		}
+
+	case "messages":
+		if len(args) != 1 {
+			return nil, errors.New("usage: ls messages @peer")
+		}
+		peer, err := s.peer(args[0])
+		if err != nil {
+			return nil, err
+		}
+		msgs, err := s.cfg.Chat.Messages(peer)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			dir := "in"
+			if m.Outgoing {
+				dir = "out"
+			}
+			rows = append(rows, fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s", m.ID, m.Time.Format(time.RFC3339), dir, m.Status, m.Network, oneLine(m.Body)))
+		}
+
+	case "interfaces":
+		if s.cfg.Links == nil {
+			return rows, nil
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, i := range s.cfg.Links.Interfaces() {
+			sample, ok := s.latest[i.Name]
+			state := "unknown"
+			if ok {
+				state = sample.State.String()
+			}
+			rows = append(rows, fmt.Sprintf("%s\t%s\t%s\t%d\t%d", i.Name, i.Kind, state, sample.PacketsIn, sample.PacketsOut))
+		}
+
+	case "networks":
+		rows = append(rows, s.cfg.Chat.Networks()...)
+
+	case "reloads":
+		if s.cfg.Reports == nil {
+			return rows, nil
+		}
+		for _, r := range s.cfg.Reports() {
+			rows = append(rows, fmt.Sprintf("%s\t%s\t%d\t%s", r.Time.Format(time.RFC3339), r.Trigger, len(r.Changes), oneLine(r.Error)))
+		}
+
+	default:
+		return nil, fmt.Errorf("cannot list %q, expected conversations, messages, interfaces, networks or reloads", what)
+	}
+	return rows, nil
+}
+
+// send queues the text after "send @peer", or "send @peer via network",
+// answering with the ID status events will refer to
+func (s *session) send(line string) ([]string, error) {
+	rest := strings.TrimSpace(strings.TrimPrefix(line, "send"))
+	target, rest, _ := strings.Cut(rest, " ")
+	peer, err := s.peer(target)
+	if err != nil {
+		return nil, err
+	}
+
+	network := ""
+	rest = strings.TrimSpace(rest)
+	if after, ok := strings.CutPrefix(rest, "via "); ok {
+		network, rest, _ = strings.Cut(strings.TrimSpace(after), " ")
+	}
+	body := strings.TrimSpace(rest)
+	if body == "" {
+		return nil, errors.New("usage: send @peer [via network] text")
+	}
+
+	m, err := s.cfg.Chat.Send(chat.Message{Peer: peer, Body: body, Network: network})
+	if err != nil {
+		return nil, err
+	}
+	return []string{m.ID}, nil
+}
+
+// oneLine keeps multiline bodies to their row
+func oneLine(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\t", "\\t").Replace(s)
+}
@@ -0,0 +1,286 @@
+package headless
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"codeberg.org/splitringresonator/multiband/internal/chat"
+	"codeberg.org/splitringresonator/multiband/internal/config"
+	"codeberg.org/splitringresonator/multiband/internal/link"
+)
+
+// buffer is written by events still coming in as Run returns
+type buffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *buffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func run(t *testing.T, cfg Config, in string) []string {
+	t.Helper()
+	out := &buffer{}
+	if err := Run(context.Background(), strings.NewReader(in), out, cfg); err != nil {
+		t.Fatal(err)
+	}
+	// events come as they happen, between the answers
+	lines := []string{}
+	for _, l := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		if !strings.HasPrefix(l, "{") {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+func TestConversationNames(t *testing.T) {
+	mem := chat.NewMemory("lora")
+	mem.Receive(chat.Message{Peer: "b0b", Body: "hi"}, "Bob\tthe\nbuilder")
+	got := run(t, Config{Chat: mem}, "ls conversations\nquit\n")
+	if len(got) != 2 || got[1] != "ok" {
+		t.Fatalf("answered %q", got)
+	}
+	if fields := strings.Split(got[0], "\t"); len(fields) != 4 || fields[1] != `Bob\tthe\nbuilder` {
+		t.Errorf("conversation row %q, want the name kept to its field", got[0])
+	}
+}
+
+func TestQuit(t *testing.T) {
+	mem := chat.NewMemory("lora")
+	// nothing after quit is run
+	got := run(t, Config{Identity: "me", Chat: mem}, "whoami\nquit\nsend @bob hi\n")
+	if want := []string{"me", "ok"}; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("answered %q, want %q", got, want)
+	}
+	if convs, _ := mem.Conversations(); len(convs) != 0 {
+		t.Errorf("sent after quit: %+v", convs)
+	}
+}
+
+// console drives a session a line at a time, splitting its output into
+// answers and events
+type console struct {
+	t       *testing.T
+	in      *io.PipeWriter
+	answers chan string
+	events  chan Event
+	done    chan error
+}
+
+func start(t *testing.T, cfg Config) *console {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &console{t: t, in: inW, answers: make(chan string, 64), events: make(chan Event, 64), done: make(chan error, 1)}
+	go func() {
+		err := Run(t.Context(), inR, outW, cfg)
+		outW.Close() //nolint:errcheck
+		c.done <- err
+	}()
+	go func() {
+		sc := bufio.NewScanner(outR)
+		for sc.Scan() {
+			if !strings.HasPrefix(sc.Text(), "{") {
+				c.answers <- sc.Text()
+				continue
+			}
+			var e Event
+			if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+				t.Errorf("event %s: %v", sc.Text(), err)
+				continue
+			}
+			c.events <- e
+		}
+	}()
+	t.Cleanup(func() { inW.Close() }) //nolint:errcheck
+	c.event("ready")
+	return c
+}
+
+func (c *console) send(line string) {
+	c.t.Helper()
+	if _, err := io.WriteString(c.in, line+"\n"); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// answer is the next line that is not an event
+func (c *console) answer() string {
+	c.t.Helper()
+	select {
+	case l := <-c.answers:
+		return l
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("no answer")
+		return ""
+	}
+}
+
+// event is the next event of the kind, skipping the others
+func (c *console) event(kind string) Event {
+	c.t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-c.events:
+			if e.Event == kind {
+				return e
+			}
+		case <-timeout:
+			c.t.Fatalf("no %s event", kind)
+			return Event{}
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	mem := chat.NewMemory("lora", "tcp")
+	c := start(t, Config{Chat: mem})
+
+	c.send("send @b0b via tcp hello\tthere")
+	id := c.answer()
+	if ok := c.answer(); id == "" || ok != "ok" {
+		t.Fatalf("answered %q, %q", id, ok)
+	}
+	e := c.event("status")
+	if e.ID != id || e.Peer != "b0b" || e.Status != "queued" || e.Network != "tcp" {
+		t.Errorf("status event %+v, want %s queued over tcp", e, id)
+	}
+
+	// the id answered is the one later events refer to
+	if err := mem.SetStatus(id, chat.Acked); err != nil {
+		t.Fatal(err)
+	}
+	if e := c.event("status"); e.ID != id || e.Status != "acked" {
+		t.Errorf("status event %+v, want %s acked", e, id)
+	}
+	msgs, _ := mem.Messages("b0b")
+	if len(msgs) != 1 || msgs[0].Body != "hello\tthere" {
+		t.Errorf("sent %+v", msgs)
+	}
+
+	for _, line := range []string{"send @b0b via ham hello", "send @b0b", "send b0b hello"} {
+		c.send(line)
+		if got := c.answer(); !strings.HasPrefix(got, "error: ") {
+			t.Errorf("%s: answered %q, want an error", line, got)
+		}
+	}
+}
+
+// fakeFeed hands out the samples sent on its channel
+type fakeFeed struct {
+	interfaces []link.Interface
+	samples    chan link.Sample
+}
+
+func (f fakeFeed) Interfaces() []link.Interface     { return f.interfaces }
+func (f fakeFeed) Samples() <-chan link.Sample      { return f.samples }
+func (f fakeFeed) SetUp(name string, up bool) error { return nil }
+
+func TestLsInterfaces(t *testing.T) {
+	f := fakeFeed{
+		interfaces: []link.Interface{{Name: "lora0", Kind: "lora"}, {Name: "tcp0", Kind: "tcp"}},
+		samples:    make(chan link.Sample),
+	}
+	c := start(t, Config{Chat: chat.NewMemory("lora"), Links: f})
+
+	f.samples <- link.Sample{Interface: "lora0", State: link.Up, PacketsIn: 3, PacketsOut: 1}
+	if e := c.event("link"); e.Interface != "lora0" || e.State != "up" {
+		t.Errorf("link event %+v, want lora0 up", e)
+	}
+
+	c.send("ls interfaces")
+	// interfaces not heard from yet are listed, in an unknown state
+	want := []string{"lora0\tlora\tup\t3\t1", "tcp0\ttcp\tunknown\t0\t0", "ok"}
+	for _, w := range want {
+		if got := c.answer(); got != w {
+			t.Errorf("answered %q, want %q", got, w)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		reload func() config.Report
+		want   []string
+	}{
+		{name: "no config file", want: []string{"error: no config file to reload"}},
+		{name: "nothing changed", reload: func() config.Report { return config.Report{} }, want: []string{"ok"}},
+		{
+			name: "changed",
+			reload: func() config.Report {
+				return config.Report{Changes: []config.Change{
+					{Setting: "interfaces.lora0", Action: config.Changed, Detail: "spreading_factor 9 → 10"},
+					{Setting: "docs.listen", Action: config.Changed, Restart: true},
+				}}
+			},
+			want: []string{"interfaces.lora0 changed: spreading_factor 9 → 10", "docs.listen changed (takes a restart)", "ok"},
+		},
+		{
+			name:   "rejected",
+			reload: func() config.Report { return config.Report{Error: "multiband.yaml:3:5: bad\nspreading_factor"} },
+			want:   []string{"error: multiband.yaml:3:5: bad spreading_factor"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := run(t, Config{Chat: chat.NewMemory("lora"), Reload: tc.reload}, "reload\n")
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				t.Errorf("answered %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	got := run(t, Config{Chat: chat.NewMemory("lora")}, "frobnicate\nls widgets\nwhoami\n")
+	if len(got) != 4 {
+		t.Fatalf("answered %q", got)
+	}
+	if got[0] != "error: "+ErrUsage.Error() {
+		t.Errorf("answered %q to an unknown command", got[0])
+	}
+	if !strings.HasPrefix(got[1], "error: ") {
+		t.Errorf("answered %q to an unknown listing", got[1])
+	}
+	// the session goes on after either
+	if got[3] != "ok" {
+		t.Errorf("answered %q after the errors", got[2:])
+	}
+}
+
+func TestEOF(t *testing.T) {
+	c := start(t, Config{Identity: "me", Chat: chat.NewMemory("lora")})
+	c.send("whoami")
+	if got := c.answer(); got != "me" {
+		t.Errorf("answered %q", got)
+	}
+	c.answer()
+
+	c.in.Close() //nolint:errcheck
+	select {
+	case err := <-c.done:
+		if err != nil {
+			t.Errorf("ended with %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("still running after its input ended")
+	}
+}
@@ -0,0 +1,361 @@
+// Package keymap holds the key bindings of the terminal interfaces, which
+// can be remapped from a JSON file
+package keymap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+)
+
+// Filename is the keymap looked for in the config directory
+const Filename = "keys.json"
+
+// Docs binds the actions of the docs browser
+type Docs struct {
+	Open      key.Binding
+	Toggle    key.Binding
+	Close     key.Binding
+	Back      key.Binding
+	Forward   key.Binding
+	NextLink  key.Binding
+	PrevLink  key.Binding
+	CopyLink  key.Binding
+	Search    key.Binding
+	NextMatch key.Binding
+	PrevMatch key.Binding
+	TOC       key.Binding
+	Bookmark  key.Binding
+	Up        key.Binding
+	Down      key.Binding
+	HalfDown  key.Binding
+	HalfUp    key.Binding
+	Help      key.Binding
+	Quit      key.Binding
+}
+
+// TUI binds the actions of the operator console. Screens see every key the
+// console does not take for itself.
+type TUI struct {
+	NextScreen key.Binding
+	PrevScreen key.Binding
+	// GotoScreen jumps straight to a screen by its number in the tab bar
+	GotoScreen key.Binding
+	Palette    key.Binding
+	Up         key.Binding
+	Down       key.Binding
+	Select     key.Binding
+	Cancel     key.Binding
+	Help       key.Binding
+	Quit       key.Binding
+}
+
+// Chat binds the actions of the console's messages screen. Up, Down and
+// Compose work the conversation list, and Leave, Send and Newline the
+// composer once it has focus.
+type Chat struct {
+	Up         key.Binding
+	Down       key.Binding
+	Compose    key.Binding
+	Leave      key.Binding
+	Send       key.Binding
+	Newline    key.Binding
+	ScrollUp   key.Binding
+	ScrollDown key.Binding
+}
+
+// Interfaces binds the actions of the console's interfaces screen
+type Interfaces struct {
+	Up      key.Binding
+	Down    key.Binding
+	Toggle  key.Binding
+	Details key.Binding
+	Close   key.Binding
+}
+
+// Alerts binds the actions of the console's alert history screen
+type Alerts struct {
+	Up     key.Binding
+	Down   key.Binding
+	Reload key.Binding
+	Clear  key.Binding
+}
+
+// Logs binds the actions of the console's log screen
+type Logs struct {
+	Up     key.Binding
+	Down   key.Binding
+	Level  key.Binding
+	Bottom key.Binding
+}
+
+// KeyMap is every binding, grouped by interface
+type KeyMap struct {
+	Docs       Docs
+	TUI        TUI
+	Chat       Chat
+	Interfaces Interfaces
+	Alerts     Alerts
+	Logs       Logs
+}
+
+func Default() KeyMap {
+	return KeyMap{
+		Docs: Docs{
+			Open:      key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "open/follow link")),
+			Toggle:    key.NewBinding(key.WithKeys(" "), key.WithHelp("space", "fold category")),
+			Close:     key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "close")),
+			Back:      key.NewBinding(key.WithKeys("backspace", "alt+left"), key.WithHelp("backspace", "back")),
+			Forward:   key.NewBinding(key.WithKeys("alt+right"), key.WithHelp("alt+→", "forward")),
+			NextLink:  key.NewBinding(key.WithKeys("tab"), key.WithHelp("tab", "next link")),
+			PrevLink:  key.NewBinding(key.WithKeys("shift+tab"), key.WithHelp("shift+tab", "prev link")),
+			CopyLink:  key.NewBinding(key.WithKeys("y"), key.WithHelp("y", "copy link")),
+			Search:    key.NewBinding(key.WithKeys("/"), key.WithHelp("/", "search")),
+			NextMatch: key.NewBinding(key.WithKeys("n"), key.WithHelp("n", "next match")),
+			PrevMatch: key.NewBinding(key.WithKeys("N"), key.WithHelp("N", "prev match")),
+			TOC:       key.NewBinding(key.WithKeys("t"), key.WithHelp("t", "contents")),
+			Bookmark:  key.NewBinding(key.WithKeys("m"), key.WithHelp("m", "bookmark")),
+			Up:        key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "up")),
+			Down:      key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "down")),
+			HalfDown:  key.NewBinding(key.WithKeys("ctrl+f"), key.WithHelp("ctrl+f", "½ page down")),
+			HalfUp:    key.NewBinding(key.WithKeys("ctrl+b"), key.WithHelp("ctrl+b", "½ page up")),
+			Help:      key.NewBinding(key.WithKeys("?"), key.WithHelp("?", "more")),
+			Quit:      key.NewBinding(key.WithKeys("q", "ctrl+c"), key.WithHelp("q", "quit")),
+		},
+		TUI: TUI{
+			NextScreen: key.NewBinding(key.WithKeys("]"), key.WithHelp("]", "next screen")),
+			PrevScreen: key.NewBinding(key.WithKeys("["), key.WithHelp("[", "prev screen")),
+			GotoScreen: key.NewBinding(key.WithKeys("1", "2", "3", "4", "5", "6", "7", "8", "9"), key.WithHelp("1-9", "go to screen")),
+			Palette:    key.NewBinding(key.WithKeys("ctrl+k", ":"), key.WithHelp(":", "commands")),
+			Up:         key.NewBinding(key.WithKeys("up", "ctrl+p"), key.WithHelp("↑", "up")),
+			Down:       key.NewBinding(key.WithKeys("down", "ctrl+n"), key.WithHelp("↓", "down")),
+			Select:     key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "run")),
+			Cancel:     key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "close")),
+			Help:       key.NewBinding(key.WithKeys("?"), key.WithHelp("?", "more")),
+			Quit:       key.NewBinding(key.WithKeys("q", "ctrl+c"), key.WithHelp("q", "quit")),
+		},
+		Chat: Chat{
+			Up:         key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "up")),
+			Down:       key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "down")),
+			Compose:    key.NewBinding(key.WithKeys("tab", "enter"), key.WithHelp("tab", "compose")),
+			Leave:      key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "conversations")),
+			Send:       key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "send")),
+			Newline:    key.NewBinding(key.WithKeys("alt+enter", "ctrl+j"), key.WithHelp("alt+enter", "newline")),
+			ScrollUp:   key.NewBinding(key.WithKeys("pgup"), key.WithHelp("pgup", "older")),
+			ScrollDown: key.NewBinding(key.WithKeys("pgdown"), key.WithHelp("pgdown", "newer")),
+		},
+		Interfaces: Interfaces{
+			Up:      key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "up")),
+			Down:    key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "down")),
+			Toggle:  key.NewBinding(key.WithKeys("u"), key.WithHelp("u", "up/down")),
+			Details: key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "config")),
+			Close:   key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "close")),
+		},
+		Alerts: Alerts{
+			Up:     key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "up")),
+			Down:   key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "down")),
+			Reload: key.NewBinding(key.WithKeys("r"), key.WithHelp("r", "reload rules")),
+			Clear:  key.NewBinding(key.WithKeys("x"), key.WithHelp("x", "clear")),
+		},
+		Logs: Logs{
+			Up:     key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "up")),
+			Down:   key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "down")),
+			Level:  key.NewBinding(key.WithKeys("l"), key.WithHelp("l", "level")),
+			Bottom: key.NewBinding(key.WithKeys("G", "end"), key.WithHelp("G", "follow")),
+		},
+	}
+}
+
+// ShortHelp is shown under the pager
+func (k Docs) ShortHelp() []key.Binding {
+	return []key.Binding{k.NextLink, k.Open, k.Back, k.Search, k.TOC, k.Close, k.Help}
+}
+
+func (k Docs) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Up, k.Down, k.HalfDown, k.HalfUp},
+		{k.NextLink, k.PrevLink, k.Open, k.CopyLink},
+		{k.Back, k.Forward, k.Close, k.Bookmark},
+		{k.Search, k.NextMatch, k.PrevMatch, k.TOC},
+		{k.Help, k.Quit},
+	}
+}
+
+// ListHelp are the bindings the document list adds to its own help
+func (k Docs) ListHelp() []key.Binding {
+	return []key.Binding{k.Open, k.Toggle, k.Bookmark}
+}
+
+func (k TUI) ShortHelp() []key.Binding {
+	return []key.Binding{k.NextScreen, k.PrevScreen, k.Palette, k.Quit, k.Help}
+}
+
+func (k TUI) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.NextScreen, k.PrevScreen, k.GotoScreen},
+		{k.Palette, k.Up, k.Down, k.Select, k.Cancel},
+		{k.Help, k.Quit},
+	}
+}
+
+func (k Chat) ShortHelp() []key.Binding {
+	return []key.Binding{k.Up, k.Down, k.Compose, k.Send, k.Newline, k.Leave, k.ScrollUp}
+}
+
+func (k Chat) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Up, k.Down, k.Compose, k.Leave},
+		{k.Send, k.Newline, k.ScrollUp, k.ScrollDown},
+	}
+}
+
+func (k Interfaces) ShortHelp() []key.Binding {
+	return []key.Binding{k.Up, k.Down, k.Toggle, k.Details, k.Close}
+}
+
+func (k Interfaces) FullHelp() [][]key.Binding {
+	return [][]key.Binding{k.ShortHelp()}
+}
+
+func (k Alerts) ShortHelp() []key.Binding {
+	return []key.Binding{k.Up, k.Down, k.Reload, k.Clear}
+}
+
+func (k Alerts) FullHelp() [][]key.Binding {
+	return [][]key.Binding{k.ShortHelp()}
+}
+
+func (k Logs) ShortHelp() []key.Binding {
+	return []key.Binding{k.Up, k.Down, k.Level, k.Bottom}
+}
+
+func (k Logs) FullHelp() [][]key.Binding {
+	return [][]key.Binding{k.ShortHelp()}
+}
+
+// bindings names every binding as it appears in the keymap file
+func (k *KeyMap) bindings() map[string]map[string]*key.Binding {
+	d, t, c, i, a, l := &k.Docs, &k.TUI, &k.Chat, &k.Interfaces, &k.Alerts, &k.Logs
+	return map[string]map[string]*key.Binding{
+		"docs": {
+			"open":       &d.Open,
+			"toggle":     &d.Toggle,
+			"close":      &d.Close,
+			"back":       &d.Back,
+			"forward":    &d.Forward,
+			"next_link":  &d.NextLink,
+			"prev_link":  &d.PrevLink,
+			"copy_link":  &d.CopyLink,
+			"search":     &d.Search,
+			"next_match": &d.NextMatch,
+			"prev_match": &d.PrevMatch,
+			"toc":        &d.TOC,
+			"bookmark":   &d.Bookmark,
+			"up":         &d.Up,
+			"down":       &d.Down,
+			"half_down":  &d.HalfDown,
+			"half_up":    &d.HalfUp,
+			"help":       &d.Help,
+			"quit":       &d.Quit,
+		},
+		"tui": {
+			"next_screen": &t.NextScreen,
+			"prev_screen": &t.PrevScreen,
+			"goto_screen": &t.GotoScreen,
+			"palette":     &t.Palette,
+			"up":          &t.Up,
+			"down":        &t.Down,
+			"select":      &t.Select,
+			"cancel":      &t.Cancel,
+			"help":        &t.Help,
+			"quit":        &t.Quit,
+		},
+		"chat": {
+			"up":          &c.Up,
+			"down":        &c.Down,
+			"compose":     &c.Compose,
+			"leave":       &c.Leave,
+			"send":        &c.Send,
+			"newline":     &c.Newline,
+			"scroll_up":   &c.ScrollUp,
+			"scroll_down": &c.ScrollDown,
+		},
+		"interfaces": {
+			"up":      &i.Up,
+			"down":    &i.Down,
+			"toggle":  &i.Toggle,
+			"details": &i.Details,
+			"close":   &i.Close,
+		},
+		"alerts": {
+			"up":     &a.Up,
+			"down":   &a.Down,
+			"reload": &a.Reload,
+			"clear":  &a.Clear,
+		},
+		"logs": {
+			"up":     &l.Up,
+			"down":   &l.Down,
+			"level":  &l.Level,
+			"bottom": &l.Bottom,
+		},
+	}
+}
+
+// Load reads the keymap file in configDir over the defaults. The file maps
+// actions to keys, eg. {"docs": {"search": ["/", "ctrl+s"]}}, and a missing
+// file leaves the defaults as they are.
+func Load(configDir string) (KeyMap, error) {
+	k := Default()
+	if configDir == "" {
+		return k, nil
+	}
+
+	path := filepath.Join(configDir, Filename)
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return k, nil
+	}
+	if err != nil {
+		return k, err
+	}
+
+	file := map[string]map[string][]string{}
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return k, fmt.Errorf("%s: %w", path, err)
+	}
+
+	all := k.bindings()
+	for section, actions := range file {
+		bindings, ok := all[section]
+		if !ok {
+			return k, fmt.Errorf("%s: unknown section %q", path, section)
+		}
+		for action, keys := range actions {
+			b, ok := bindings[action]
+			if !ok {
+				return k, fmt.Errorf("%s: unknown %s action %q, expected one of %s", path, section, action, strings.Join(names(bindings), ", "))
+			}
+			b.SetKeys(keys...)
+			b.SetHelp(strings.Join(keys, "/"), b.Help().Desc)
+			b.SetEnabled(len(keys) > 0)
+		}
+	}
+	return k, nil
+}
+
+func names(bindings map[string]*key.Binding) []string {
+	n := []string{}
+	for name := range bindings {
+		n = append(n, name)
+	}
+	slices.Sort(n)
+	return n
+}
@@ -0,0 +1,52 @@
+package keymap
+
+import (
+	"slices"
+	"testing"
+)
+
+// modes splits sections whose bindings are not all live at once, naming
+// the actions of each mode. Bindings in different modes may share keys.
+var modes = map[string][][]string{
+	"chat": {
+		{"up", "down", "compose", "scroll_up", "scroll_down"},
+		{"leave", "send", "newline", "scroll_up", "scroll_down"},
+	},
+}
+
+func TestNoSharedKeys(t *testing.T) {
+	k := Default()
+	for section, bindings := range k.bindings() {
+		scopes, ok := modes[section]
+		if !ok {
+			scopes = [][]string{names(bindings)}
+		}
+		for _, scope := range scopes {
+			taken := map[string]string{}
+			for _, action := range scope {
+				b, ok := bindings[action]
+				if !ok {
+					t.Fatalf("%s has no action %q", section, action)
+				}
+				for _, key := range b.Keys() {
+					if other, ok := taken[key]; ok {
+						t.Errorf("%s: %q is bound to both %s and %s", section, key, other, action)
+					}
+					taken[key] = action
+				}
+			}
+		}
+	}
+}
+
+func TestModesCoverSection(t *testing.T) {
+	k := Default()
+	all := k.bindings()
+	for section, scopes := range modes {
+		for _, action := range names(all[section]) {
+			if !slices.ContainsFunc(scopes, func(scope []string) bool { return slices.Contains(scope, action) }) {
+				t.Errorf("%s %s is in no mode", section, action)
+			}
+		}
+	}
+}
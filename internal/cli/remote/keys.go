@@ -0,0 +1,112 @@
+package remote
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// LoadHostKey reads the server's private key from path, generating an
+// ed25519 key there on first use
+func LoadHostKey(path string) (ssh.Signer, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		raw, err = generateHostKey(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return signer, nil
+}
+
+func generateHostKey(path string) ([]byte, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "multiband host key")
+	if err != nil {
+		return nil, err
+	}
+	raw := pem.EncodeToMemory(block)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// AuthorizedKey is who logs in with a key
+type AuthorizedKey struct {
+	Identity string
+	// Named is whether an identity= option gave the identity, which must
+	// then be one of the node's
+	Named bool
+}
+
+// LoadAuthorizedKeys reads an authorized_keys file, mapping the SHA256
+// fingerprint of each key to the identity its operator uses. The identity
+// is given by an identity="name" option, naming one of the node's
+// identities, or else the key's comment, or else the fingerprint itself:
+//
+//	identity="field-team" ssh-ed25519 AAAA... alice@laptop
+func LoadAuthorizedKeys(path string) (map[string]AuthorizedKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]AuthorizedKey{}
+	for len(bytes.TrimSpace(raw)) > 0 {
+		key, comment, options, rest, err := ssh.ParseAuthorizedKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		raw = rest
+
+		fp := ssh.FingerprintSHA256(key)
+		k := AuthorizedKey{Identity: comment}
+		for _, o := range options {
+			if v, ok := strings.CutPrefix(o, "identity="); ok {
+				k = AuthorizedKey{Identity: strings.Trim(v, `"`), Named: true}
+			}
+		}
+		if k.Identity == "" {
+			k.Identity = fp
+		}
+		keys[fp] = k
+	}
+	return keys, nil
+}
+
+// CheckIdentities reports the keys naming identities the node does not have
+func CheckIdentities(keys map[string]AuthorizedKey, identities []string) error {
+	unknown := []string{}
+	for _, k := range keys {
+		if k.Named && !slices.Contains(identities, k.Identity) {
+			unknown = append(unknown, k.Identity)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	slices.Sort(unknown)
+	return fmt.Errorf("%w: %s", ErrUnknownIdentity, strings.Join(slices.Compact(unknown), ", "))
+}
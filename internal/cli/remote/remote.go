@@ -0,0 +1,295 @@
+// Package remote hosts the console over SSH, so operators can attach to a
+// node without installing anything. Every session runs its own console,
+// sized from the PTY the client asked for. Sessions without a PTY, like
+// `ssh -T`, speak the headless line protocol instead.
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"codeberg.org/splitringresonator/multiband/internal/chat"
+	"codeberg.org/splitringresonator/multiband/internal/cli/headless"
+	"codeberg.org/splitringresonator/multiband/internal/cli/tui"
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/crypto/ssh"
+)
+
+// HandshakeTimeout is how long clients have to log in, by default
+const HandshakeTimeout = 30 * time.Second
+
+var (
+	ErrUnauthorized    = errors.New("key not in authorized_keys")
+	ErrUnknownIdentity = errors.New("no such identity")
+)
+
+type Config struct {
+	HostKey ssh.Signer
+	// AuthorizedKeys is read on every login, so keys can be added and
+	// revoked without a restart
+	AuthorizedKeys string
+	// Identities are the node's. Keys naming any other are refused.
+	Identities []string
+	// HandshakeTimeout is how long clients have to log in, HandshakeTimeout
+	// if zero
+	HandshakeTimeout time.Duration
+	// Env builds the console of a session for identity. ctx is done when
+	// the session ends.
+	Env    func(ctx context.Context, identity string) tui.Env
+	Logger *slog.Logger
+}
+
+type Server struct {
+	cfg Config
+	ssh *ssh.ServerConfig
+	// model is the console of a session
+	model func(tui.Env) tea.Model
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+func NewServer(cfg Config) *Server {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(slog.DiscardHandler)
+	}
+	if cfg.HandshakeTimeout == 0 {
+		cfg.HandshakeTimeout = HandshakeTimeout
+	}
+	s := &Server{
+		cfg:   cfg,
+		model: func(env tui.Env) tea.Model { return tui.NewModel(env) },
+		conns: map[net.Conn]struct{}{},
+	}
+	s.ssh = &ssh.ServerConfig{
+		PublicKeyCallback: s.authorize,
+	}
+	s.ssh.AddHostKey(cfg.HostKey)
+	return s
+}
+
+func (s *Server) authorize(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	keys, err := LoadAuthorizedKeys(s.cfg.AuthorizedKeys)
+	if err != nil {
+		s.cfg.Logger.Warn("refusing login", "remote", meta.RemoteAddr(), "err", err)
+		return nil, err
+	}
+	k, ok := keys[ssh.FingerprintSHA256(key)]
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+	if k.Named && !slices.Contains(s.cfg.Identities, k.Identity) {
+		s.cfg.Logger.Warn("refusing login", "remote", meta.RemoteAddr(), "identity", k.Identity, "err", ErrUnknownIdentity)
+		return nil, ErrUnknownIdentity
+	}
+	return &ssh.Permissions{Extensions: map[string]string{"identity": k.Identity}}, nil
+}
+
+// Serve accepts sessions on l until ctx is done, then ends every session
+// and waits for them to close
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		l.Close() //nolint:errcheck
+		s.mu.Lock()
+		for c := range s.conns {
+			c.Close() //nolint:errcheck
+		}
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.wg.Wait()
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(ctx, conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close() //nolint:errcheck
+		}()
+	}
+}
+
+func (s *Server) handle(ctx context.Context, conn net.Conn) {
+	// clients that never finish logging in would hold the connection open
+	conn.SetDeadline(time.Now().Add(s.cfg.HandshakeTimeout)) //nolint:errcheck
+	sc, chans, reqs, err := ssh.NewServerConn(conn, s.ssh)
+	if err != nil {
+		s.cfg.Logger.Info("handshake failed", "remote", conn.RemoteAddr(), "err", err)
+		return
+	}
+	conn.SetDeadline(time.Time{}) //nolint:errcheck
+
+	defer sc.Close() //nolint:errcheck
+	go ssh.DiscardRequests(reqs)
+
+	identity := sc.Permissions.Extensions["identity"]
+	logger := s.cfg.Logger.With("identity", identity)
+	logger.Info("connected", "remote", sc.RemoteAddr())
+	defer logger.Info("disconnected")
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "only sessions are served") //nolint:errcheck
+			continue
+		}
+		ch, requests, err := nc.Accept()
+		if err != nil {
+			logger.Error("accepting session", "err", err)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.session(ctx, ch, requests, identity)
+		}()
+	}
+}
+
+// ptyRequest is the payload of a pty-req, RFC 4254 section 6.2
+type ptyRequest struct {
+	Term          string
+	Columns, Rows uint32
+	Width, Height uint32
+	Modes         string
+}
+
+// windowChange is the payload of a window-change, RFC 4254 section 6.7
+type windowChange struct {
+	Columns, Rows uint32
+	Width, Height uint32
+}
+
+func (s *Server) session(ctx context.Context, ch ssh.Channel, requests <-chan *ssh.Request, identity string) {
+	defer ch.Close() //nolint:errcheck
+	logger := s.cfg.Logger.With("identity", identity)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		pty     *ptyRequest
+		started bool
+		program *tea.Program
+		done    = make(chan error, 1)
+	)
+	for {
+		select {
+		case err := <-done:
+			status := struct{ Status uint32 }{}
+			if err != nil {
+				logger.Error("session failed", "err", err)
+				status.Status = 1
+			}
+			ch.SendRequest("exit-status", false, ssh.Marshal(status)) //nolint:errcheck
+			return
+
+		case req, ok := <-requests:
+			if !ok {
+				// the client went away, so stop the session and let it save
+				cancel()
+				if started {
+					<-done
+				}
+				return
+			}
+			switch req.Type {
+			case "pty-req":
+				pty = &ptyRequest{}
+				if err := ssh.Unmarshal(req.Payload, pty); err != nil {
+					req.Reply(false, nil) //nolint:errcheck
+					continue
+				}
+				req.Reply(true, nil) //nolint:errcheck
+
+			case "window-change":
+				size := windowChange{}
+				if err := ssh.Unmarshal(req.Payload, &size); err == nil && program != nil {
+					go program.Send(tea.WindowSizeMsg{Width: int(size.Columns), Height: int(size.Rows)})
+				}
+
+			case "shell":
+				if started {
+					req.Reply(false, nil) //nolint:errcheck
+					continue
+				}
+				req.Reply(true, nil) //nolint:errcheck
+				started = true
+				env := s.cfg.Env(ctx, identity)
+
+				if pty == nil {
+					// no terminal to draw on, so speak the line protocol
+					if env.Chat == nil {
+						env.Chat = chat.NewMemory()
+					}
+					go func() {
+						done <- headless.Run(ctx, ch, ch, headless.Config{
+							Identity: env.Identity,
+							Chat:     env.Chat,
+							Links:    env.Links,
+							Reload:   env.Reload,
+							Reloads:  env.Reloads,
+							Reports:  env.Reports,
+						})
+					}()
+					continue
+				}
+
+				if env.Terminal == nil {
+					env.Terminal = ch
+				}
+				env.Remote = true
+				program = tea.NewProgram(s.model(env),
+					tea.WithInput(ch),
+					tea.WithOutput(ch),
+					tea.WithAltScreen(),
+					tea.WithoutSignalHandler(),
+					tea.WithContext(ctx),
+				)
+				p, size := program, tea.WindowSizeMsg{Width: int(pty.Columns), Height: int(pty.Rows)}
+				go p.Send(size)
+				go func() {
+					final, err := p.Run()
+					if m, ok := final.(tui.Model); ok {
+						if cerr := m.Close(); cerr != nil {
+							logger.Error("closing console", "err", cerr)
+						}
+					}
+					if errors.Is(err, tea.ErrProgramKilled) && ctx.Err() != nil {
+						err = nil
+					}
+					done <- err
+				}()
+
+			case "env":
+				req.Reply(true, nil) //nolint:errcheck
+
+			default:
+				// exec, subsystems and the like
+				req.Reply(false, []byte(fmt.Sprintf("%s is not supported", req.Type))) //nolint:errcheck
+			}
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"codeberg.org/splitringresonator/multiband/internal/chat"
+	"codeberg.org/splitringresonator/multiband/internal/cli/tui"
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/crypto/ssh"
+)
+
+// wait bounds how long a test waits on the server
+const wait = 5 * time.Second
+
+func signer(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func authorizedLine(options string, s ssh.Signer, comment string) string {
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(s.PublicKey())))
+	if options != "" {
+		line = options + " " + line
+	}
+	if comment != "" {
+		line += " " + comment
+	}
+	return line + "\n"
+}
+
+// sizeModel draws the size of the terminal it was given, in place of the
+// console
+type sizeModel struct{ width, height int }
+
+func (m sizeModel) Init() tea.Cmd { return nil }
+
+func (m sizeModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if size, ok := msg.(tea.WindowSizeMsg); ok {
+		m.width, m.height = size.Width, size.Height
+	}
+	return m, nil
+}
+
+func (m sizeModel) View() string { return fmt.Sprintf("size %dx%d", m.width, m.height) }
+
+type fixture struct {
+	addr string
+	host ssh.Signer
+	// team logs in as the node's identity, bob by the key's comment, ghost
+	// names an identity the node does not have and stranger is not listed
+	team, bob, ghost, stranger ssh.Signer
+}
+
+func serve(t *testing.T, cfg Config) *fixture {
+	t.Helper()
+	f := &fixture{host: signer(t), team: signer(t), bob: signer(t), ghost: signer(t), stranger: signer(t)}
+
+	path := filepath.Join(t.TempDir(), "authorized_keys")
+	keys := authorizedLine(`identity="field-team"`, f.team, "alice@laptop") +
+		authorizedLine("", f.bob, "bob@laptop") +
+		authorizedLine(`identity="ghost"`, f.ghost, "")
+	if err := os.WriteFile(path, []byte(keys), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.HostKey = f.host
+	cfg.AuthorizedKeys = path
+	cfg.Identities = []string{"field-team"}
+	cfg.Env = func(ctx context.Context, identity string) tui.Env {
+		return tui.Env{Identity: identity, Chat: chat.NewMemory()}
+	}
+	srv := NewServer(cfg)
+	srv.model = func(tui.Env) tea.Model { return sizeModel{} }
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.addr = l.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ctx, l) }()
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case err := <-served:
+			if err != nil {
+				t.Errorf("Serve: %v", err)
+			}
+		case <-time.After(wait):
+			t.Errorf("Serve did not return")
+		}
+	})
+	return f
+}
+
+func (f *fixture) dial(key ssh.Signer) (*ssh.Client, error) {
+	return ssh.Dial("tcp", f.addr, &ssh.ClientConfig{
+		User:            "operator",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(key)},
+		HostKeyCallback: ssh.FixedHostKey(f.host.PublicKey()),
+		Timeout:         wait,
+	})
+}
+
+// buffer collects what a session writes, for the test to wait on
+type buffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *buffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *buffer) waitFor(t *testing.T, want string) {
+	t.Helper()
+	deadline := time.Now().Add(wait)
+	for !strings.Contains(b.String(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("no %q in %q", want, b.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// shell runs a session without a PTY, writing in to it, and returns what
+// it wrote back
+func shell(t *testing.T, session *ssh.Session, in string) string {
+	t.Helper()
+	out := &buffer{}
+	session.Stdin = strings.NewReader(in)
+	session.Stdout = out
+	if err := session.Shell(); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Wait(); err != nil {
+		t.Fatalf("headless session: %v\n%s", err, out)
+	}
+	return out.String()
+}
+
+// whoami logs in with key and asks the line protocol who it is
+func (f *fixture) whoami(t *testing.T, key ssh.Signer) string {
+	t.Helper()
+	client, err := f.dial(key)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	defer client.Close() //nolint:errcheck
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := shell(t, session, "whoami\nquit\n")
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], `{"event":"ready"`) || lines[2] != "ok" {
+		t.Fatalf("whoami answered %q", out)
+	}
+	return lines[1]
+}
+
+func TestAuth(t *testing.T) {
+	f := serve(t, Config{})
+
+	if got := f.whoami(t, f.team); got != "field-team" {
+		t.Errorf("identity= key logged in as %q, want field-team", got)
+	}
+	if got := f.whoami(t, f.bob); got != "bob@laptop" {
+		t.Errorf("commented key logged in as %q, want bob@laptop", got)
+	}
+
+	for name, key := range map[string]ssh.Signer{"ghost": f.ghost, "stranger": f.stranger} {
+		if client, err := f.dial(key); err == nil {
+			client.Close() //nolint:errcheck
+			t.Errorf("%s logged in", name)
+		}
+	}
+}
+
+func TestPTY(t *testing.T) {
+	f := serve(t, Config{})
+	client, err := f.dial(f.team)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close() //nolint:errcheck
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &buffer{}
+	session.Stdout = out
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close() //nolint:errcheck
+
+	if err := session.RequestPty("xterm-256color", 30, 100, ssh.TerminalModes{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Shell(); err != nil {
+		t.Fatal(err)
+	}
+	out.waitFor(t, "size 100x30")
+
+	if err := session.WindowChange(40, 120); err != nil {
+		t.Fatal(err)
+	}
+	out.waitFor(t, "size 120x40")
+
+	// leaving ends the console on the server
+	session.Close() //nolint:errcheck
+}
+
+func TestHeadless(t *testing.T) {
+	f := serve(t, Config{})
+	client, err := f.dial(f.team)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close() //nolint:errcheck
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := shell(t, session, "send @bob hello\nls conversations\nnonsense\nquit\n")
+	for _, want := range []string{"\nok\n", "bob\t", "error: "} {
+		if !strings.Contains(out, want) {
+			t.Errorf("no %q in %q", want, out)
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	f := serve(t, Config{})
+	client, err := f.dial(f.team)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close() //nolint:errcheck
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close() //nolint:errcheck
+	if err := session.Run("uptime"); err == nil {
+		t.Errorf("exec ran")
+	}
+	if _, _, err := client.OpenChannel("direct-tcpip", nil); err == nil {
+		t.Errorf("port forwarding opened")
+	}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	f := serve(t, Config{HandshakeTimeout: 100 * time.Millisecond})
+	conn, err := net.Dial("tcp", f.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() //nolint:errcheck
+
+	// say nothing, and expect to be hung up on
+	conn.SetReadDeadline(time.Now().Add(wait)) //nolint:errcheck
+	_, err = io.Copy(io.Discard, conn)
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		t.Errorf("connection still open after %s", wait)
+	}
+}
+
+func TestCheckIdentities(t *testing.T) {
+	keys := map[string]AuthorizedKey{
+		"a": {Identity: "field-team", Named: true},
+		"b": {Identity: "bob@laptop"},
+		"c": {Identity: "ghost", Named: true},
+		"d": {Identity: "ghost", Named: true},
+	}
+	err := CheckIdentities(keys, []string{"field-team"})
+	if !errors.Is(err, ErrUnknownIdentity) || !strings.HasSuffix(err.Error(), ": ghost") {
+		t.Errorf("CheckIdentities = %v, want ghost unknown", err)
+	}
+	delete(keys, "c")
+	delete(keys, "d")
+	if err := CheckIdentities(keys, []string{"field-team"}); err != nil {
+		t.Errorf("CheckIdentities = %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+// Package theme holds the colours, borders and markdown styles shared by the
+// terminal interfaces
+package theme
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/glamour/styles"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Filename is the theme looked for in the config directory
+const Filename = "theme.json"
+
+//go:embed high-contrast.json
+var highContrastGlamour []byte
+
+// Colors are lipgloss colours: ANSI numbers, or #rrggbb hex
+type Colors struct {
+	// Primary is used for titles, headers and borders
+	Primary string `json:"primary,omitempty"`
+	// Text is drawn on top of Primary
+	Text  string `json:"text,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Muted is used for secondary text, like help
+	Muted string `json:"muted,omitempty"`
+	// OK marks healthy links and delivered messages
+	OK string `json:"ok,omitempty"`
+}
+
+// Theme is read from a JSON file, where any field left out keeps the value
+// of the theme it extends
+type Theme struct {
+	Name string `json:"name,omitempty"`
+	// Extends names the built-in theme to start from, default unless set
+	Extends string `json:"extends,omitempty"`
+	Colors  Colors `json:"colors"`
+	// Border is one of normal, rounded, thick, double or hidden
+	Border string `json:"border,omitempty"`
+	// Glamour is either the name of a glamour style, eg. "dark", or a
+	// glamour style sheet inline
+	Glamour json.RawMessage `json:"glamour,omitempty"`
+}
+
+var (
+	Default = Theme{
+		Name: "default",
+		Colors: Colors{
+			Primary: "5",
+			Text:    "15",
+			Error:   "9",
+			Muted:   "241",
+			OK:      "10",
+		},
+		Border:  "normal",
+		Glamour: json.RawMessage(`"auto"`),
+	}
+	// HighContrast is for sunlit outdoor screens: bold primaries on black
+	HighContrast = Theme{
+		Name: "high-contrast",
+		Colors: Colors{
+			Primary: "11",
+			Text:    "0",
+			Error:   "9",
+			Muted:   "15",
+			OK:      "10",
+		},
+		Border:  "thick",
+		Glamour: json.RawMessage(highContrastGlamour),
+	}
+
+	Builtin = map[string]Theme{
+		Default.Name:      Default,
+		HighContrast.Name: HighContrast,
+	}
+)
+
+var borders = map[string]lipgloss.Border{
+	"normal":  lipgloss.NormalBorder(),
+	"rounded": lipgloss.RoundedBorder(),
+	"thick":   lipgloss.ThickBorder(),
+	"double":  lipgloss.DoubleBorder(),
+	"hidden":  lipgloss.HiddenBorder(),
+}
+
+// Names lists the built-in themes
+func Names() []string {
+	names := []string{}
+	for n := range Builtin {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Resolve finds a theme by built-in name or file path. With no name, the
+// theme file in configDir is used if there is one.
+func Resolve(name, configDir string) (Theme, error) {
+	if t, ok := Builtin[name]; ok {
+		return t, nil
+	}
+	if name != "" {
+		return Load(name)
+	}
+	if configDir == "" {
+		return Default, nil
+	}
+	t, err := Load(filepath.Join(configDir, Filename))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Default, nil
+	}
+	return t, err
+}
+
+// Load reads a theme file, filling in whatever it leaves out from the theme
+// it extends
+func Load(path string) (Theme, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return Theme{}, err
+	}
+
+	var t Theme
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return Theme{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	base := Default
+	if t.Extends != "" {
+		b, ok := Builtin[t.Extends]
+		if !ok {
+			return Theme{}, fmt.Errorf("%s: unknown theme %q to extend, expected one of %s", path, t.Extends, strings.Join(Names(), ", "))
+		}
+		base = b
+	}
+
+	if t.Name == "" {
+		t.Name = path
+	}
+	t.Colors.Primary = or(t.Colors.Primary, base.Colors.Primary)
+	t.Colors.Text = or(t.Colors.Text, base.Colors.Text)
+	t.Colors.Error = or(t.Colors.Error, base.Colors.Error)
+	t.Colors.Muted = or(t.Colors.Muted, base.Colors.Muted)
+	t.Colors.OK = or(t.Colors.OK, base.Colors.OK)
+	t.Border = or(t.Border, base.Border)
+	if len(t.Glamour) == 0 {
+		t.Glamour = base.Glamour
+	}
+
+	if _, ok := borders[t.Border]; !ok {
+		return Theme{}, fmt.Errorf("%s: unknown border %q", path, t.Border)
+	}
+	return t, nil
+}
+
+func or(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+// BorderStyle is the lipgloss border named by the theme
+func (t Theme) BorderStyle() lipgloss.Border {
+	if b, ok := borders[t.Border]; ok {
+		return b
+	}
+	return lipgloss.NormalBorder()
+}
+
+func (t Theme) Primary() lipgloss.Color { return lipgloss.Color(t.Colors.Primary) }
+func (t Theme) Text() lipgloss.Color    { return lipgloss.Color(t.Colors.Text) }
+func (t Theme) Error() lipgloss.Color   { return lipgloss.Color(t.Colors.Error) }
+func (t Theme) Muted() lipgloss.Color   { return lipgloss.Color(t.Colors.Muted) }
+func (t Theme) OK() lipgloss.Color      { return lipgloss.Color(t.Colors.OK) }
+
+// GlamourStyle is the renderer option for the theme's markdown style
+func (t Theme) GlamourStyle() glamour.TermRendererOption {
+	raw := bytes.TrimSpace(t.Glamour)
+	if len(raw) == 0 {
+		return glamour.WithAutoStyle()
+	}
+
+	var name string
+	if err := json.Unmarshal(raw, &name); err != nil {
+		return glamour.WithStylesFromJSONBytes(raw)
+	}
+	if name == "" || name == styles.AutoStyle {
+		return glamour.WithAutoStyle()
+	}
+	if _, ok := styles.DefaultStyles[name]; ok {
+		return glamour.WithStandardStyle(name)
+	}
+	// anything else is a path to a style sheet
+	return glamour.WithStylePath(name)
+}
@@ -0,0 +1,223 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"codeberg.org/splitringresonator/multiband/internal/alert"
+	"codeberg.org/splitringresonator/multiband/internal/cli/keymap"
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// toastFor is how long an alert stays up over the screens
+const toastFor = 6 * time.Second
+
+// alertMsg is the alerts raised by a message or sample
+type alertMsg []alert.Alert
+
+// reloadRulesMsg asks for the alert rules to be read again
+type reloadRulesMsg struct{}
+
+// toastDoneMsg takes down the toast it numbers, unless another replaced it
+type toastDoneMsg int
+
+// raise shows the last of alerts as a toast, rings the bell and runs the
+// hooks of each
+func (m *Model) raise(alerts []alert.Alert) tea.Cmd {
+	if len(alerts) == 0 {
+		return nil
+	}
+	bell := false
+	cmds := []tea.Cmd{func() tea.Msg { return alertMsg(alerts) }}
+	for _, a := range alerts {
+		bell = bell || a.Bell
+		if a.Hook != "" {
+			cmds = append(cmds, func() tea.Msg {
+				if err := alert.RunHook(context.Background(), a); err != nil {
+					return StatusMsg(err.Error())
+				}
+				return nil
+			})
+		}
+	}
+	if bell && m.env.Terminal != nil {
+		w := m.env.Terminal
+		cmds = append(cmds, func() tea.Msg {
+			w.Write([]byte("\a")) //nolint:errcheck
+			return nil
+		})
+	}
+
+	last := alerts[len(alerts)-1]
+	m.toast = &last
+	m.toasts++
+	id := m.toasts
+	cmds = append(cmds, tea.Tick(toastFor, func(time.Time) tea.Msg { return toastDoneMsg(id) }))
+	return tea.Batch(cmds...)
+}
+
+// peerName is how a peer announced itself, if it has
+func (m Model) peerName(peer string) string {
+	if m.env.Chat == nil {
+		return ""
+	}
+	convs, err := m.env.Chat.Conversations()
+	if err != nil {
+		return ""
+	}
+	for _, c := range convs {
+		if c.Peer == peer {
+			return c.Name
+		}
+	}
+	return ""
+}
+
+// toastView draws the alert shown over the screens
+func (m Model) toastView() string {
+	a := m.toast
+	width := min(48, max(16, m.width/2))
+	// long messages are cut at a few lines
+	text := strings.Split(lipgloss.NewStyle().Width(width-2).Render(a.Text), "\n")
+	if len(text) > 3 {
+		text = text[:3]
+		text[2] = ansi.Truncate(text[2], width-3, "") + "…"
+	}
+	body := cursorStyle.Render("⚠ "+a.Rule) + "\n" + strings.Join(text, "\n")
+	return toastStyle.Width(width).Render(body)
+}
+
+// overlay draws box over the top right corner of content
+func overlay(content, box string, width int) string {
+	lines := strings.Split(content, "\n")
+	boxWidth := lipgloss.Width(box)
+	for i, l := range strings.Split(box, "\n") {
+		if i >= len(lines) {
+			break
+		}
+		left := ansi.Truncate(lines[i], max(0, width-boxWidth), "")
+		lines[i] = left + strings.Repeat(" ", max(0, width-boxWidth-lipgloss.Width(left))) + l
+	}
+	return strings.Join(lines, "\n")
+}
+
+// alertScreen lists the alerts raised, most recent first
+type alertScreen struct {
+	engine *alert.Engine
+	keys   keymap.Alerts
+	help   help.Model
+
+	alerts []alert.Alert
+	idx    int
+
+	width, height int
+}
+
+func newAlertScreen(env Env) Screen {
+	h := help.New()
+	h.Styles = helpStyles
+	s := &alertScreen{engine: env.Alerts, keys: env.Keys.Alerts, help: h}
+	s.refresh()
+	return s
+}
+
+func (s *alertScreen) Title() string { return "Alerts" }
+func (s *alertScreen) Init() tea.Cmd { return nil }
+
+func (s *alertScreen) refresh() {
+	if s.engine == nil {
+		return
+	}
+	s.alerts = s.engine.History()
+	slices.Reverse(s.alerts)
+	s.idx = min(s.idx, max(0, len(s.alerts)-1))
+}
+
+// reload reads the rules again, reporting how it went in the status bar
+func (s *alertScreen) reload() tea.Cmd {
+	if s.engine == nil {
+		return nil
+	}
+	n, err := s.engine.Reload()
+	note := fmt.Sprintf("%d alert rules loaded", n)
+	if err != nil {
+		note = "keeping alert rules: " + err.Error()
+	}
+	return func() tea.Msg { return StatusMsg(note) }
+}
+
+func (s *alertScreen) Update(msg tea.Msg) (Screen, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		s.width, s.height = msg.Width, msg.Height
+		s.help.Width = msg.Width
+
+	case alertMsg:
+		// keep the same alert selected as new ones come in above it
+		if s.idx > 0 {
+			s.idx += len(msg)
+		}
+		s.refresh()
+
+	case reloadRulesMsg:
+		return s, s.reload()
+
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, s.keys.Up):
+			if s.idx > 0 {
+				s.idx--
+			}
+		case key.Matches(msg, s.keys.Down):
+			if s.idx < len(s.alerts)-1 {
+				s.idx++
+			}
+		case key.Matches(msg, s.keys.Reload):
+			return s, s.reload()
+		case key.Matches(msg, s.keys.Clear):
+			if s.engine != nil {
+				s.engine.Clear()
+			}
+			s.idx = 0
+			s.refresh()
+		}
+	}
+	return s, nil
+}
+
+func (s *alertScreen) View() string {
+	if s.engine == nil || (len(s.alerts) == 0 && len(s.engine.Rules()) == 0) {
+		return lipgloss.Place(s.width, s.height, lipgloss.Center, lipgloss.Center,
+			mutedStyle.Render("No alert rules. Add them under alerts in the config file."))
+	}
+
+	rows := []string{mutedStyle.Render(fmt.Sprintf("%d rules, %d alerts", len(s.engine.Rules()), len(s.alerts))), ""}
+	if len(s.alerts) == 0 {
+		rows = append(rows, mutedStyle.Render("  Nothing yet."))
+	}
+
+	// scroll to keep the selected alert in view
+	room := max(1, s.height-len(rows)-1)
+	first := max(0, s.idx-room+1)
+	for n := first; n < len(s.alerts) && n < first+room; n++ {
+		a := s.alerts[n]
+		text := strings.ReplaceAll(a.Text, "\n", " ")
+		row := a.Time.Format(time.TimeOnly) + "  " + cursorStyle.Render(a.Rule) + "  " + text
+		if n == s.idx {
+			row = cursorStyle.Render("› ") + row
+		} else {
+			row = "  " + row
+		}
+		rows = append(rows, ansi.Truncate(row, s.width, "…"))
+	}
+
+	body := lipgloss.NewStyle().Height(max(0, s.height-1)).MaxHeight(max(0, s.height-1)).Render(strings.Join(rows, "\n"))
+	return body + "\n" + s.help.View(s.keys)
+}
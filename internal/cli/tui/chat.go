@@ -0,0 +1,506 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"codeberg.org/splitringresonator/multiband/internal/chat"
+	"codeberg.org/splitringresonator/multiband/internal/cli/keymap"
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	composerHeight = 3
+	// maxAttachment keeps attachments to what is sensible over slow links
+	maxAttachment = 1 << 20
+)
+
+var errNoConversation = errors.New("no conversation open, start one with /new <address>")
+
+// chatCommands are typed into the composer
+var chatCommands = []string{
+	"/new <address>     start a conversation",
+	"/attach <file>     attach a file to the next message",
+	"/detach            drop the attachment",
+	"/via [network]     send over a network, or list them",
+	"/via auto          let the backend choose the network",
+	"/help              list commands",
+}
+
+// chatMsg is a message that arrived or changed status
+type chatMsg chat.Message
+
+// chatScreen lists conversations beside the history of the open one
+type chatScreen struct {
+	backend chat.Backend
+	keys    keymap.Chat
+	help    help.Model
+
+	convs []chat.Conversation
+	idx   int
+	// opened is a conversation started with /new, listed until the backend
+	// knows it
+	opened string
+	msgs   []chat.Message
+
+	history  viewport.Model
+	composer textarea.Model
+	// via is the network chosen per peer
+	via        map[string]string
+	attachment *chat.Attachment
+	note       string
+
+	width, height int
+}
+
+func newChatScreen(env Env) Screen {
+	backend := env.Chat
+	if backend == nil {
+		backend = chat.NewMemory()
+	}
+
+	composer := textarea.New()
+	composer.Placeholder = "Write a message, or /help"
+	composer.ShowLineNumbers = false
+	composer.Prompt = "┃ "
+	composer.KeyMap.InsertNewline = env.Keys.Chat.Newline
+
+	h := help.New()
+	h.Styles = helpStyles
+
+	s := &chatScreen{
+		backend:  backend,
+		keys:     env.Keys.Chat,
+		help:     h,
+		history:  viewport.New(0, 0),
+		composer: composer,
+		via:      map[string]string{},
+	}
+	s.history.KeyMap = viewport.KeyMap{PageUp: s.keys.ScrollUp, PageDown: s.keys.ScrollDown}
+	s.reload()
+	return s
+}
+
+func (s *chatScreen) Title() string { return "Messages" }
+
+func (s *chatScreen) Init() tea.Cmd {
+	return s.wait()
+}
+
+// wait delivers the next update from the backend
+func (s *chatScreen) wait() tea.Cmd {
+	updates := s.backend.Updates()
+	return func() tea.Msg {
+		m, ok := <-updates
+		if !ok {
+			return nil
+		}
+		return chatMsg(m)
+	}
+}
+
+func (s *chatScreen) Capturing() bool { return s.composer.Focused() }
+
+func (s *chatScreen) Commands() []Command {
+	cmds := []Command{}
+	for i, c := range s.convs {
+		cmds = append(cmds, Command{
+			Title: "Open conversation with " + c.Title(),
+			Run: func() tea.Msg {
+				return openConversationMsg(i)
+			},
+		})
+	}
+	return cmds
+}
+
+type openConversationMsg int
+
+func (s *chatScreen) peer() string {
+	if s.idx < len(s.convs) {
+		return s.convs[s.idx].Peer
+	}
+	return ""
+}
+
+// reload fetches the conversations, keeping the open one selected, and its
+// messages
+func (s *chatScreen) reload() {
+	peer := s.peer()
+	convs, err := s.backend.Conversations()
+	if err != nil {
+		s.note = err.Error()
+		return
+	}
+	if s.opened != "" {
+		known := false
+		for _, c := range convs {
+			known = known || c.Peer == s.opened
+		}
+		if known {
+			s.opened = ""
+		} else {
+			convs = append([]chat.Conversation{{Peer: s.opened}}, convs...)
+		}
+	}
+	s.convs = convs
+	s.selectPeer(peer)
+}
+
+// selectPeer opens the conversation with peer, or the most recent one
+func (s *chatScreen) selectPeer(peer string) {
+	s.idx = 0
+	for i, c := range s.convs {
+		if c.Peer == peer {
+			s.idx = i
+		}
+	}
+	s.loadMessages()
+}
+
+func (s *chatScreen) loadMessages() {
+	peer := s.peer()
+	s.msgs = nil
+	if peer == "" {
+		s.refresh()
+		return
+	}
+	msgs, err := s.backend.Messages(peer)
+	if err != nil {
+		s.note = err.Error()
+	}
+	s.msgs = msgs
+	if s.convs[s.idx].Unread > 0 {
+		if err := s.backend.MarkRead(peer); err != nil {
+			s.note = err.Error()
+		}
+		s.convs[s.idx].Unread = 0
+	}
+	s.refresh()
+}
+
+// refresh redraws the history, following new messages if it was at the end
+func (s *chatScreen) refresh() {
+	follow := s.history.AtBottom()
+	s.history.SetContent(s.historyView())
+	if follow {
+		s.history.GotoBottom()
+	}
+}
+
+func (s *chatScreen) listWidth() int {
+	return min(28, s.width/3)
+}
+
+func (s *chatScreen) resize() {
+	right := max(0, s.width-s.listWidth()-1)
+	s.composer.SetWidth(right)
+	s.composer.SetHeight(composerHeight)
+	s.history.Width = right
+	// the history sits below its header and above the composer and note
+	s.history.Height = max(0, s.height-composerHeight-2)
+	s.help.Width = right
+	s.refresh()
+}
+
+func (s *chatScreen) Update(msg tea.Msg) (Screen, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		s.width, s.height = msg.Width, msg.Height
+		s.resize()
+		return s, nil
+
+	case chatMsg:
+		s.reload()
+		return s, s.wait()
+
+	case openConversationMsg:
+		if int(msg) < len(s.convs) {
+			s.idx = int(msg)
+			s.loadMessages()
+		}
+		return s, nil
+
+	case tea.KeyMsg:
+		if s.composer.Focused() {
+			return s, s.updateComposer(msg)
+		}
+		switch {
+		case key.Matches(msg, s.keys.Up):
+			if s.idx > 0 {
+				s.idx--
+				s.loadMessages()
+			}
+		case key.Matches(msg, s.keys.Down):
+			if s.idx < len(s.convs)-1 {
+				s.idx++
+				s.loadMessages()
+			}
+		case key.Matches(msg, s.keys.Compose):
+			s.note = ""
+			return s, s.composer.Focus()
+		default:
+			var cmd tea.Cmd
+			s.history, cmd = s.history.Update(msg)
+			return s, cmd
+		}
+		return s, nil
+	}
+
+	if s.composer.Focused() {
+		var cmd tea.Cmd
+		s.composer, cmd = s.composer.Update(msg)
+		return s, cmd
+	}
+	return s, nil
+}
+
+func (s *chatScreen) updateComposer(msg tea.KeyMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, s.keys.Leave):
+		s.composer.Blur()
+		return nil
+	case key.Matches(msg, s.keys.Send):
+		text := strings.TrimSpace(s.composer.Value())
+		if text == "" {
+			return nil
+		}
+		var err error
+		if strings.HasPrefix(text, "/") {
+			err = s.command(text)
+		} else {
+			err = s.send(text)
+		}
+		if err != nil {
+			s.note = err.Error()
+			return nil
+		}
+		s.composer.Reset()
+		return nil
+	case key.Matches(msg, s.keys.ScrollUp, s.keys.ScrollDown):
+		var cmd tea.Cmd
+		s.history, cmd = s.history.Update(msg)
+		return cmd
+	}
+
+	var cmd tea.Cmd
+	s.composer, cmd = s.composer.Update(msg)
+	return cmd
+}
+
+func (s *chatScreen) send(body string) error {
+	peer := s.peer()
+	if peer == "" {
+		return errNoConversation
+	}
+	_, err := s.backend.Send(chat.Message{
+		Peer:       peer,
+		Body:       body,
+		Network:    s.via[peer],
+		Attachment: s.attachment,
+	})
+	if err != nil {
+		return err
+	}
+	s.attachment = nil
+	s.note = ""
+	// follow the message sent, the history is redrawn when it is stored
+	s.history.GotoBottom()
+	return nil
+}
+
+// command runs a /command typed into the composer
+func (s *chatScreen) command(line string) error {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case "/help":
+		s.note = strings.Join(chatCommands, "\n")
+
+	case "/new":
+		if arg == "" {
+			return errors.New("usage: /new <address>")
+		}
+		s.opened = arg
+		s.reload()
+		s.selectPeer(arg)
+		s.note = "new conversation with " + arg
+
+	case "/attach":
+		if arg == "" {
+			return errors.New("usage: /attach <file>")
+		}
+		info, err := os.Stat(arg)
+		if err != nil {
+			return err
+		}
+		if info.Size() > maxAttachment {
+			return fmt.Errorf("%s is %s, attachments are limited to %s", arg, byteSize(info.Size()), byteSize(maxAttachment))
+		}
+		data, err := os.ReadFile(arg)
+		if err != nil {
+			return err
+		}
+		s.attachment = &chat.Attachment{Name: filepath.Base(arg), Data: data}
+		s.note = "attached " + s.attachment.Name + ", sent with the next message"
+
+	case "/detach":
+		s.attachment = nil
+		s.note = "attachment dropped"
+
+	case "/via":
+		peer := s.peer()
+		networks := s.backend.Networks()
+		switch {
+		case arg == "":
+			if len(networks) == 0 {
+				s.note = "no networks"
+			} else {
+				s.note = "networks: " + strings.Join(networks, ", ")
+			}
+		case peer == "":
+			return errNoConversation
+		case arg == "auto":
+			delete(s.via, peer)
+			s.note = "sending over any network"
+		default:
+			known := false
+			for _, n := range networks {
+				known = known || n == arg
+			}
+			if !known {
+				return fmt.Errorf("%w %q, expected one of %s", chat.ErrUnknownNetwork, arg, strings.Join(networks, ", "))
+			}
+			s.via[peer] = arg
+			s.note = "sending over " + arg
+		}
+
+	default:
+		return fmt.Errorf("unknown command %s, try /help", name)
+	}
+	return nil
+}
+
+func byteSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// tick shows how far a sent message got
+func tick(st chat.Status) string {
+	switch st {
+	case chat.Queued:
+		return mutedStyle.Render("◷ queued")
+	case chat.Sent:
+		return mutedStyle.Render("✓ sent")
+	case chat.Acked:
+		return upStyle.Render("✓✓ acked")
+	case chat.Failed:
+		return downStyle.Render("✗ failed")
+	}
+	return st.String()
+}
+
+func (s *chatScreen) historyView() string {
+	if s.peer() == "" {
+		return mutedStyle.Render("No conversations yet. Start one with /new <address>.")
+	}
+	if len(s.msgs) == 0 {
+		return mutedStyle.Render("No messages yet.")
+	}
+
+	body := lipgloss.NewStyle().Width(max(1, s.history.Width-2)).PaddingLeft(2)
+	name := s.convs[s.idx].Title()
+	out := []string{}
+	for _, m := range s.msgs {
+		header := m.Time.Format(time.TimeOnly) + " "
+		if m.Outgoing {
+			header += cursorStyle.Render("you") + " " + tick(m.Status)
+		} else {
+			header += cursorStyle.Render(name)
+		}
+		if m.Network != "" {
+			header += mutedStyle.Render(" via " + m.Network)
+		}
+		out = append(out, header)
+		if m.Body != "" {
+			out = append(out, body.Render(m.Body))
+		}
+		if m.Attachment != nil {
+			out = append(out, body.Render(mutedStyle.Render(fmt.Sprintf("attached %s (%s)", m.Attachment.Name, byteSize(int64(len(m.Attachment.Data)))))))
+		}
+		out = append(out, "")
+	}
+	return strings.Join(out, "\n")
+}
+
+func (s *chatScreen) listView() string {
+	w := s.listWidth()
+	rows := []string{}
+	for i, c := range s.convs {
+		title := c.Title()
+		unread := ""
+		if c.Unread > 0 {
+			unread = fmt.Sprintf(" (%d)", c.Unread)
+		}
+		row := lipgloss.NewStyle().MaxWidth(w - 2 - lipgloss.Width(unread)).Render(title)
+		if i == s.idx {
+			row = cursorStyle.Render("› " + row)
+		} else {
+			row = "  " + row
+		}
+		rows = append(rows, row+upStyle.Render(unread))
+	}
+	return lipgloss.NewStyle().Width(w).Height(s.height).Render(strings.Join(rows, "\n"))
+}
+
+func (s *chatScreen) View() string {
+	header := mutedStyle.Render("no conversation")
+	if peer := s.peer(); peer != "" {
+		header = cursorStyle.Render(s.convs[s.idx].Title())
+		if s.convs[s.idx].Name != "" {
+			header += mutedStyle.Render(" " + peer)
+		}
+		if n := s.via[peer]; n != "" {
+			header += mutedStyle.Render(" via " + n)
+		}
+	}
+
+	note := s.note
+	switch {
+	case note != "":
+		note = mutedStyle.Render(note)
+	case s.attachment != nil:
+		note = mutedStyle.Render("attached " + s.attachment.Name)
+	default:
+		note = s.help.View(s.keys)
+	}
+
+	// notes can run over several lines, and take their room from the history
+	history := s.history
+	if extra := lipgloss.Height(note) - 1; extra > 0 {
+		history.Height = max(0, history.Height-extra)
+		if s.history.AtBottom() {
+			history.GotoBottom()
+		}
+	}
+
+	right := lipgloss.JoinVertical(lipgloss.Left, header, history.View(), s.composer.View(), note)
+	gutter := mutedStyle.Render(strings.Repeat("│\n", max(0, s.height-1)) + "│")
+	return lipgloss.JoinHorizontal(lipgloss.Top, s.listView(), gutter, right)
+}
@@ -0,0 +1,263 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"codeberg.org/splitringresonator/multiband/internal/chat"
+	"codeberg.org/splitringresonator/multiband/internal/cli/golden"
+	"codeberg.org/splitringresonator/multiband/internal/cli/keymap"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// chatTest drives a chat screen over an in-memory backend
+type chatTest struct {
+	t      *testing.T
+	mem    *chat.Memory
+	screen *chatScreen
+}
+
+func newChatTest(t *testing.T) *chatTest {
+	t.Helper()
+	mem := chat.NewMemory("lora", "tcp")
+	mem.Receive(chat.Message{Peer: "b0b", Body: "hi there"}, "Bob")
+	c := &chatTest{t: t, mem: mem}
+	c.screen = newChatScreen(Env{Chat: mem, Keys: keymap.Default()}).(*chatScreen)
+	c.screen.Update(tea.WindowSizeMsg{Width: 100, Height: 30})
+	c.sync()
+	return c
+}
+
+// press types keys by name, as golden.Keys names them
+func (c *chatTest) press(keys ...string) {
+	for _, k := range keys {
+		for _, msg := range golden.Keys(k) {
+			c.screen.Update(msg)
+		}
+	}
+}
+
+// say types line into the composer and sends it. Lines refused are left in
+// the composer to be fixed, so it is cleared first.
+func (c *chatTest) say(line string) {
+	if !c.screen.Capturing() {
+		c.press("tab")
+	}
+	c.screen.composer.Reset()
+	c.press(line, "enter")
+}
+
+// sync feeds the screen the updates waiting, as the console would
+func (c *chatTest) sync() {
+	c.t.Helper()
+	for {
+		select {
+		case m := <-c.mem.Updates():
+			c.screen.Update(chatMsg(m))
+		case <-time.After(50 * time.Millisecond):
+			return
+		}
+	}
+}
+
+func (c *chatTest) view() string { return ansi.Strip(c.screen.View()) }
+
+func (c *chatTest) sent() []chat.Message {
+	c.t.Helper()
+	msgs, err := c.mem.Messages("b0b")
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	out := []chat.Message{}
+	for _, m := range msgs {
+		if m.Outgoing {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func (c *chatTest) wantNote(want string) {
+	c.t.Helper()
+	if !strings.Contains(c.screen.note, want) {
+		c.t.Errorf("note = %q, want %q in it", c.screen.note, want)
+	}
+}
+
+func TestChatCompose(t *testing.T) {
+	c := newChatTest(t)
+	if v := c.view(); !strings.Contains(v, "Bob") || !strings.Contains(v, "hi there") {
+		t.Fatalf("conversation with Bob not shown:\n%s", v)
+	}
+
+	c.press("tab")
+	if !c.screen.Capturing() {
+		t.Fatal("composer not focused")
+	}
+	c.press("hello", "alt+enter", "again", "enter")
+	if got := c.screen.composer.Value(); got != "" {
+		t.Errorf("composer still holds %q after sending", got)
+	}
+	sent := c.sent()
+	if len(sent) != 1 || sent[0].Body != "hello\nagain" || sent[0].Network != "lora" {
+		t.Fatalf("sent %+v", sent)
+	}
+
+	// blank lines are not sent
+	c.press("   ", "enter")
+	if len(c.sent()) != 1 {
+		t.Errorf("blank message sent")
+	}
+
+	c.press("esc")
+	if c.screen.Capturing() {
+		t.Errorf("composer still focused after esc")
+	}
+}
+
+func TestChatStatusTicks(t *testing.T) {
+	c := newChatTest(t)
+	c.say("ping")
+	c.sync()
+	if v := c.view(); !strings.Contains(v, "you ◷ queued via lora") {
+		t.Errorf("queued message not shown:\n%s", v)
+	}
+
+	id := c.sent()[0].ID
+	for _, step := range []struct {
+		status chat.Status
+		tick   string
+	}{
+		{chat.Sent, "✓ sent"},
+		{chat.Sent, "✓ sent"},
+		{chat.Acked, "✓✓ acked"},
+		{chat.Failed, "✗ failed"},
+	} {
+		if err := c.mem.SetStatus(id, step.status); err != nil {
+			t.Fatal(err)
+		}
+		c.sync()
+		if v := c.view(); !strings.Contains(v, "you "+step.tick) {
+			t.Errorf("after %s, no %q in:\n%s", step.status, step.tick, v)
+		}
+	}
+	if got := c.sent()[0].Attempts; got != 2 {
+		t.Errorf("attempts = %d, want 2", got)
+	}
+}
+
+func TestChatVia(t *testing.T) {
+	c := newChatTest(t)
+
+	c.say("/via")
+	c.wantNote("networks: lora, tcp")
+
+	c.say("/via tcp")
+	c.wantNote("sending over tcp")
+	if v := c.view(); !strings.Contains(v, "Bob b0b via tcp") {
+		t.Errorf("header does not show the network:\n%s", v)
+	}
+	c.say("over tcp")
+
+	c.say("/via carrier-pigeon")
+	c.wantNote("unknown network")
+	if got := c.screen.composer.Value(); got != "/via carrier-pigeon" {
+		t.Errorf("composer = %q, want the command refused kept", got)
+	}
+
+	c.say("/via auto")
+	c.wantNote("sending over any network")
+	c.say("over any")
+
+	sent := c.sent()
+	if len(sent) != 2 || sent[0].Network != "tcp" || sent[1].Network != "lora" {
+		t.Errorf("sent %+v, want over tcp then lora", sent)
+	}
+}
+
+func TestChatAttach(t *testing.T) {
+	c := newChatTest(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "map.txt")
+	if err := os.WriteFile(path, []byte("grid 42"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	large := filepath.Join(dir, "large.bin")
+	if err := os.WriteFile(large, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(large, maxAttachment+1); err != nil {
+		t.Fatal(err)
+	}
+
+	c.say("/attach " + filepath.Join(dir, "missing"))
+	c.wantNote("no such file")
+	c.say("/attach " + large)
+	c.wantNote("attachments are limited to 1.0 MiB")
+	if c.screen.attachment != nil {
+		t.Fatalf("too large a file attached")
+	}
+
+	c.say("/attach " + path)
+	c.wantNote("attached map.txt")
+	c.say("see the map")
+	c.sync()
+
+	sent := c.sent()
+	if len(sent) != 1 || sent[0].Attachment == nil || sent[0].Attachment.Name != "map.txt" || string(sent[0].Attachment.Data) != "grid 42" {
+		t.Fatalf("sent %+v", sent)
+	}
+	if c.screen.attachment != nil {
+		t.Errorf("attachment kept after sending")
+	}
+	if v := c.view(); !strings.Contains(v, "attached map.txt (7 B)") {
+		t.Errorf("attachment not shown:\n%s", v)
+	}
+
+	c.say("/attach " + path)
+	c.say("/detach")
+	c.wantNote("attachment dropped")
+	c.say("no map")
+	if sent := c.sent(); sent[1].Attachment != nil {
+		t.Errorf("detached file sent")
+	}
+}
+
+func TestChatNew(t *testing.T) {
+	c := newChatTest(t)
+	c.say("/new a11ce")
+	c.wantNote("new conversation with a11ce")
+	c.say("hello alice")
+	c.sync()
+	msgs, err := c.mem.Messages("a11ce")
+	if err != nil || len(msgs) != 1 || msgs[0].Body != "hello alice" {
+		t.Fatalf("messages to a11ce: %+v, %v", msgs, err)
+	}
+	if c.screen.peer() != "a11ce" {
+		t.Errorf("open conversation is %q, want a11ce", c.screen.peer())
+	}
+}
+
+// sending from the update loop must not wait on the loop to read updates
+func TestChatSendUnread(t *testing.T) {
+	c := newChatTest(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 200 {
+			c.say("flood")
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sending blocked with updates unread")
+	}
+	if n := len(c.sent()); n != 200 {
+		t.Errorf("sent %d messages, want 200", n)
+	}
+}
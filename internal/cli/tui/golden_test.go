@@ -0,0 +1,68 @@
+package tui
+
+import (
+	"encoding/json"
+	"flag"
+	"path/filepath"
+	"testing"
+
+	docs_cli "codeberg.org/splitringresonator/multiband/internal/cli/docs"
+	"codeberg.org/splitringresonator/multiband/internal/cli/golden"
+	"codeberg.org/splitringresonator/multiband/internal/cli/keymap"
+	"codeberg.org/splitringresonator/multiband/internal/cli/theme"
+	"codeberg.org/splitringresonator/multiband/internal/version"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the frames drawn")
+
+// waits are the console's commands waiting on its feeds
+var waits = []string{
+	"codeberg.org/splitringresonator/multiband/internal/cli/tui.(*chatScreen).wait.",
+	"codeberg.org/splitringresonator/multiband/internal/cli/tui.(*ifaceScreen).wait.",
+	"codeberg.org/splitringresonator/multiband/internal/cli/tui.Model.waitConfig.",
+}
+
+// drawSameFrames has frames drawn the same whatever the terminal, version
+// or user running the tests
+func drawSameFrames(t *testing.T) {
+	profile, short := lipgloss.ColorProfile(), version.Short
+	t.Cleanup(func() {
+		lipgloss.SetColorProfile(profile)
+		version.Short = short
+	})
+	lipgloss.SetColorProfile(termenv.Ascii)
+	version.Short = "golden"
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	th := theme.Default
+	th.Glamour = json.RawMessage(`"dark"`)
+	docs_cli.SetTheme(th)
+	SetTheme(th)
+}
+
+func TestGolden(t *testing.T) {
+	drawSameFrames(t)
+	for _, tc := range []struct {
+		name string
+		play func() *golden.Driver
+	}{
+		{"console-palette", func() *golden.Driver {
+			m := NewModel(Env{Identity: "golden", Keys: keymap.Default()})
+			return golden.New(m, 100, 24, waits...).
+				Type("2").
+				Snapshot("messages").
+				Type(":", "docs").
+				Snapshot("palette").
+				Type("enter").
+				Snapshot("docs")
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join("testdata", tc.name+".golden")
+			if err := golden.Compare(path, tc.play().Golden(), *update); err != nil {
+				t.Errorf("%v\nrun go test -update to accept the new frames", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package tui
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"codeberg.org/splitringresonator/multiband/internal/cli/keymap"
+	"codeberg.org/splitringresonator/multiband/internal/link"
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// sparkWindow is how far back the signal graphs go
+const sparkWindow = 10 * time.Minute
+
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// sampleMsg is a sample from the link feed
+type sampleMsg link.Sample
+
+// ifaceScreen lists the interfaces with their signal over the last minutes
+type ifaceScreen struct {
+	feed link.Feed
+	keys keymap.Interfaces
+	help help.Model
+
+	ifaces  []link.Interface
+	history map[string][]link.Sample
+	idx     int
+	details bool
+	note    string
+
+	width, height int
+}
+
+func newIfaceScreen(env Env) Screen {
+	h := help.New()
+	h.Styles = helpStyles
+	s := &ifaceScreen{
+		feed:    env.Links,
+		keys:    env.Keys.Interfaces,
+		help:    h,
+		history: map[string][]link.Sample{},
+	}
+	if s.feed != nil {
+		s.ifaces = s.feed.Interfaces()
+	}
+	return s
+}
+
+func (s *ifaceScreen) Title() string { return "Interfaces" }
+
+func (s *ifaceScreen) Init() tea.Cmd {
+	return s.wait()
+}
+
+func (s *ifaceScreen) wait() tea.Cmd {
+	if s.feed == nil {
+		return nil
+	}
+	samples := s.feed.Samples()
+	return func() tea.Msg {
+		sample, ok := <-samples
+		if !ok {
+			return nil
+		}
+		return sampleMsg(sample)
+	}
+}
+
+func (s *ifaceScreen) latest(name string) (link.Sample, bool) {
+	h := s.history[name]
+	if len(h) == 0 {
+		return link.Sample{}, false
+	}
+	return h[len(h)-1], true
+}
+
+// links is the state of every interface for the status bar
+func (s *ifaceScreen) links() tea.Cmd {
+	links := LinksMsg{}
+	for _, i := range s.ifaces {
+		sample, _ := s.latest(i.Name)
+		links = append(links, Link{Name: i.Name, Up: sample.State == link.Up, Detail: sample.State.String()})
+	}
+	return func() tea.Msg { return links }
+}
+
+func (s *ifaceScreen) Update(msg tea.Msg) (Screen, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		s.width, s.height = msg.Width, msg.Height
+		s.help.Width = msg.Width
+
+	case sampleMsg:
+		prev, seen := s.latest(msg.Interface)
+		h := append(s.history[msg.Interface], link.Sample(msg))
+		for len(h) > 0 && msg.Time.Sub(h[0].Time) > sparkWindow {
+			h = h[1:]
+		}
+		s.history[msg.Interface] = h
+
+		cmds := []tea.Cmd{s.wait()}
+		if !seen || prev.State != msg.State {
+			cmds = append(cmds, s.links())
+		}
+		return s, tea.Batch(cmds...)
+
+	case configMsg:
+		if s.feed == nil {
+			return s, nil
+		}
+		// interfaces may have come, gone or been retuned
+		s.ifaces = s.feed.Interfaces()
+		for name := range s.history {
+			if !slices.ContainsFunc(s.ifaces, func(i link.Interface) bool { return i.Name == name }) {
+				delete(s.history, name)
+			}
+		}
+		s.idx = min(s.idx, max(0, len(s.ifaces)-1))
+		return s, s.links()
+
+	case tea.KeyMsg:
+		s.note = ""
+		switch {
+		case s.details:
+			if key.Matches(msg, s.keys.Close, s.keys.Details) {
+				s.details = false
+			}
+		case key.Matches(msg, s.keys.Up):
+			if s.idx > 0 {
+				s.idx--
+			}
+		case key.Matches(msg, s.keys.Down):
+			if s.idx < len(s.ifaces)-1 {
+				s.idx++
+			}
+		case key.Matches(msg, s.keys.Details):
+			s.details = s.idx < len(s.ifaces)
+		case key.Matches(msg, s.keys.Toggle):
+			s.toggle()
+		}
+	}
+	return s, nil
+}
+
+// toggle takes the selected interface down, or brings it up
+func (s *ifaceScreen) toggle() {
+	if s.idx >= len(s.ifaces) {
+		return
+	}
+	name := s.ifaces[s.idx].Name
+	sample, _ := s.latest(name)
+	up := sample.State == link.Down
+	if err := s.feed.SetUp(name, up); err != nil {
+		s.note = err.Error()
+		return
+	}
+	if up {
+		s.note = "bringing " + name + " up"
+	} else {
+		s.note = "taking " + name + " down"
+	}
+}
+
+// sparkline draws values over the last sparkWindow in width cells, one per
+// slice of time, scaled between the lowest and highest values seen
+func sparkline(samples []link.Sample, value func(link.Sample) float64, now time.Time, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	sums := make([]float64, width)
+	counts := make([]int, width)
+	lo, hi := 0.0, 0.0
+	first := true
+	for _, sample := range samples {
+		age := now.Sub(sample.Time)
+		if age < 0 || age >= sparkWindow || sample.State == link.Down {
+			continue
+		}
+		cell := width - 1 - int(age*time.Duration(width)/sparkWindow)
+		v := value(sample)
+		sums[cell] += v
+		counts[cell]++
+		if first {
+			lo, hi, first = v, v, false
+		}
+		lo, hi = min(lo, v), max(hi, v)
+	}
+
+	var b strings.Builder
+	for i := range width {
+		if counts[i] == 0 {
+			b.WriteRune(' ')
+			continue
+		}
+		level := len(sparkBars) / 2
+		if hi > lo {
+			avg := sums[i] / float64(counts[i])
+			level = int((avg - lo) / (hi - lo) * float64(len(sparkBars)-1))
+		}
+		b.WriteRune(sparkBars[level])
+	}
+	return b.String()
+}
+
+// meter draws used out of budget as a bar of width cells
+func meter(used, budget time.Duration, width int) string {
+	if budget <= 0 || width <= 0 {
+		return ""
+	}
+	filled := min(width, int(int64(used)*int64(width)/int64(budget)))
+	style := upStyle
+	if used*10 >= budget*9 {
+		style = downStyle
+	}
+	return style.Render(strings.Repeat("█", filled)) + mutedStyle.Render(strings.Repeat("░", width-filled))
+}
+
+func stateDot(st link.State) string {
+	switch st {
+	case link.Up:
+		return upStyle.Render("●")
+	case link.Degraded:
+		return cursorStyle.Render("◐")
+	}
+	return downStyle.Render("○")
+}
+
+// radio sums up the frequency and modulation of an interface
+func radio(i link.Interface) string {
+	parts := []string{i.Kind}
+	if i.Frequency != 0 {
+		parts = append(parts, fmt.Sprintf("%.3f MHz", float64(i.Frequency)/1e6))
+	}
+	if m := i.Modem; m != nil {
+		parts = append(parts, fmt.Sprintf("SF%d BW%dk CR4/%d %ddBm", m.SpreadingFactor, m.Bandwidth/1000, m.CodingRate, m.TxPower))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (s *ifaceScreen) rowView(i link.Interface, selected bool, now time.Time) string {
+	sample, seen := s.latest(i.Name)
+	state := "waiting"
+	if seen {
+		state = sample.State.String()
+	}
+
+	title := fmt.Sprintf("%s %s", stateDot(sample.State), i.Name)
+	if selected {
+		title = cursorStyle.Render("› ") + title
+	} else {
+		title = "  " + title
+	}
+	rows := []string{title + "  " + mutedStyle.Render(radio(i)+"  "+state)}
+
+	traffic := fmt.Sprintf("    in %d  out %d", sample.PacketsIn, sample.PacketsOut)
+	if budget := i.Budget(); budget > 0 {
+		traffic += fmt.Sprintf("  airtime %s %s/%s", meter(sample.Airtime, budget, 20), sample.Airtime.Round(time.Millisecond), budget)
+	}
+	if seen && sample.Battery >= 0 {
+		traffic += fmt.Sprintf("  battery %.0f%%", sample.Battery)
+	}
+	rows = append(rows, traffic)
+
+	if i.Modem != nil {
+		graph := max(0, (s.width-36)/2)
+		rssi := sparkline(s.history[i.Name], func(x link.Sample) float64 { return x.RSSI }, now, graph)
+		snr := sparkline(s.history[i.Name], func(x link.Sample) float64 { return x.SNR }, now, graph)
+		lastRSSI, lastSNR := fmt.Sprintf("%4.0f dBm", sample.RSSI), fmt.Sprintf("%5.1f dB", sample.SNR)
+		if sample.State == link.Down {
+			lastRSSI, lastSNR = "   - dBm", "    - dB"
+		}
+		rows = append(rows, fmt.Sprintf("    RSSI %s %s  SNR %s %s", upStyle.Render(rssi), lastRSSI, upStyle.Render(snr), lastSNR))
+	}
+	return strings.Join(rows, "\n")
+}
+
+func (s *ifaceScreen) detailsView() string {
+	i := s.ifaces[s.idx]
+	sample, seen := s.latest(i.Name)
+	rows := [][2]string{
+		{"name", i.Name},
+		{"kind", i.Kind},
+		{"state", sample.State.String()},
+	}
+	if seen && sample.Battery >= 0 {
+		rows = append(rows, [2]string{"battery", fmt.Sprintf("%.1f%%", sample.Battery)})
+	}
+	if i.Frequency != 0 {
+		rows = append(rows, [2]string{"frequency", fmt.Sprintf("%d Hz", i.Frequency)})
+	}
+	if m := i.Modem; m != nil {
+		rows = append(rows,
+			[2]string{"bandwidth", fmt.Sprintf("%d Hz", m.Bandwidth)},
+			[2]string{"spreading factor", fmt.Sprint(m.SpreadingFactor)},
+			[2]string{"coding rate", fmt.Sprintf("4/%d", m.CodingRate)},
+			[2]string{"tx power", fmt.Sprintf("%d dBm", m.TxPower)},
+		)
+	}
+	if i.DutyCycle > 0 {
+		rows = append(rows, [2]string{"duty cycle", fmt.Sprintf("%g%% (%s per %s)", i.DutyCycle*100, i.Budget(), link.DutyWindow)})
+	}
+	for _, k := range slices.Sorted(maps.Keys(i.Config)) {
+		rows = append(rows, [2]string{k, i.Config[k]})
+	}
+
+	out := []string{cursorStyle.Render(i.Name + " configuration"), ""}
+	for _, r := range rows {
+		out = append(out, "  "+mutedStyle.Width(18).Render(r[0])+" "+r[1])
+	}
+	return strings.Join(out, "\n")
+}
+
+func (s *ifaceScreen) View() string {
+	if s.feed == nil || len(s.ifaces) == 0 {
+		return lipgloss.Place(s.width, s.height, lipgloss.Center, lipgloss.Center, mutedStyle.Render("No interfaces configured."))
+	}
+
+	footer := s.help.View(s.keys)
+	if s.note != "" {
+		footer = mutedStyle.Render(s.note)
+	}
+
+	body := ""
+	if s.details {
+		body = s.detailsView()
+	} else {
+		// graphs end at the latest sample, so simulated time lines up too
+		now := time.Time{}
+		for _, h := range s.history {
+			if len(h) > 0 && h[len(h)-1].Time.After(now) {
+				now = h[len(h)-1].Time
+			}
+		}
+		rows := []string{}
+		for n, i := range s.ifaces {
+			rows = append(rows, s.rowView(i, n == s.idx, now))
+		}
+		body = strings.Join(rows, "\n\n")
+	}
+
+	body = lipgloss.NewStyle().Height(max(0, s.height-1)).MaxHeight(max(0, s.height-1)).Render(body)
+	return body + "\n" + footer
+}
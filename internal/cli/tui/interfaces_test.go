@@ -0,0 +1,133 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"codeberg.org/splitringresonator/multiband/internal/cli/golden"
+	"codeberg.org/splitringresonator/multiband/internal/cli/keymap"
+	"codeberg.org/splitringresonator/multiband/internal/link"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/muesli/termenv"
+)
+
+var t0 = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func TestSparkline(t *testing.T) {
+	at := func(ago time.Duration, v float64) link.Sample {
+		return link.Sample{Time: t0.Add(-ago), State: link.Up, RSSI: v}
+	}
+	rssi := func(s link.Sample) float64 { return s.RSSI }
+
+	for _, tc := range []struct {
+		name    string
+		samples []link.Sample
+		width   int
+		want    string
+	}{
+		{"empty", nil, 4, "    "},
+		{"no room", []link.Sample{at(time.Minute, 1)}, 0, ""},
+		// four cells of 2m30s each, oldest first
+		{"scaled", []link.Sample{at(9*time.Minute, 0), at(6*time.Minute, 5), at(time.Minute, 10)}, 4, "▁▄ █"},
+		{"averaged", []link.Sample{at(9*time.Minute, 0), at(2*time.Minute, 10), at(time.Minute, 0)}, 4, "▁  ▄"},
+		{"flat", []link.Sample{at(9*time.Minute, -90), at(time.Minute, -90)}, 4, "▅  ▅"},
+		{"negative", []link.Sample{at(9*time.Minute, -120), at(time.Minute, -60)}, 2, "▁█"},
+		{"out of the window", []link.Sample{at(sparkWindow, 100), at(-time.Minute, 100), at(time.Minute, 1), at(9*time.Minute, 0)}, 4, "▁  █"},
+		{"down", []link.Sample{{Time: t0.Add(-time.Minute), State: link.Down, RSSI: 100}, at(9*time.Minute, 0), at(time.Minute, 1)}, 4, "▁  █"},
+	} {
+		if got := sparkline(tc.samples, rssi, t0, tc.width); got != tc.want {
+			t.Errorf("%s: sparkline = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMeter(t *testing.T) {
+	profile := lipgloss.ColorProfile()
+	t.Cleanup(func() { lipgloss.SetColorProfile(profile) })
+	lipgloss.SetColorProfile(termenv.TrueColor)
+
+	for _, tc := range []struct {
+		used, budget time.Duration
+		width        int
+		want         string
+	}{
+		{0, time.Minute, 8, "░░░░░░░░"},
+		{15 * time.Second, time.Minute, 8, "██░░░░░░"},
+		{time.Minute, time.Minute, 8, "████████"},
+		{time.Hour, time.Minute, 8, "████████"},
+		{time.Second, 0, 8, ""},
+		{time.Second, time.Minute, 0, ""},
+	} {
+		if got := ansi.Strip(meter(tc.used, tc.budget, tc.width)); got != tc.want {
+			t.Errorf("meter(%s, %s, %d) = %q, want %q", tc.used, tc.budget, tc.width, got, tc.want)
+		}
+	}
+
+	// nearly spent budgets turn from the up to the down color
+	if got, want := meter(8, 10, 10), upStyle.Render("████████")+mutedStyle.Render("░░"); got != want {
+		t.Errorf("meter at 80%% = %q, want %q", got, want)
+	}
+	if got, want := meter(9, 10, 10), downStyle.Render("█████████")+mutedStyle.Render("░"); got != want {
+		t.Errorf("meter at 90%% = %q, want %q", got, want)
+	}
+}
+
+// feed steps sim at now and hands the screen what it reported
+func feed(t *testing.T, s *ifaceScreen, sim *link.Sim, now time.Time) {
+	t.Helper()
+	sim.Step(now)
+	for range sim.Interfaces() {
+		select {
+		case sample := <-sim.Samples():
+			s.Update(sampleMsg(sample))
+		default:
+			t.Fatal("the simulation reported too few samples")
+		}
+	}
+}
+
+func TestInterfaceToggle(t *testing.T) {
+	sim := link.NewSim(1, link.Demo...)
+	s := newIfaceScreen(Env{Links: sim, Keys: keymap.Default()}).(*ifaceScreen)
+	s.Update(golden.Keys("j")[0])
+	if name := s.ifaces[s.idx].Name; name != "lora1" {
+		t.Fatalf("selected %s, want lora1", name)
+	}
+
+	now := t0
+	state := func() link.State {
+		now = now.Add(time.Second)
+		feed(t, s, sim, now)
+		sample, _ := s.latest("lora1")
+		return sample.State
+	}
+	if st := state(); st == link.Down {
+		t.Fatalf("lora1 starts %s", st)
+	}
+
+	s.Update(golden.Keys("u")[0])
+	if s.note != "taking lora1 down" {
+		t.Errorf("note = %q", s.note)
+	}
+	if st := state(); st != link.Down {
+		t.Fatalf("lora1 is %s after taking it down", st)
+	}
+	if !strings.Contains(ansi.Strip(s.View()), "○") {
+		t.Errorf("no interface shown down:\n%s", ansi.Strip(s.View()))
+	}
+
+	s.Update(golden.Keys("u")[0])
+	if s.note != "bringing lora1 up" {
+		t.Errorf("note = %q", s.note)
+	}
+	if st := state(); st == link.Down {
+		t.Fatalf("lora1 still down after bringing it up")
+	}
+	for _, i := range s.ifaces {
+		if sample, _ := s.latest(i.Name); sample.State == link.Down {
+			t.Errorf("%s went down with lora1", i.Name)
+		}
+	}
+}
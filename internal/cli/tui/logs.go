@@ -0,0 +1,159 @@
+package tui
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"codeberg.org/splitringresonator/multiband/internal/cli/keymap"
+	"codeberg.org/splitringresonator/multiband/internal/logging"
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// logEvery is how often the log screen looks for new entries
+const logEvery = time.Second
+
+// logLevels are the levels the log screen can be narrowed to, in turn
+var logLevels = []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError}
+
+// logTickMsg has the log screen look for new entries
+type logTickMsg struct{}
+
+// logScreen shows the latest log entries, following new ones while the
+// last is selected
+type logScreen struct {
+	ring *logging.Ring
+	keys keymap.Logs
+	help help.Model
+
+	entries []logging.Entry
+	seen    uint64
+	level   int
+	idx     int
+	follow  bool
+
+	width, height int
+}
+
+func newLogScreen(env Env) Screen {
+	h := help.New()
+	h.Styles = helpStyles
+	s := &logScreen{ring: env.Logs, keys: env.Keys.Logs, help: h, follow: true}
+	s.refresh()
+	return s
+}
+
+func (s *logScreen) Title() string { return "Logs" }
+
+func (s *logScreen) Init() tea.Cmd { return s.tick() }
+
+func (s *logScreen) tick() tea.Cmd {
+	if s.ring == nil {
+		return nil
+	}
+	return tea.Tick(logEvery, func(time.Time) tea.Msg { return logTickMsg{} })
+}
+
+// refresh reads the entries at or above the level chosen
+func (s *logScreen) refresh() {
+	if s.ring == nil {
+		return
+	}
+	all, total := s.ring.Entries()
+	s.seen = total
+	s.entries = slices.DeleteFunc(all, func(e logging.Entry) bool { return e.Level < logLevels[s.level] })
+	if s.follow {
+		s.idx = len(s.entries) - 1
+	}
+	s.idx = max(0, min(s.idx, len(s.entries)-1))
+}
+
+func (s *logScreen) Update(msg tea.Msg) (Screen, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		s.width, s.height = msg.Width, msg.Height
+		s.help.Width = msg.Width
+
+	case logTickMsg:
+		if s.ring.Total() != s.seen {
+			s.refresh()
+		}
+		return s, s.tick()
+
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, s.keys.Up):
+			if s.idx > 0 {
+				s.idx--
+			}
+			s.follow = false
+		case key.Matches(msg, s.keys.Down):
+			if s.idx < len(s.entries)-1 {
+				s.idx++
+			}
+			s.follow = s.idx == len(s.entries)-1
+		case key.Matches(msg, s.keys.Bottom):
+			s.follow = true
+			s.refresh()
+		case key.Matches(msg, s.keys.Level):
+			s.level = (s.level + 1) % len(logLevels)
+			s.refresh()
+		}
+	}
+	return s, nil
+}
+
+func (s *logScreen) View() string {
+	if s.ring == nil {
+		return lipgloss.Place(s.width, s.height, lipgloss.Center, lipgloss.Center,
+			mutedStyle.Render("Nothing is logged here."))
+	}
+
+	status := fmt.Sprintf("%s and above, %d entries", strings.ToLower(logLevels[s.level].String()), len(s.entries))
+	if s.follow {
+		status += ", following"
+	}
+	rows := []string{mutedStyle.Render(status), ""}
+	if len(s.entries) == 0 {
+		rows = append(rows, mutedStyle.Render("  Nothing yet."))
+	}
+
+	// scroll to keep the selected entry in view
+	room := max(1, s.height-len(rows)-1)
+	first := max(0, s.idx-room+1)
+	for n := first; n < len(s.entries) && n < first+room; n++ {
+		e := s.entries[n]
+		row := e.Time.Format(time.TimeOnly) + " " + levelStyle(e.Level).Render(fmt.Sprintf("%-5s", e.Level)) + " " +
+			mutedStyle.Render(e.Subsystem) + " " + e.Message
+		if e.Attrs != "" {
+			row += " " + mutedStyle.Render(e.Attrs)
+		}
+		if n == s.idx {
+			row = cursorStyle.Render("› ") + row
+		} else {
+			row = "  " + row
+		}
+		rows = append(rows, ansi.Truncate(row, s.width, "…"))
+	}
+
+	body := lipgloss.NewStyle().Height(max(0, s.height-1)).MaxHeight(max(0, s.height-1)).Render(strings.Join(rows, "\n"))
+	return body + "\n" + s.help.View(s.keys)
+}
+
+func levelStyle(l slog.Level) lipgloss.Style {
+	switch {
+	case l >= slog.LevelError:
+		return downStyle
+	case l >= slog.LevelWarn:
+		return cursorStyle
+	case l >= slog.LevelInfo:
+		return upStyle
+	}
+	return mutedStyle
+}
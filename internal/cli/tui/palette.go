@@ -0,0 +1,128 @@
+package tui
+
+import (
+	"slices"
+	"strings"
+
+	"codeberg.org/splitringresonator/multiband/internal/cli/keymap"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// paletteRows caps how many matching commands are listed at once, the
+// list scrolling to keep the one selected in view
+const paletteRows = 10
+
+type palette struct {
+	open     bool
+	input    textinput.Model
+	commands []Command
+	matches  []Command
+	idx      int
+}
+
+func newPalette() palette {
+	input := textinput.New()
+	input.Prompt = "> "
+	input.Placeholder = "type a command"
+	return palette{input: input}
+}
+
+func (p *palette) show(commands []Command) tea.Cmd {
+	p.open = true
+	p.commands = commands
+	p.input.SetValue("")
+	p.filter()
+	return p.input.Focus()
+}
+
+func (p *palette) hide() {
+	p.open = false
+	p.input.Blur()
+}
+
+// filter keeps the commands containing the typed letters in order, listing
+// those containing them as a word first
+func (p *palette) filter() {
+	q := strings.ToLower(strings.TrimSpace(p.input.Value()))
+	p.matches = []Command{}
+	for _, c := range p.commands {
+		if subsequence(strings.ToLower(c.Title), q) {
+			p.matches = append(p.matches, c)
+		}
+	}
+	slices.SortStableFunc(p.matches, func(a, b Command) int {
+		ca := strings.Contains(strings.ToLower(a.Title), q)
+		cb := strings.Contains(strings.ToLower(b.Title), q)
+		switch {
+		case ca && !cb:
+			return -1
+		case cb && !ca:
+			return 1
+		}
+		return 0
+	})
+	p.idx = 0
+}
+
+func subsequence(s, sub string) bool {
+	for _, r := range sub {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(string(r)):]
+	}
+	return true
+}
+
+// update handles a key while the palette is open, returning the command to
+// run when one is chosen
+func (p *palette) update(msg tea.KeyMsg, k keymap.TUI) tea.Cmd {
+	switch {
+	case key.Matches(msg, k.Cancel):
+		p.hide()
+		return nil
+	case key.Matches(msg, k.Up):
+		if p.idx > 0 {
+			p.idx--
+		}
+		return nil
+	case key.Matches(msg, k.Down):
+		if p.idx < len(p.matches)-1 {
+			p.idx++
+		}
+		return nil
+	case key.Matches(msg, k.Select):
+		p.hide()
+		if p.idx < len(p.matches) {
+			return p.matches[p.idx].Run
+		}
+		return nil
+	}
+
+	var cmd tea.Cmd
+	before := p.input.Value()
+	p.input, cmd = p.input.Update(msg)
+	if p.input.Value() != before {
+		p.filter()
+	}
+	return cmd
+}
+
+func (p palette) view(width int) string {
+	rows := []string{p.input.View(), ""}
+	first := max(0, min(p.idx-paletteRows/2, len(p.matches)-paletteRows))
+	for i, c := range p.matches[first:min(first+paletteRows, len(p.matches))] {
+		if i += first; i == p.idx {
+			rows = append(rows, cursorStyle.Render("› "+c.Title))
+		} else {
+			rows = append(rows, "  "+c.Title)
+		}
+	}
+	if len(p.matches) == 0 {
+		rows = append(rows, mutedStyle.Render("  no matching commands"))
+	}
+	return paletteStyle.Width(min(60, width-4)).Render(strings.Join(rows, "\n"))
+}
@@ -0,0 +1,47 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"codeberg.org/splitringresonator/multiband/internal/cli/golden"
+	"codeberg.org/splitringresonator/multiband/internal/cli/keymap"
+	"github.com/charmbracelet/x/ansi"
+)
+
+func TestPaletteScroll(t *testing.T) {
+	commands := []Command{}
+	for i := range 25 {
+		commands = append(commands, Command{Title: fmt.Sprintf("command %02d", i)})
+	}
+	p := newPalette()
+	p.show(commands)
+	keys := keymap.Default().TUI
+
+	// the selection stays in view, with the rows around it
+	for i := range len(commands) + 5 {
+		idx := min(i, len(commands)-1)
+		view := ansi.Strip(p.view(80))
+		if want := fmt.Sprintf("› command %02d", idx); !strings.Contains(view, want) {
+			t.Fatalf("after %d downs, no %q in:\n%s", i, want, view)
+		}
+		if n := strings.Count(view, "command "); n != paletteRows {
+			t.Fatalf("after %d downs, %d rows listed, want %d", i, n, paletteRows)
+		}
+		p.update(golden.Keys("down")[0], keys)
+	}
+	for range len(commands) {
+		p.update(golden.Keys("up")[0], keys)
+	}
+	if view := ansi.Strip(p.view(80)); !strings.Contains(view, "› command 00") || strings.Contains(view, "command 10") {
+		t.Errorf("back at the top, listed:\n%s", view)
+	}
+
+	// fewer matches than rows are all listed
+	p.input.SetValue("2")
+	p.filter()
+	if n := strings.Count(ansi.Strip(p.view(80)), "command "); n != 7 {
+		t.Errorf("%d of the 7 matches listed", n)
+	}
+}
@@ -0,0 +1,119 @@
+package tui
+
+import (
+	"io"
+
+	"codeberg.org/splitringresonator/multiband/internal/alert"
+	"codeberg.org/splitringresonator/multiband/internal/chat"
+	"codeberg.org/splitringresonator/multiband/internal/cli/keymap"
+	"codeberg.org/splitringresonator/multiband/internal/config"
+	"codeberg.org/splitringresonator/multiband/internal/link"
+	"codeberg.org/splitringresonator/multiband/internal/logging"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Screen is a tab of the operator console. It is sent the space left between
+// the tab bar and status bar as a tea.WindowSizeMsg, the keys the console
+// does not take for itself while it is active, and every other message
+// whether it is active or not.
+type Screen interface {
+	Title() string
+	Init() tea.Cmd
+	Update(tea.Msg) (Screen, tea.Cmd)
+	View() string
+}
+
+// Capturer is implemented by screens with text inputs, so the console leaves
+// their keys alone while they are typing
+type Capturer interface {
+	Capturing() bool
+}
+
+// Binder is implemented by screens with keys of their own, which the
+// console leaves to them over its bindings on the same keys
+type Binder interface {
+	Bindings() []key.Binding
+}
+
+// Commander is implemented by screens that add to the command palette
+type Commander interface {
+	Commands() []Command
+}
+
+// Closer is implemented by screens with state to save when the console exits
+type Closer interface {
+	Close() error
+}
+
+// Command is an entry in the command palette
+type Command struct {
+	Title string
+	Run   tea.Cmd
+}
+
+// Env is what screens are built with
+type Env struct {
+	// Identity is shown in the status bar, eg. the identity hash or anonymous
+	Identity string
+	Keys     keymap.KeyMap
+	// Chat carries messages, kept in memory only if nil
+	Chat chat.Backend
+	// Links reports on the interfaces, if there are any
+	Links link.Feed
+	// Alerts checks messages and samples against the alert rules, if there
+	// are any
+	Alerts *alert.Engine
+	// Terminal is the program's output, to ring the bell on alerts and
+	// copy links to the clipboard. Remote consoles, served over SSH, copy
+	// links rather than open them on the machine they run on.
+	Terminal io.Writer
+	Remote   bool
+	// DocsState is where the docs screen keeps bookmarks and history, the
+	// docs browser's own StatePath if empty
+	DocsState string
+	// Reload reads the configuration again, Reloads reports every reload
+	// however it was asked for and Reports lists those so far, if the
+	// configuration can be reloaded
+	Reload  func() config.Report
+	Reloads <-chan config.Report
+	Reports func() []config.Report
+	// Logs holds the latest log entries, if the node logs
+	Logs *logging.Ring
+	// Status is shown in the status bar until something replaces it, eg. a
+	// warning from starting the console
+	Status string
+}
+
+// Factory builds a screen for a new console
+type Factory func(Env) Screen
+
+var registry []Factory
+
+// Register adds a screen to consoles created afterwards, after the screens
+// registered before it
+func Register(f Factory) {
+	registry = append(registry, f)
+}
+
+// Link is the health of a network interface, as shown in the status bar
+type Link struct {
+	Name   string
+	Up     bool
+	Detail string
+}
+
+// LinksMsg replaces the links shown in the status bar. It is also passed on
+// to every screen.
+type LinksMsg []Link
+
+// StatusMsg shows a note in the status bar until the next one
+type StatusMsg string
+
+// GotoMsg switches to the screen with the given title
+type GotoMsg string
+
+// Goto is a command switching to the screen with the given title
+func Goto(title string) tea.Cmd {
+	return func() tea.Msg { return GotoMsg(title) }
+}
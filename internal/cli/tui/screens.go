@@ -0,0 +1,145 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	docs_cli "codeberg.org/splitringresonator/multiband/internal/cli/docs"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+func init() {
+	Register(newDashboard)
+	Register(newChatScreen)
+	Register(placeholder("Contacts", "No contacts yet."))
+	Register(newIfaceScreen)
+	Register(placeholder("Queue", "Nothing waiting to be sent."))
+	Register(newAlertScreen)
+	Register(newLogScreen)
+	Register(newDocsScreen)
+}
+
+// dashboard summarises the node
+type dashboard struct {
+	env     Env
+	started time.Time
+	links   []Link
+	width   int
+}
+
+func newDashboard(env Env) Screen {
+	return &dashboard{env: env, started: time.Now()}
+}
+
+func (d *dashboard) Title() string { return "Dashboard" }
+func (d *dashboard) Init() tea.Cmd { return nil }
+
+func (d *dashboard) Update(msg tea.Msg) (Screen, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		d.width = msg.Width
+	case LinksMsg:
+		d.links = msg
+	}
+	return d, nil
+}
+
+func (d *dashboard) View() string {
+	rows := []string{
+		cursorStyle.Render("Identity"),
+		"  " + d.env.Identity,
+		"",
+		cursorStyle.Render("Links"),
+	}
+	if len(d.links) == 0 {
+		rows = append(rows, mutedStyle.Render("  none up yet"))
+	}
+	for _, l := range d.links {
+		dot := downStyle.Render("●")
+		if l.Up {
+			dot = upStyle.Render("●")
+		}
+		row := fmt.Sprintf("  %s %s", dot, l.Name)
+		if l.Detail != "" {
+			row += mutedStyle.Render("  " + l.Detail)
+		}
+		rows = append(rows, row)
+	}
+	rows = append(rows, "",
+		cursorStyle.Render("Started"),
+		"  "+d.started.Format(time.DateTime),
+	)
+	return lipgloss.NewStyle().Padding(1, 2).MaxWidth(d.width).Render(strings.Join(rows, "\n"))
+}
+
+// empty is a screen with nothing to show yet
+type empty struct {
+	title, note   string
+	width, height int
+}
+
+func placeholder(title, note string) Factory {
+	return func(Env) Screen { return &empty{title: title, note: note} }
+}
+
+func (e *empty) Title() string { return e.title }
+func (e *empty) Init() tea.Cmd { return nil }
+
+func (e *empty) Update(msg tea.Msg) (Screen, tea.Cmd) {
+	if msg, ok := msg.(tea.WindowSizeMsg); ok {
+		e.width, e.height = msg.Width, msg.Height
+	}
+	return e, nil
+}
+
+func (e *empty) View() string {
+	return lipgloss.Place(e.width, e.height, lipgloss.Center, lipgloss.Center, mutedStyle.Render(e.note))
+}
+
+// docsScreen embeds the docs browser
+type docsScreen struct {
+	model docs_cli.Model
+	err   error
+}
+
+func newDocsScreen(env Env) Screen {
+	m := docs_cli.NewModel(0, 0)
+	m.SetEmbedded()
+	m.SetKeyMap(env.Keys.Docs)
+	m.SetOutput(env.Terminal, env.Remote)
+	s := &docsScreen{}
+	path := env.DocsState
+	if path == "" {
+		path, _ = docs_cli.StatePath()
+	}
+	if path != "" {
+		s.err = m.UseState(path)
+	}
+	s.model = m
+	return s
+}
+
+func (s *docsScreen) Title() string { return "Docs" }
+func (s *docsScreen) Init() tea.Cmd { return s.model.Init() }
+
+func (s *docsScreen) Update(msg tea.Msg) (Screen, tea.Cmd) {
+	m, cmd := s.model.Update(msg)
+	s.model = m.(docs_cli.Model)
+	return s, cmd
+}
+
+func (s *docsScreen) View() string { return s.model.View() }
+
+func (s *docsScreen) Capturing() bool { return s.model.Capturing() }
+
+func (s *docsScreen) Bindings() []key.Binding { return s.model.Bindings() }
+
+func (s *docsScreen) Close() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.model.SaveState()
+}
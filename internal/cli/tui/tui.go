@@ -1,97 +1,347 @@
+// Package tui is the operator console: a tab bar of screens over a status
+// bar showing the identity in use and the health of each link
 package tui
 
 import (
-	"fmt"
+	"errors"
+	"slices"
+	"strings"
 
+	"codeberg.org/splitringresonator/multiband/internal/alert"
+	"codeberg.org/splitringresonator/multiband/internal/chat"
+	"codeberg.org/splitringresonator/multiband/internal/cli/keymap"
+	"codeberg.org/splitringresonator/multiband/internal/cli/theme"
+	"codeberg.org/splitringresonator/multiband/internal/config"
+	"codeberg.org/splitringresonator/multiband/internal/link"
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 )
 
+var (
+	cursorStyle    lipgloss.Style
+	mutedStyle     lipgloss.Style
+	tabStyle       lipgloss.Style
+	activeTabStyle lipgloss.Style
+	statusStyle    lipgloss.Style
+	upStyle        lipgloss.Style
+	downStyle      lipgloss.Style
+	paletteStyle   lipgloss.Style
+	toastStyle     lipgloss.Style
+	helpStyles     help.Styles
+)
+
+func init() {
+	SetTheme(theme.Default)
+}
+
+// SetTheme restyles the console, and the screens built after it
+func SetTheme(t theme.Theme) {
+	cursorStyle = lipgloss.NewStyle().Foreground(t.Primary()).Bold(true)
+	mutedStyle = lipgloss.NewStyle().Foreground(t.Muted())
+	tabStyle = lipgloss.NewStyle().Padding(0, 1).Foreground(t.Muted())
+	activeTabStyle = tabStyle.Background(t.Primary()).Foreground(t.Text()).Bold(true)
+	statusStyle = lipgloss.NewStyle().Foreground(t.Muted())
+	upStyle = lipgloss.NewStyle().Foreground(t.OK())
+	downStyle = lipgloss.NewStyle().Foreground(t.Error())
+	paletteStyle = lipgloss.NewStyle().Border(t.BorderStyle()).BorderForeground(t.Primary()).Padding(0, 1)
+	toastStyle = lipgloss.NewStyle().Border(t.BorderStyle()).BorderForeground(t.Error()).Padding(0, 1)
+	helpStyles = help.New().Styles
+	helpStyles.ShortKey = helpStyles.ShortKey.Foreground(t.Primary())
+	helpStyles.FullKey = helpStyles.FullKey.Foreground(t.Primary())
+	helpStyles.ShortDesc = helpStyles.ShortDesc.Foreground(t.Muted())
+	helpStyles.FullDesc = helpStyles.FullDesc.Foreground(t.Muted())
+}
+
 type Model struct {
-	choices  []string
-	cursor   int
-	identity *string
-	selected map[int]struct{}
+	env     Env
+	screens []Screen
+	active  int
+
+	width, height int
+
+	links  []Link
+	status string
+	// toast is the last alert raised, shown over the screens for a while
+	toast  *alert.Alert
+	toasts int
+
+	palette palette
+	keys    keymap.TUI
+	help    help.Model
 }
 
-func NewModel() Model {
-	return Model{
-		choices:  []string{"menu item 1", "menu item 2", "messages", "interfaces"},
-		selected: make(map[int]struct{}),
+// NewModel builds a console with every registered screen
+func NewModel(env Env) Model {
+	h := help.New()
+	h.Styles = helpStyles
+	m := Model{
+		env:     env,
+		palette: newPalette(),
+		keys:    env.Keys.TUI,
+		help:    h,
+		status:  env.Status,
+	}
+	for _, f := range registry {
+		m.screens = append(m.screens, f(env))
 	}
+	return m
 }
 
 func (m Model) Init() tea.Cmd {
-	return nil
+	cmds := []tea.Cmd{m.waitConfig()}
+	for _, s := range m.screens {
+		cmds = append(cmds, s.Init())
+	}
+	return tea.Batch(cmds...)
 }
 
-func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	switch msg := msg.(type) {
-
-	// Is it a key press?
-	case tea.KeyMsg:
+// configMsg is a reload of the configuration, applied or rejected
+type configMsg config.Report
 
-		// Cool, what was the actual key pressed?
-		switch msg.String() {
+func (m Model) waitConfig() tea.Cmd {
+	if m.env.Reloads == nil {
+		return nil
+	}
+	reloads := m.env.Reloads
+	return func() tea.Msg {
+		r, ok := <-reloads
+		if !ok {
+			return nil
+		}
+		return configMsg(r)
+	}
+}
 
-		// These keys should exit the program.
-		case "ctrl+c", "q":
-			return m, tea.Quit
+// Close lets every screen save its state
+func (m Model) Close() error {
+	errs := []error{}
+	for _, s := range m.screens {
+		if c, ok := s.(Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
 
-		// The "up" and "k" keys move the cursor up
-		case "up", "k":
-			if m.cursor > 0 {
-				m.cursor--
-			}
+func (m Model) capturing() bool {
+	if m.active >= len(m.screens) {
+		return false
+	}
+	c, ok := m.screens[m.active].(Capturer)
+	return ok && c.Capturing()
+}
 
-		// The "down" and "j" keys move the cursor down
-		case "down", "j":
-			if m.cursor < len(m.choices)-1 {
-				m.cursor++
-			}
+// screenBinds reports whether the active screen binds msg itself, leaving
+// the console's binding for the key aside
+func (m Model) screenBinds(msg tea.KeyMsg) bool {
+	if m.active >= len(m.screens) {
+		return false
+	}
+	b, ok := m.screens[m.active].(Binder)
+	return ok && key.Matches(msg, b.Bindings()...)
+}
 
-		// The "enter" key and the spacebar (a literal space) toggle
-		// the selected state for the item that the cursor is pointing at.
-		case "enter", " ":
-			_, ok := m.selected[m.cursor]
-			if ok {
-				delete(m.selected, m.cursor)
-			} else {
-				m.selected[m.cursor] = struct{}{}
+// commands are offered by the palette: every screen, the console's own
+// actions, then those of the active screen
+func (m Model) commands() []Command {
+	cmds := []Command{}
+	for _, s := range m.screens {
+		cmds = append(cmds, Command{Title: "Go to " + s.Title(), Run: Goto(s.Title())})
+	}
+	cmds = append(cmds,
+		Command{Title: "Toggle help", Run: func() tea.Msg { return toggleHelpMsg{} }},
+		Command{Title: "Quit", Run: tea.Quit},
+	)
+	if m.env.Alerts != nil {
+		cmds = append(cmds, Command{Title: "Reload alert rules", Run: func() tea.Msg { return reloadRulesMsg{} }})
+	}
+	if reload := m.env.Reload; reload != nil {
+		reloads := m.env.Reloads
+		cmds = append(cmds, Command{Title: "Reload configuration", Run: func() tea.Msg {
+			r := reload()
+			// otherwise the report comes in with the others
+			if reloads == nil {
+				return configMsg(r)
 			}
+			return nil
+		}})
+	}
+	if m.active < len(m.screens) {
+		if c, ok := m.screens[m.active].(Commander); ok {
+			cmds = append(cmds, c.Commands()...)
 		}
 	}
+	return cmds
+}
+
+type toggleHelpMsg struct{}
 
-	// Return the updated model to the Bubble Tea runtime for processing.
-	// Note that we're not returning a command.
-	return m, nil
+func (m *Model) switchTo(i int) {
+	if len(m.screens) == 0 {
+		return
+	}
+	m.active = (i + len(m.screens)) % len(m.screens)
 }
 
-func (m Model) View() string {
-	// The header
-	s := "What should we buy at the market?\n\n"
+// resize tells every screen how much room is left between the bars
+func (m *Model) resize() tea.Cmd {
+	m.help.Width = m.width
+	size := tea.WindowSizeMsg{Width: m.width, Height: max(0, m.height-2-lipgloss.Height(m.help.View(m.keys)))}
+	return m.broadcast(size)
+}
+
+func (m *Model) broadcast(msg tea.Msg) tea.Cmd {
+	cmds := []tea.Cmd{}
+	for i, s := range m.screens {
+		var cmd tea.Cmd
+		m.screens[i], cmd = s.Update(msg)
+		cmds = append(cmds, cmd)
+	}
+	return tea.Batch(cmds...)
+}
+
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		return m, m.resize()
 
-	// Iterate over our choices
-	for i, choice := range m.choices {
+	case LinksMsg:
+		m.links = msg
 
-		// Is the cursor pointing at this choice?
-		cursor := " " // no cursor
-		if m.cursor == i {
-			cursor = ">" // cursor!
+	case StatusMsg:
+		m.status = string(msg)
+		return m, nil
+
+	case GotoMsg:
+		for i, s := range m.screens {
+			if s.Title() == string(msg) {
+				m.switchTo(i)
+			}
+		}
+		return m, nil
+
+	case chatMsg:
+		if m.env.Alerts != nil {
+			raised := m.raise(m.env.Alerts.Message(chat.Message(msg), m.peerName(msg.Peer)))
+			cmd := m.broadcast(msg)
+			return m, tea.Batch(raised, cmd)
+		}
+
+	case sampleMsg:
+		if m.env.Alerts != nil {
+			raised := m.raise(m.env.Alerts.Sample(link.Sample(msg)))
+			cmd := m.broadcast(msg)
+			return m, tea.Batch(raised, cmd)
+		}
+
+	case configMsg:
+		m.status = config.Report(msg).Summary()
+		cmd := m.broadcast(msg)
+		return m, tea.Batch(m.waitConfig(), cmd)
+
+	case toastDoneMsg:
+		if int(msg) == m.toasts {
+			m.toast = nil
+		}
+		return m, nil
+
+	case toggleHelpMsg:
+		m.help.ShowAll = !m.help.ShowAll
+		return m, m.resize()
+
+	case tea.KeyMsg:
+		if m.palette.open {
+			return m, m.palette.update(msg, m.keys)
+		}
+		if msg.Type == tea.KeyCtrlC {
+			return m, tea.Quit
+		}
+		if !m.capturing() && !m.screenBinds(msg) {
+			switch {
+			case key.Matches(msg, m.keys.Quit):
+				return m, tea.Quit
+			case key.Matches(msg, m.keys.NextScreen):
+				m.switchTo(m.active + 1)
+				return m, nil
+			case key.Matches(msg, m.keys.PrevScreen):
+				m.switchTo(m.active - 1)
+				return m, nil
+			case key.Matches(msg, m.keys.GotoScreen):
+				if i := slices.Index(m.keys.GotoScreen.Keys(), msg.String()); i < len(m.screens) {
+					m.switchTo(i)
+				}
+				return m, nil
+			case key.Matches(msg, m.keys.Palette):
+				return m, m.palette.show(m.commands())
+			case key.Matches(msg, m.keys.Help):
+				m.help.ShowAll = !m.help.ShowAll
+				return m, m.resize()
+			}
 		}
+		if m.active >= len(m.screens) {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.screens[m.active], cmd = m.screens[m.active].Update(msg)
+		return m, cmd
+	}
 
-		// Is this choice selected?
-		checked := " " // not selected
-		if _, ok := m.selected[i]; ok {
-			checked = "x" // selected!
+	// everything else may concern any screen, not only the one in view
+	return m, m.broadcast(msg)
+}
+
+func (m Model) tabsView() string {
+	tabs := []string{}
+	for i, s := range m.screens {
+		title := string(rune('1'+i)) + " " + s.Title()
+		if i >= 9 {
+			title = s.Title()
+		}
+		if i == m.active {
+			tabs = append(tabs, activeTabStyle.Render(title))
+		} else {
+			tabs = append(tabs, tabStyle.Render(title))
 		}
+	}
+	return lipgloss.NewStyle().MaxWidth(m.width).Render(lipgloss.JoinHorizontal(lipgloss.Top, tabs...))
+}
 
-		// Render the row
-		s += fmt.Sprintf("%s [%s] %s\n", cursor, checked, choice)
+func (m Model) statusView() string {
+	parts := []string{m.env.Identity}
+	if len(m.links) == 0 {
+		parts = append(parts, "no links")
 	}
+	for _, l := range m.links {
+		if l.Up {
+			parts = append(parts, upStyle.Render("●")+" "+l.Name)
+		} else {
+			parts = append(parts, downStyle.Render("●")+" "+l.Name)
+		}
+	}
+	if m.status != "" {
+		parts = append(parts, m.status)
+	}
+	return statusStyle.MaxWidth(m.width).Render(strings.Join(parts, "  "))
+}
 
-	// The footer
-	s += "\nPress q to quit.\n"
+func (m Model) View() string {
+	helpView := m.help.View(m.keys)
+	height := max(0, m.height-2-lipgloss.Height(helpView))
+
+	content := ""
+	if m.active < len(m.screens) {
+		content = m.screens[m.active].View()
+	}
+	if m.palette.open {
+		content = lipgloss.Place(m.width, height, lipgloss.Center, lipgloss.Center, m.palette.view(m.width))
+	}
+	content = lipgloss.NewStyle().Height(height).MaxHeight(height).MaxWidth(m.width).Render(content)
+	if m.toast != nil {
+		content = overlay(content, m.toastView(), m.width)
+	}
 
-	// Send the UI for rendering
-	return s
+	return lipgloss.JoinVertical(lipgloss.Left, m.tabsView(), content, m.statusView(), helpView)
 }
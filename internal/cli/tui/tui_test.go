@@ -0,0 +1,46 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	"codeberg.org/splitringresonator/multiband/internal/cli/golden"
+	"codeberg.org/splitringresonator/multiband/internal/cli/keymap"
+)
+
+func TestScreenKeysOverConsole(t *testing.T) {
+	drawSameFrames(t)
+	d := golden.New(NewModel(Env{Identity: "golden", Keys: keymap.Default()}), 100, 24, waits...)
+	model := func() Model { return d.Model().(Model) }
+
+	d.Type("8")
+	if m := model(); m.screens[m.active].Title() != "Docs" {
+		t.Fatalf("on %s, want Docs", m.screens[m.active].Title())
+	}
+	// the browser binds q and ? itself
+	d.Type("?", "q")
+	if model().help.ShowAll {
+		t.Error("? opened the console help over the docs")
+	}
+	if d.Quit() {
+		t.Fatal("q quit the console from the docs")
+	}
+
+	// screens without them leave them to the console
+	d.Type("1", "?")
+	if !model().help.ShowAll {
+		t.Error("? did not open the console help")
+	}
+	d.Type("q")
+	if !d.Quit() {
+		t.Error("q did not quit the console")
+	}
+}
+
+func TestStartupStatus(t *testing.T) {
+	drawSameFrames(t)
+	d := golden.New(NewModel(Env{Identity: "golden", Keys: keymap.Default(), Status: "no alerts: bad rule"}), 100, 24, waits...)
+	if view := d.Model().View(); !strings.Contains(view, "no alerts: bad rule") {
+		t.Errorf("status not shown:\n%s", view)
+	}
+}
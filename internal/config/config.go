@@ -0,0 +1,393 @@
+// Package config is the node's configuration file: its identities,
+// interfaces, routing policy, storage, listeners and docs options. Any
+// setting can be overridden from the environment, and those bound to flags
+// from the command line.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"codeberg.org/splitringresonator/multiband/internal/alert"
+	"codeberg.org/splitringresonator/multiband/internal/link"
+	"codeberg.org/splitringresonator/multiband/internal/logging"
+	"codeberg.org/splitringresonator/multiband/internal/server"
+	"codeberg.org/splitringresonator/multiband/internal/tracing"
+	"gopkg.in/yaml.v3"
+)
+
+// Filename is the config file looked for in the config directory
+const Filename = "multiband.yaml"
+
+// SchemaFilename is the JSON Schema written beside the config file
+const SchemaFilename = "multiband.schema.json"
+
+// Version is the schema version this build reads and writes
+const Version = 1
+
+// Config is read from YAML. The doc tags describe each field in the JSON
+// Schema, and enum tags list the values allowed.
+type Config struct {
+	Version    int          `yaml:"version" doc:"schema version of this file"`
+	Identities []Identity   `yaml:"identities,omitempty" doc:"identities the node can speak as"`
+	Interfaces []Interface  `yaml:"interfaces,omitempty" doc:"radios and links the node talks over"`
+	Routing    Routing      `yaml:"routing,omitempty" doc:"which interfaces messages leave on"`
+	Storage    Storage      `yaml:"storage,omitempty" doc:"where the node keeps its files"`
+	API        API          `yaml:"api,omitempty" doc:"listeners for operators and clients"`
+	Docs       Docs         `yaml:"docs,omitempty" doc:"built-in documentation"`
+	Logging    Logging      `yaml:"logging,omitempty" doc:"what the node logs, and where"`
+	Tracing    Tracing      `yaml:"tracing,omitempty" doc:"where traces of messages through the node are exported"`
+	Alerts     []alert.Rule `yaml:"alerts,omitempty" doc:"rules raising alerts in the console"`
+
+	// path is the file read, root its syntax tree to locate problems in,
+	// and set where each setting given came from: the file, or the
+	// environment variable
+	path string
+	root *yaml.Node
+	set  map[string]string
+}
+
+type Identity struct {
+	Name    string `yaml:"name" doc:"how the identity is referred to, and shown in the console"`
+	Path    string `yaml:"path,omitempty" doc:"file holding the keys, created if missing (default identities/<name> in the data directory)"`
+	Default bool   `yaml:"default,omitempty" doc:"speak as this identity unless told otherwise, else the first is used"`
+}
+
+type Interface struct {
+	Name            string            `yaml:"name" doc:"unique name, eg. lora0"`
+	Kind            string            `yaml:"kind" enum:"lora,tcp,serial" doc:"driver"`
+	Disabled        bool              `yaml:"disabled,omitempty" doc:"configured but left down"`
+	Frequency       int64             `yaml:"frequency,omitempty" doc:"LoRa centre frequency in Hz"`
+	Bandwidth       int               `yaml:"bandwidth,omitempty" enum:"7800,10400,15600,20800,31250,41700,62500,125000,250000,500000" doc:"LoRa bandwidth in Hz"`
+	SpreadingFactor int               `yaml:"spreading_factor,omitempty" doc:"LoRa spreading factor, 5 to 12"`
+	CodingRate      int               `yaml:"coding_rate,omitempty" doc:"LoRa coding rate denominator, 5 to 8 for 4/5 to 4/8"`
+	TxPower         int               `yaml:"tx_power,omitempty" doc:"LoRa transmit power in dBm"`
+	DutyCycle       float64           `yaml:"duty_cycle,omitempty" doc:"fraction of each hour the interface may transmit for, eg. 0.01, unlimited if 0"`
+	Options         map[string]string `yaml:"options,omitempty" doc:"driver settings, eg. port: /dev/ttyUSB0"`
+}
+
+// Link is the interface as the link layer describes it
+func (i Interface) Link() link.Interface {
+	l := link.Interface{
+		Name:      i.Name,
+		Kind:      i.Kind,
+		Frequency: i.Frequency,
+		DutyCycle: i.DutyCycle,
+		Config:    map[string]string{},
+	}
+	if i.Kind == "lora" {
+		l.Modem = &link.Modem{
+			Bandwidth:       i.Bandwidth,
+			SpreadingFactor: i.SpreadingFactor,
+			CodingRate:      i.CodingRate,
+			TxPower:         i.TxPower,
+		}
+	}
+	for k, v := range i.Options {
+		l.Config[k] = v
+	}
+	return l
+}
+
+type Routing struct {
+	Default string  `yaml:"default,omitempty" doc:"interface messages leave on when no rule matches, or auto to let the node choose (default auto)"`
+	Rules   []Route `yaml:"rules,omitempty" doc:"first matching rule wins"`
+}
+
+type Route struct {
+	Peer string   `yaml:"peer" doc:"address or announced name of the peer, or * for any"`
+	Via  []string `yaml:"via" doc:"interfaces to try, in order"`
+}
+
+// Via is the interfaces to try for a peer, known as name if it announced
+// one, by the first rule matching it, else the default. It is empty when
+// the node is left to choose.
+func (r Routing) Via(peer, name string) []string {
+	for _, rule := range r.Rules {
+		p := strings.TrimPrefix(rule.Peer, "@")
+		if p == "*" || strings.EqualFold(p, peer) || (name != "" && strings.EqualFold(p, name)) {
+			return rule.Via
+		}
+	}
+	if r.Default != "" && r.Default != "auto" {
+		return []string{r.Default}
+	}
+	return nil
+}
+
+type Storage struct {
+	Data  string `yaml:"data,omitempty" doc:"identities and messages (default $XDG_DATA_HOME/multiband)"`
+	State string `yaml:"state,omitempty" doc:"docs bookmarks and history (default $XDG_STATE_HOME/multiband)"`
+}
+
+type API struct {
+	Docs Listener `yaml:"docs,omitempty" doc:"the HTTP docs server, multiband docs serve"`
+	SSH  SSH      `yaml:"ssh,omitempty" doc:"the console over SSH, multiband tui serve"`
+	// Metrics is off unless given a listen address; docs serve --metrics
+	// has them at /metrics beside the docs
+	Metrics Listener `yaml:"metrics,omitempty" doc:"Prometheus metrics of the console and its interfaces, served at /metrics"`
+}
+
+type Listener struct {
+	Listen          string   `yaml:"listen,omitempty" doc:"host:port, or unix:/path/to.sock"`
+	TLSCert         string   `yaml:"tls_cert,omitempty" doc:"PEM encoded certificate to serve TLS with"`
+	TLSKey          string   `yaml:"tls_key,omitempty" doc:"PEM encoded private key for tls_cert"`
+	TLSSelfSigned   bool     `yaml:"tls_self_signed,omitempty" doc:"serve TLS with an ephemeral self signed certificate"`
+	BasicAuth       string   `yaml:"basic_auth,omitempty" doc:"require HTTP basic auth, as user:password"`
+	Token           string   `yaml:"token,omitempty" doc:"require an Authorization: Bearer token"`
+	ShutdownTimeout Duration `yaml:"shutdown_timeout,omitempty" doc:"time allowed for in-flight requests on shutdown"`
+}
+
+type SSH struct {
+	Listen         string `yaml:"listen,omitempty" doc:"host:port to serve SSH on"`
+	HostKey        string `yaml:"host_key,omitempty" doc:"private host key, generated if missing"`
+	AuthorizedKeys string `yaml:"authorized_keys,omitempty" doc:"public keys allowed to log in, and their identities"`
+}
+
+type Docs struct {
+	Resume bool   `yaml:"resume,omitempty" doc:"reopen the document read last"`
+	Render string `yaml:"render,omitempty" enum:"ansi,plain,html,markdown" doc:"how docs cat renders"`
+	Width  int    `yaml:"width,omitempty" doc:"column docs cat wraps at"`
+}
+
+type Logging struct {
+	Levels   string `yaml:"levels,omitempty" doc:"level of each subsystem, eg. iface.rnode=debug,queue=info, and of the rest alone, eg. warn (default info)"`
+	Format   string `yaml:"format,omitempty" enum:"text,json,logfmt" doc:"how entries are written (default text)"`
+	File     string `yaml:"file,omitempty" doc:"file to log to instead of stderr, rotated as it grows"`
+	MaxSize  int    `yaml:"max_size,omitempty" doc:"size in KiB a log file is rotated at (default 1024)"`
+	MaxFiles int    `yaml:"max_files,omitempty" doc:"rotated log files kept (default 3)"`
+}
+
+// Log is how the logging package is to be set up
+func (l Logging) Log() logging.Config {
+	return logging.Config{
+		Levels:   l.Levels,
+		Format:   l.Format,
+		File:     Expand(l.File),
+		MaxSize:  int64(l.MaxSize) << 10,
+		MaxFiles: l.MaxFiles,
+	}
+}
+
+type Tracing struct {
+	Exporter string `yaml:"exporter,omitempty" enum:"otlp,stdout" doc:"where spans go, off unless set"`
+	Endpoint string `yaml:"endpoint,omitempty" doc:"URL of the OTLP/HTTP collector (default http://localhost:4318)"`
+	File     string `yaml:"file,omitempty" doc:"file the stdout exporter appends spans to (default stderr)"`
+}
+
+// Trace is how the tracing package is to be set up
+func (t Tracing) Trace() tracing.Config {
+	return tracing.Config{
+		Exporter: t.Exporter,
+		Endpoint: t.Endpoint,
+		File:     Expand(t.File),
+	}
+}
+
+// Duration is written like 90s or 10m
+type Duration time.Duration
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+func (d Duration) MarshalYAML() (any, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(n *yaml.Node) error {
+	v, err := time.ParseDuration(n.Value)
+	if err != nil {
+		// as a type error, so the decoder goes on to report the rest
+		return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: %q is not a duration like 90s or 10m", n.Line, n.Value)}}
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// fromFile marks settings given in the file
+const fromFile = "file"
+
+// Default is the configuration without a file, matching the defaults of
+// the flags bound to it
+func Default() *Config {
+	return &Config{
+		Version: Version,
+		Routing: Routing{Default: "auto"},
+		API: API{
+			Docs:    Listener{ShutdownTimeout: Duration(server.DefaultShutdownTimeout)},
+			SSH:     SSH{Listen: ":2222"},
+			Metrics: Listener{ShutdownTimeout: Duration(server.DefaultShutdownTimeout)},
+		},
+		set: map[string]string{},
+	}
+}
+
+// Path is the file read, empty for the defaults
+func (c *Config) Path() string { return c.path }
+
+// Set reports whether a setting, eg. api.docs.listen, was given in the file
+// or environment rather than left to its default
+func (c *Config) Set(key string) bool { return c.set[key] != "" }
+
+// Load reads the config file at path over the defaults. A missing file is
+// an error wrapping fs.ErrNotExist, for callers to decide whether the
+// defaults will do.
+func Load(path string) (*Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, raw)
+}
+
+// Parse reads raw as the config file at path
+func Parse(path string, raw []byte) (*Config, error) {
+	c := Default()
+	c.path = path
+	c.Version = 0
+
+	root := &yaml.Node{}
+	if err := yaml.Unmarshal(raw, root); err != nil {
+		return nil, fileError(path, err)
+	}
+	if len(root.Content) == 0 {
+		return nil, &Error{File: path, Problems: []Problem{{Path: "version", Msg: fmt.Sprintf("missing, add version: %d", Version)}}}
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	dec.KnownFields(true)
+	err := dec.Decode(c)
+	var te *yaml.TypeError
+	if err != nil && !errors.As(err, &te) {
+		return nil, fileError(path, err)
+	}
+	c.root = root
+	collect(root.Content[0], "", c.set)
+	if err != nil {
+		// the rest of the file was read, so report what is wrong with it too
+		e := fileError(path, err).(*Error)
+		var invalid *Error
+		if errors.As(c.Validate(), &invalid) {
+			e.Problems = append(e.Problems, invalid.Problems...)
+		}
+		return nil, e
+	}
+	return c, nil
+}
+
+// collect records every setting given under n
+func collect(n *yaml.Node, prefix string, set map[string]string) {
+	if n.Kind != yaml.MappingNode {
+		if prefix != "" {
+			set[prefix] = fromFile
+		}
+		return
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key := n.Content[i].Value
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		collect(n.Content[i+1], key, set)
+	}
+}
+
+// DefaultIdentity is the identity to speak as, if there are any
+func (c *Config) DefaultIdentity() (Identity, bool) {
+	for _, id := range c.Identities {
+		if id.Default {
+			return id, true
+		}
+	}
+	if len(c.Identities) > 0 {
+		return c.Identities[0], true
+	}
+	return Identity{}, false
+}
+
+// Identity finds an identity by name
+func (c *Config) Identity(name string) (Identity, bool) {
+	for _, id := range c.Identities {
+		if id.Name == name {
+			return id, true
+		}
+	}
+	return Identity{}, false
+}
+
+// IdentityPath is the file holding an identity's keys
+func (c *Config) IdentityPath(id Identity) (string, error) {
+	if id.Path != "" {
+		return Expand(id.Path), nil
+	}
+	dir, err := c.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "identities", id.Name), nil
+}
+
+// Links are the interfaces that are not disabled, as the link layer
+// describes them
+func (c *Config) Links() []link.Interface {
+	links := []link.Interface{}
+	for _, i := range c.Interfaces {
+		if !i.Disabled {
+			links = append(links, i.Link())
+		}
+	}
+	return links
+}
+
+// DataDir is where identities and messages are kept
+func (c *Config) DataDir() (string, error) {
+	return xdgDir(c.Storage.Data, "XDG_DATA_HOME", ".local/share")
+}
+
+// StateDir is where docs bookmarks and history are kept
+func (c *Config) StateDir() (string, error) {
+	return xdgDir(c.Storage.State, "XDG_STATE_HOME", ".local/state")
+}
+
+func xdgDir(configured, env, fallback string) (string, error) {
+	if configured != "" {
+		return Expand(configured), nil
+	}
+	dir := os.Getenv(env)
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, fallback)
+	}
+	return filepath.Join(dir, "multiband"), nil
+}
+
+// Expand replaces a leading ~ with the home directory
+func Expand(path string) string {
+	rest, ok := strings.CutPrefix(path, "~")
+	if !ok || (rest != "" && rest[0] != '/') {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return home + rest
+}
+
+// Marshal writes the configuration as YAML
+func (c *Config) Marshal() ([]byte, error) {
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), enc.Close()
+}
@@ -0,0 +1,242 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name, yaml string
+		want       []string
+	}{
+		{
+			name: "bad yaml",
+			yaml: "version: 1\ninterfaces: [\n",
+			want: []string{"multiband.yaml:2: did not find expected node content"},
+		},
+		{
+			name: "unknown key",
+			yaml: "version: 1\nstorage:\n  dta: /tmp\n",
+			want: []string{`multiband.yaml:3: unknown setting "dta"`},
+		},
+		{
+			name: "wrong type",
+			yaml: "version: 1\ninterfaces:\n  - name: lora0\n    kind: lora\n    tx_power: loud\n",
+			want: []string{`multiband.yaml:5: "loud" is not a whole number`},
+		},
+		{
+			name: "bad duration",
+			yaml: "version: 1\napi:\n  docs:\n    shutdown_timeout: soon\n",
+			want: []string{`multiband.yaml:4: "soon" is not a duration like 90s or 10m`},
+		},
+		{
+			name: "empty",
+			yaml: "",
+			want: []string{"multiband.yaml: version: missing, add version: 1"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse("multiband.yaml", []byte(tc.yaml))
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("err = %v, want an *Error", err)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error\n%v\nmissing %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateLocations(t *testing.T) {
+	const file = `version: 1
+interfaces:
+  - name: lora0
+    kind: lora
+    frequency: 868100000
+    bandwidth: 125000
+    spreading_factor: 9
+    coding_rate: 5
+    tx_power: 99
+  - kind: tcp
+routing:
+  default: wifi0
+`
+	for _, tc := range []struct {
+		path         string
+		line, column int
+	}{
+		{"interfaces[0].tx_power", 9, 5},
+		{"interfaces[1]", 10, 5},
+		{"routing.default", 12, 3},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			c, err := Parse("multiband.yaml", []byte(file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var e *Error
+			if !errors.As(c.Validate(), &e) {
+				t.Fatal("Validate found no problems")
+			}
+			for _, p := range e.Problems {
+				if p.Path != tc.path {
+					continue
+				}
+				if p.Line != tc.line || p.Column != tc.column {
+					t.Errorf("%s at %d:%d, want %d:%d", p.Path, p.Line, p.Column, tc.line, tc.column)
+				}
+				return
+			}
+			t.Errorf("no problem with %s in\n%v", tc.path, e)
+		})
+	}
+}
+
+func TestValidateBlamesEnv(t *testing.T) {
+	c, err := Parse("multiband.yaml", []byte("version: 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{Env("routing.default"): "wifi0"}
+	if err := c.ApplyEnv(lookup(env)); err != nil {
+		t.Fatal(err)
+	}
+	err = c.Validate()
+	want := `multiband.yaml: routing.default: no interface named "wifi0" (from $MULTIBAND_ROUTING_DEFAULT)`
+	if err == nil || err.Error() != want {
+		t.Errorf("err = %v, want %s", err, want)
+	}
+}
+
+func TestOverridePrecedence(t *testing.T) {
+	const key = "api.docs.listen"
+	for _, tc := range []struct {
+		name      string
+		file, env string
+		flag      *string
+		want      string
+	}{
+		{name: "default", want: ""},
+		{name: "file", file: ":8001", want: ":8001"},
+		{name: "env over file", file: ":8001", env: ":8002", want: ":8002"},
+		{name: "flag over env", file: ":8001", env: ":8002", flag: ptr(":8003"), want: ":8003"},
+		{name: "flag over file", file: ":8001", flag: ptr(":8003"), want: ":8003"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			raw := "version: 1\n"
+			if tc.file != "" {
+				raw += "api:\n  docs:\n    listen: \"" + tc.file + "\"\n"
+			}
+			c, err := Parse("multiband.yaml", []byte(raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			env := map[string]string{}
+			if tc.env != "" {
+				env[Env(key)] = tc.env
+			}
+			if err := c.ApplyEnv(lookup(env)); err != nil {
+				t.Fatal(err)
+			}
+
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			flags.String("listen", "", "")
+			BindFlag(flags, "listen", key)
+			args := []string{}
+			if tc.flag != nil {
+				args = append(args, "--listen="+*tc.flag)
+			}
+			if err := flags.Parse(args); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.ApplyFlags(flags); err != nil {
+				t.Fatal(err)
+			}
+
+			if c.API.Docs.Listen != tc.want {
+				t.Errorf("setting = %q, want %q", c.API.Docs.Listen, tc.want)
+			}
+			// the flag reads the same, wherever the value came from
+			if got, _ := flags.GetString("listen"); got != tc.want {
+				t.Errorf("flag = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestApplyEnvBadValue(t *testing.T) {
+	c := Default()
+	env := map[string]string{Env("docs.width"): "wide"}
+	err := c.ApplyEnv(lookup(env))
+	want := `config: docs.width: "wide" is not a whole number (from $MULTIBAND_DOCS_WIDTH)`
+	if err == nil || err.Error() != want {
+		t.Errorf("err = %v, want %s", err, want)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	raw, err := Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s struct {
+		ID         string   `json:"$id"`
+		Required   []string `json:"required"`
+		Additional bool     `json:"additionalProperties"`
+		Properties map[string]struct {
+			Const      int `json:"const"`
+			Properties map[string]struct {
+				Type string `json:"type"`
+			} `json:"properties"`
+			Items struct {
+				Required   []string `json:"required"`
+				Properties map[string]struct {
+					Enum []any `json:"enum"`
+				} `json:"properties"`
+			} `json:"items"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(raw, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.ID != SchemaID {
+		t.Errorf("$id = %q", s.ID)
+	}
+	if len(s.Required) != 1 || s.Required[0] != "version" {
+		t.Errorf("required = %v, want [version]", s.Required)
+	}
+	if s.Additional {
+		t.Error("unknown settings allowed")
+	}
+	if got := s.Properties["version"].Const; got != Version {
+		t.Errorf("version const = %d, want %d", got, Version)
+	}
+	ifaces := s.Properties["interfaces"].Items
+	if strings.Join(ifaces.Required, ",") != "name,kind" {
+		t.Errorf("interface required = %v, want [name kind]", ifaces.Required)
+	}
+	if got := len(ifaces.Properties["kind"].Enum); got != len(Kinds) {
+		t.Errorf("kind enum has %d values, want %d", got, len(Kinds))
+	}
+	if got := s.Properties["api"].Properties["docs"].Type; got != "object" {
+		t.Errorf("api.docs type = %q, want object", got)
+	}
+}
+
+func lookup(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
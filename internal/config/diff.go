@@ -0,0 +1,170 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Action is what became of a setting from one configuration to the next
+type Action string
+
+const (
+	Added   Action = "added"
+	Removed Action = "removed"
+	Changed Action = "changed"
+)
+
+// Change is a difference between two configurations
+type Change struct {
+	// Setting is where the change is, with interfaces by name, eg.
+	// interfaces.lora0
+	Setting string `json:"setting"`
+	Action  Action `json:"action"`
+	// Detail says what changed, eg. spreading_factor 9 → 10
+	Detail string `json:"detail,omitempty"`
+	// Restart is set for settings only read at startup, which a running node
+	// leaves as they were
+	Restart bool `json:"restart,omitempty"`
+}
+
+func (c Change) String() string {
+	s := c.Setting + " " + string(c.Action)
+	if c.Detail != "" {
+		s += ": " + c.Detail
+	}
+	if c.Restart {
+		s += " (takes a restart)"
+	}
+	return s
+}
+
+// Live reports whether the change can be applied while the node runs
+func (c Change) Live() bool { return !c.Restart }
+
+// Diff lists the changes from c to next: interfaces one by one, routing, log
+// levels and alerts, which a running node can take, and the sections it
+// cannot
+func (c *Config) Diff(next *Config) []Change {
+	changes := []Change{}
+
+	prev := map[string]Interface{}
+	for _, i := range c.Interfaces {
+		prev[i.Name] = i
+	}
+	for _, i := range next.Interfaces {
+		key := "interfaces." + i.Name
+		was, ok := prev[i.Name]
+		delete(prev, i.Name)
+		if !ok {
+			changes = append(changes, Change{Setting: key, Action: Added, Detail: i.Kind})
+			continue
+		}
+		if fields := fieldDiff(was, i); len(fields) > 0 {
+			changes = append(changes, Change{Setting: key, Action: Changed, Detail: strings.Join(fields, ", ")})
+		}
+	}
+	for _, i := range c.Interfaces {
+		if _, ok := prev[i.Name]; ok {
+			changes = append(changes, Change{Setting: "interfaces." + i.Name, Action: Removed})
+		}
+	}
+
+	if c.Routing.Default != next.Routing.Default {
+		changes = append(changes, Change{Setting: "routing.default", Action: Changed, Detail: fmt.Sprintf("%s → %s", orNone(c.Routing.Default), orNone(next.Routing.Default))})
+	}
+	if !reflect.DeepEqual(c.Routing.Rules, next.Routing.Rules) {
+		changes = append(changes, Change{Setting: "routing.rules", Action: Changed, Detail: count(len(next.Routing.Rules), "rule")})
+	}
+	if c.Logging.Levels != next.Logging.Levels {
+		changes = append(changes, Change{Setting: "logging.levels", Action: Changed, Detail: fmt.Sprintf("%s → %s", orNone(c.Logging.Levels), orNone(next.Logging.Levels))})
+	}
+	if !reflect.DeepEqual(c.Alerts, next.Alerts) {
+		changes = append(changes, Change{Setting: "alerts", Action: Changed, Detail: count(len(next.Alerts), "rule")})
+	}
+
+	for _, s := range []struct {
+		key        string
+		prev, next any
+	}{
+		{"identities", c.Identities, next.Identities},
+		{"storage", c.Storage, next.Storage},
+		{"api.docs", c.API.Docs, next.API.Docs},
+		{"api.ssh", c.API.SSH, next.API.SSH},
+		{"api.metrics", c.API.Metrics, next.API.Metrics},
+		{"docs", c.Docs, next.Docs},
+		// levels apart, logging is set up once
+		{"logging", c.Logging.Keep(next.Logging), next.Logging},
+		{"tracing", c.Tracing, next.Tracing},
+	} {
+		if reflect.DeepEqual(s.prev, s.next) {
+			continue
+		}
+		change := Change{Setting: s.key, Action: Changed, Restart: true}
+		if reflect.TypeOf(s.prev).Kind() == reflect.Struct {
+			change.Detail = strings.Join(fieldDiff(s.prev, s.next), ", ")
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// Keep is next with the settings only read at startup as they are in c, as
+// a node running with c goes on after a reload
+func (c *Config) Keep(next *Config) *Config {
+	kept := *next
+	kept.Identities = c.Identities
+	kept.Storage = c.Storage
+	kept.API = c.API
+	kept.Docs = c.Docs
+	kept.Logging = c.Logging.Keep(next.Logging)
+	kept.Tracing = c.Tracing
+	return &kept
+}
+
+// Keep is l with the levels of next, which apply as the node runs
+func (l Logging) Keep(next Logging) Logging {
+	l.Levels = next.Levels
+	return l
+}
+
+// fieldDiff lists the settings differing between two structs of the same
+// type, with their values unless they are lists, sections or secrets
+func fieldDiff(a, b any) []string {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	fields := []string{}
+	for i := range va.NumField() {
+		f := va.Type().Field(i)
+		name := yamlName(f)
+		if name == "" || reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			continue
+		}
+		switch k := f.Type.Kind(); {
+		case k == reflect.Slice, k == reflect.Map, k == reflect.Struct, secret(name):
+			fields = append(fields, name)
+		default:
+			fields = append(fields, fmt.Sprintf("%s %v → %v", name, va.Field(i).Interface(), vb.Field(i).Interface()))
+		}
+	}
+	return fields
+}
+
+// secret settings are not repeated in reports
+func secret(name string) bool {
+	return slices.Contains([]string{"token", "basic_auth"}, name)
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+func count(n int, what string) string {
+	if n == 1 {
+		return "1 " + what
+	}
+	return fmt.Sprintf("%d %ss", n, what)
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is something wrong with a setting, found at Line and Column of
+// the file if it came from there
+type Problem struct {
+	// Path names the setting, eg. interfaces[1].tx_power
+	Path         string
+	Line, Column int
+	Msg          string
+}
+
+// Error is every problem found in a config file, each on its own line like
+// a compiler's: multiband.yaml:12:5: interfaces[1].tx_power: ...
+type Error struct {
+	File     string
+	Problems []Problem
+}
+
+func (e *Error) Error() string {
+	lines := []string{}
+	for _, p := range e.Problems {
+		loc := e.File
+		if loc == "" {
+			loc = "config"
+		}
+		if p.Line > 0 {
+			loc += ":" + strconv.Itoa(p.Line)
+			if p.Column > 0 {
+				loc += ":" + strconv.Itoa(p.Column)
+			}
+		}
+		if p.Path != "" {
+			loc += ": " + p.Path
+		}
+		lines = append(lines, loc+": "+p.Msg)
+	}
+	return strings.Join(lines, "\n")
+}
+
+var (
+	yamlLine    = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	yamlUnknown = regexp.MustCompile(`^field (\S+) not found in type \S+$`)
+	yamlType    = regexp.MustCompile("^cannot unmarshal !!(\\w+) (?:`(.*)` )?into (\\S+)$")
+)
+
+// expected describes the Go types decoding fails into, which mean nothing to
+// whoever wrote the file
+var expected = map[string]string{
+	"int":     "a whole number",
+	"int64":   "a whole number",
+	"float64": "a number",
+	"bool":    "true or false",
+	"string":  "text",
+}
+
+// plain rewrites a decoder message in terms of the file
+func plain(msg string) string {
+	if m := yamlUnknown.FindStringSubmatch(msg); m != nil {
+		return fmt.Sprintf("unknown setting %q", m[1])
+	}
+	if m := yamlType.FindStringSubmatch(msg); m != nil {
+		want, ok := expected[m[3]]
+		switch {
+		case !ok && strings.HasPrefix(m[3], "[]"):
+			want = "a list"
+		case !ok:
+			want = "a section of settings"
+		}
+		if m[2] != "" {
+			return fmt.Sprintf("%q is not %s", m[2], want)
+		}
+		got, ok := map[string]string{"seq": "a list", "map": "a section"}[m[1]]
+		if !ok {
+			got = "a " + m[1]
+		}
+		return fmt.Sprintf("expected %s, not %s", want, got)
+	}
+	return msg
+}
+
+// fileError turns the errors of the YAML decoder into problems with lines
+func fileError(path string, err error) error {
+	msgs := []string{err.Error()}
+	var te *yaml.TypeError
+	if errors.As(err, &te) {
+		msgs = te.Errors
+	}
+
+	e := &Error{File: path}
+	for _, msg := range msgs {
+		p := Problem{Msg: strings.TrimPrefix(msg, "yaml: ")}
+		if m := yamlLine.FindStringSubmatch(msg); m != nil {
+			p.Line, _ = strconv.Atoi(m[1])
+			p.Msg = m[2]
+		}
+		p.Msg = plain(p.Msg)
+		e.Problems = append(e.Problems, p)
+	}
+	return e
+}
+
+// locate finds where the setting at path is written in the file, or as
+// near as it gets, eg. the interface missing a name
+func (c *Config) locate(path string) (line, column int) {
+	if c.root == nil || len(c.root.Content) == 0 {
+		return 0, 0
+	}
+	n := c.root.Content[0]
+	line, column = n.Line, n.Column
+	for _, part := range strings.Split(path, ".") {
+		name, index, indexed := strings.Cut(part, "[")
+		next := (*yaml.Node)(nil)
+		if n.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == name {
+					next = n.Content[i+1]
+					line, column = n.Content[i].Line, n.Content[i].Column
+				}
+			}
+		}
+		if next == nil {
+			return line, column
+		}
+		n = next
+		if indexed {
+			i, err := strconv.Atoi(strings.TrimSuffix(index, "]"))
+			if err != nil || n.Kind != yaml.SequenceNode || i >= len(n.Content) {
+				return line, column
+			}
+			n = n.Content[i]
+			line, column = n.Line, n.Column
+		}
+	}
+	return line, column
+}
+
+// problem is a problem with the setting at path, located in the file or
+// blamed on the environment variable it came from
+func (c *Config) problem(path, format string, args ...any) Problem {
+	msg := fmt.Sprintf(format, args...)
+	if from := c.set[path]; from != "" && from != fromFile {
+		return Problem{Path: path, Msg: msg + " (from $" + from + ")"}
+	}
+	line, column := c.locate(path)
+	return Problem{Path: path, Line: line, Column: column, Msg: msg}
+}
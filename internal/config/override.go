@@ -0,0 +1,222 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// EnvPrefix starts the environment variables overriding settings, eg.
+// MULTIBAND_API_DOCS_LISTEN for api.docs.listen
+const EnvPrefix = "MULTIBAND_"
+
+// Annotation marks a flag with the setting it is bound to
+const Annotation = "multiband_config"
+
+// Env is the environment variable overriding a setting
+func Env(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// Keys lists the settings that can be overridden: those holding a value or
+// list of values, outside of lists like interfaces
+func Keys() []string {
+	keys := []string{}
+	var walk func(t reflect.Type, prefix string)
+	walk = func(t reflect.Type, prefix string) {
+		for i := range t.NumField() {
+			f := t.Field(i)
+			name := yamlName(f)
+			if name == "" {
+				continue
+			}
+			if prefix != "" {
+				name = prefix + "." + name
+			}
+			switch {
+			case f.Type.Kind() == reflect.Struct:
+				walk(f.Type, name)
+			case f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() != reflect.String,
+				f.Type.Kind() == reflect.Map:
+			default:
+				keys = append(keys, name)
+			}
+		}
+	}
+	walk(reflect.TypeOf(Config{}), "")
+	return keys
+}
+
+// ApplyEnv overrides settings with the environment variables set for them,
+// looked up with lookup, eg. os.LookupEnv
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	problems := []Problem{}
+	for _, key := range Keys() {
+		if key == "version" {
+			continue
+		}
+		v, ok := lookup(Env(key))
+		if !ok {
+			continue
+		}
+		if err := c.SetString(key, v); err != nil {
+			problems = append(problems, Problem{Path: key, Msg: fmt.Sprintf("%s (from $%s)", err, Env(key))})
+			continue
+		}
+		c.set[key] = Env(key)
+	}
+	if len(problems) > 0 {
+		return &Error{File: c.path, Problems: problems}
+	}
+	return nil
+}
+
+// BindFlag binds a flag to a setting, for ApplyFlags
+func BindFlag(flags *pflag.FlagSet, name, key string) {
+	if err := flags.SetAnnotation(name, Annotation, []string{key}); err != nil {
+		panic(err)
+	}
+}
+
+// ApplyFlags reconciles the settings with the flags bound to them. Flags
+// given on the command line override the settings; otherwise settings given
+// in the file or environment become the flags' values, so commands can read
+// either.
+func (c *Config) ApplyFlags(flags *pflag.FlagSet) error {
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		keys := f.Annotations[Annotation]
+		if err != nil || len(keys) == 0 {
+			return
+		}
+		key := keys[0]
+		switch {
+		case f.Changed:
+			err = c.SetString(key, flagValue(f))
+		case c.Set(key):
+			var v string
+			if v, err = c.GetString(key); err == nil {
+				err = flags.Set(f.Name, v)
+				f.Changed = false
+			}
+		}
+		if err != nil {
+			err = fmt.Errorf("--%s: %w", f.Name, err)
+		}
+	})
+	return err
+}
+
+// flagValue is a flag's value as SetString takes it
+func flagValue(f *pflag.Flag) string {
+	if s, ok := f.Value.(pflag.SliceValue); ok {
+		return strings.Join(s.GetSlice(), ",")
+	}
+	return f.Value.String()
+}
+
+// field finds a setting by key
+func (c *Config) field(key string) (reflect.Value, error) {
+	v := reflect.ValueOf(c).Elem()
+	for _, part := range strings.Split(key, ".") {
+		if v.Kind() != reflect.Struct {
+			return v, fmt.Errorf("unknown setting %q", key)
+		}
+		found := false
+		for i := range v.NumField() {
+			if yamlName(v.Type().Field(i)) == part {
+				v, found = v.Field(i), true
+				break
+			}
+		}
+		if !found {
+			return v, fmt.Errorf("unknown setting %q", key)
+		}
+	}
+	return v, nil
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+// SetString sets a setting from text, as written in environment variables
+// and flags. Lists are separated by commas.
+func (c *Config) SetString(key, s string) error {
+	v, err := c.field(key)
+	if err != nil {
+		return err
+	}
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration like 90s or 10m", s)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", s)
+		}
+		v.SetBool(b)
+	case v.CanInt():
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", s)
+		}
+		v.SetInt(n)
+	case v.CanFloat():
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		v.SetFloat(f)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		items := []string{}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("%s cannot be set from text", key)
+	}
+	return nil
+}
+
+// GetString is a setting as text, the way SetString takes it
+func (c *Config) GetString(key string) (string, error) {
+	v, err := c.field(key)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case v.Type() == durationType:
+		return time.Duration(v.Int()).String(), nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		return strings.Join(v.Interface().([]string), ","), nil
+	case v.Kind() == reflect.Struct, v.Kind() == reflect.Slice, v.Kind() == reflect.Map:
+		return "", fmt.Errorf("%s is not a single setting", key)
+	}
+	return fmt.Sprint(v.Interface()), nil
+}
+
+func yamlName(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return strings.ToLower(f.Name)
+	}
+	return name
+}
@@ -0,0 +1,272 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// MaxReports is how many reloads a Reloader remembers
+const MaxReports = 50
+
+// settle is how long the file must be left alone before it is read again,
+// as editors save in several steps
+const settle = 250 * time.Millisecond
+
+// Report is the outcome of a reload
+type Report struct {
+	Time time.Time `json:"time"`
+	// Trigger is what asked for the reload, eg. SIGHUP
+	Trigger string   `json:"trigger"`
+	Changes []Change `json:"changes,omitempty"`
+	// Error is why the new configuration was rejected, the running one
+	// staying as it was
+	Error string `json:"error,omitempty"`
+}
+
+// Summary is the report on one line, for status bars
+func (r Report) Summary() string {
+	if r.Error != "" {
+		return "config rejected: " + strings.ReplaceAll(r.Error, "\n", "; ")
+	}
+	live, restart := 0, 0
+	for _, c := range r.Changes {
+		if c.Live() {
+			live++
+		} else {
+			restart++
+		}
+	}
+	s := "config reloaded: " + count(live, "change")
+	if restart > 0 {
+		s += fmt.Sprintf(", %d taking a restart", restart)
+	}
+	return s
+}
+
+// Reloader holds the configuration a node runs with, and reads it again
+// when asked or when the file changes. Changes are handed to the parts of
+// the node they concern, leaving the rest running.
+type Reloader struct {
+	load   func() (*Config, error)
+	logger *slog.Logger
+
+	// reloading is held through a reload, one at a time, and mu only while
+	// the fields below are read or written, so appliers can call Current
+	reloading   sync.Mutex
+	mu          sync.Mutex
+	current     *Config
+	next        int
+	appliers    map[int]Applier
+	subscribers map[int]chan Report
+	reports     []Report
+}
+
+// Applier brings a part of the node from one configuration to the next. It
+// is called only for reloads changing something, and may be called back
+// with the two swapped when another part fails to apply the change.
+type Applier func(prev, next *Config) error
+
+// NewReloader reloads with load, starting from current
+func NewReloader(current *Config, load func() (*Config, error)) *Reloader {
+	return &Reloader{
+		load:        load,
+		logger:      slog.New(slog.DiscardHandler),
+		current:     current,
+		appliers:    map[int]Applier{},
+		subscribers: map[int]chan Report{},
+	}
+}
+
+// SetLogger has Watch log the trouble it has watching the file
+func (r *Reloader) SetLogger(logger *slog.Logger) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logger = logger
+}
+
+// Current is the configuration running
+func (r *Reloader) Current() *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// OnApply has apply called on reloads until ctx is done. Appliers are
+// called in the order added.
+func (r *Reloader) OnApply(ctx context.Context, apply Applier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := r.next
+	r.next++
+	r.appliers[id] = apply
+	context.AfterFunc(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.appliers, id)
+	})
+}
+
+// Subscribe delivers the report of every reload until ctx is done. Reports
+// are dropped while the channel is full.
+func (r *Reloader) Subscribe(ctx context.Context) <-chan Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := r.next
+	r.next++
+	c := make(chan Report, 8)
+	r.subscribers[id] = c
+	context.AfterFunc(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.subscribers, id)
+		close(c)
+	})
+	return c
+}
+
+// Reports are the reloads so far, oldest first
+func (r *Reloader) Reports() []Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Report(nil), r.reports...)
+}
+
+// Reload reads the configuration again and applies what changed. An
+// invalid configuration, or one a part of the node fails to apply, is
+// rejected as a whole.
+func (r *Reloader) Reload(trigger string) Report {
+	r.reloading.Lock()
+	defer r.reloading.Unlock()
+
+	report := Report{Time: time.Now(), Trigger: trigger}
+	next, err := r.load()
+	if err == nil {
+		current := r.Current()
+		report.Changes = current.Diff(next)
+		err = r.apply(current, current.Keep(next), report.Changes)
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reports = append(r.reports, report)
+	if len(r.reports) > MaxReports {
+		r.reports = r.reports[len(r.reports)-MaxReports:]
+	}
+	for _, c := range r.subscribers {
+		select {
+		case c <- report:
+		default:
+		}
+	}
+	return report
+}
+
+// apply hands next to the appliers if any change can be applied live,
+// taking back what was applied if one fails. The appliers run without the
+// lock held, from a snapshot of those added.
+func (r *Reloader) apply(prev, next *Config, changes []Change) error {
+	live := false
+	for _, c := range changes {
+		live = live || c.Live()
+	}
+
+	appliers := []Applier{}
+	if live {
+		r.mu.Lock()
+		// in the order added, as later parts may build on earlier ones
+		for _, id := range slices.Sorted(maps.Keys(r.appliers)) {
+			appliers = append(appliers, r.appliers[id])
+		}
+		r.mu.Unlock()
+	}
+
+	for n, apply := range appliers {
+		if err := apply(prev, next); err != nil {
+			errs := []error{err}
+			for _, undo := range appliers[:n] {
+				errs = append(errs, undo(next, prev))
+			}
+			return errors.Join(errs...)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current = next
+	return nil
+}
+
+// Watch reloads when the file at path is written or the process gets
+// SIGHUP, until ctx is done. The directory is watched rather than the file,
+// as editors often replace files instead of writing them; a file that is
+// removed is left for SIGHUP to read once it is back. Errors watching the
+// file are logged, SIGHUP working on regardless.
+func (r *Reloader) Watch(ctx context.Context, path string) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	if path != "" {
+		w, err := fsnotify.NewWatcher()
+		if err != nil {
+			return err
+		}
+		defer w.Close()
+		// without the directory there is no file to watch, only SIGHUP
+		if err := w.Add(filepath.Dir(path)); err == nil {
+			events, errs = w.Events, w.Errors
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	var settled <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hup:
+			r.Reload("SIGHUP")
+		case e, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if filepath.Clean(e.Name) == filepath.Clean(path) && !e.Has(fsnotify.Chmod) {
+				settled = time.After(settle)
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			r.mu.Lock()
+			logger := r.logger
+			r.mu.Unlock()
+			logger.Warn("watching config file", "path", path, "err", err)
+		case <-settled:
+			settled = nil
+			if _, err := os.Stat(path); err == nil {
+				r.Reload("file changed")
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const reloadBase = `version: 1
+interfaces:
+  - name: tcp0
+    kind: tcp
+  - name: tcp1
+    kind: tcp
+routing:
+  default: tcp0
+`
+
+func TestDiff(t *testing.T) {
+	for _, tc := range []struct {
+		name, next string
+		want       []string
+	}{
+		{name: "nothing", next: reloadBase},
+		{
+			name: "routing",
+			next: strings.Replace(reloadBase, "default: tcp0", "default: tcp1", 1),
+			want: []string{"routing.default changed: tcp0 → tcp1"},
+		},
+		{
+			name: "interface removed",
+			next: strings.Replace(reloadBase, "  - name: tcp1\n    kind: tcp\n", "", 1),
+			want: []string{"interfaces.tcp1 removed"},
+		},
+		{
+			name: "levels",
+			next: reloadBase + "logging:\n  levels: debug\n",
+			want: []string{"logging.levels changed: none → debug"},
+		},
+		{
+			name: "restart",
+			next: reloadBase + "api:\n  docs:\n    listen: :8001\n",
+			want: []string{"api.docs changed: listen  → :8001 (takes a restart)"},
+		},
+		{
+			name: "log file",
+			next: reloadBase + "logging:\n  levels: debug\n  file: node.log\n",
+			want: []string{
+				"logging.levels changed: none → debug",
+				"logging changed: file  → node.log (takes a restart)",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prev := mustParse(t, reloadBase)
+			changes := prev.Diff(mustParse(t, tc.next))
+			got := []string{}
+			for _, c := range changes {
+				got = append(got, c.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				t.Errorf("changes\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tc.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestKeep(t *testing.T) {
+	prev := mustParse(t, reloadBase)
+	next := mustParse(t, strings.Replace(reloadBase, "default: tcp0", "default: tcp1", 1)+
+		"api:\n  docs:\n    listen: :8001\nlogging:\n  levels: debug\n  file: node.log\n")
+	kept := prev.Keep(next)
+	if kept.Routing.Default != "tcp1" {
+		t.Errorf("routing.default = %q, want the new tcp1", kept.Routing.Default)
+	}
+	if kept.Logging.Levels != "debug" {
+		t.Errorf("logging.levels = %q, want the new debug", kept.Logging.Levels)
+	}
+	if kept.API.Docs.Listen != "" {
+		t.Errorf("api.docs.listen = %q, want it left as it was", kept.API.Docs.Listen)
+	}
+	if kept.Logging.File != "" {
+		t.Errorf("logging.file = %q, want it left as it was", kept.Logging.File)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path, r := fileReloader(t, reloadBase)
+	writeFile(t, path, strings.Replace(reloadBase, "default: tcp0", "default: tcp1", 1))
+
+	seen := ""
+	r.OnApply(t.Context(), func(prev, next *Config) error {
+		// appliers may look at the reloader, as it is not locked
+		if r.Current() != prev {
+			t.Error("Current is not the configuration being left")
+		}
+		r.Reports()
+		seen = prev.Routing.Default + " → " + next.Routing.Default
+		return nil
+	})
+	reports := r.Subscribe(t.Context())
+
+	report := reload(t, r)
+	if report.Error != "" {
+		t.Fatalf("rejected: %s", report.Error)
+	}
+	if seen != "tcp0 → tcp1" {
+		t.Errorf("applied %q, want tcp0 → tcp1", seen)
+	}
+	if got := r.Current().Routing.Default; got != "tcp1" {
+		t.Errorf("routing.default = %q, want tcp1", got)
+	}
+	if got := <-reports; got.Summary() != "config reloaded: 1 change" {
+		t.Errorf("subscribed report = %q", got.Summary())
+	}
+	if got := r.Reports(); len(got) != 1 || got[0].Trigger != "test" {
+		t.Errorf("reports = %+v", got)
+	}
+}
+
+func TestReloadRestartOnly(t *testing.T) {
+	path, r := fileReloader(t, reloadBase)
+	writeFile(t, path, reloadBase+"api:\n  docs:\n    listen: :8001\n")
+
+	r.OnApply(t.Context(), func(prev, next *Config) error {
+		t.Error("applied a change taking a restart")
+		return nil
+	})
+	report := reload(t, r)
+	if report.Summary() != "config reloaded: 0 changes, 1 taking a restart" {
+		t.Errorf("report = %q", report.Summary())
+	}
+	if got := r.Current().API.Docs.Listen; got != "" {
+		t.Errorf("api.docs.listen = %q, want it left to the restart", got)
+	}
+}
+
+func TestReloadRollsBack(t *testing.T) {
+	path, r := fileReloader(t, reloadBase)
+	before := r.Current()
+	writeFile(t, path, strings.Replace(reloadBase, "default: tcp0", "default: tcp1", 1))
+
+	calls := []string{}
+	r.OnApply(t.Context(), func(prev, next *Config) error {
+		calls = append(calls, "first "+prev.Routing.Default+" → "+next.Routing.Default)
+		return nil
+	})
+	r.OnApply(t.Context(), func(prev, next *Config) error {
+		calls = append(calls, "second "+prev.Routing.Default+" → "+next.Routing.Default)
+		return errors.New("radio busy")
+	})
+	r.OnApply(t.Context(), func(prev, next *Config) error {
+		calls = append(calls, "third")
+		return nil
+	})
+
+	report := reload(t, r)
+	if report.Error != "radio busy" {
+		t.Errorf("error = %q, want radio busy", report.Error)
+	}
+	want := []string{"first tcp0 → tcp1", "second tcp0 → tcp1", "first tcp1 → tcp0"}
+	if strings.Join(calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls\n%s\nwant\n%s", strings.Join(calls, "\n"), strings.Join(want, "\n"))
+	}
+	if r.Current() != before {
+		t.Error("Current changed by a rejected reload")
+	}
+}
+
+func TestReloadRejectsInvalid(t *testing.T) {
+	path, r := fileReloader(t, reloadBase)
+	before := r.Current()
+	r.OnApply(t.Context(), func(prev, next *Config) error {
+		t.Error("applied an invalid configuration")
+		return nil
+	})
+
+	writeFile(t, path, strings.Replace(reloadBase, "default: tcp0", "default: wifi0", 1))
+	report := reload(t, r)
+	want := `multiband.yaml:8:3: routing.default: no interface named "wifi0"`
+	if !strings.HasSuffix(report.Error, want) {
+		t.Errorf("error = %q, want it to end %q", report.Error, want)
+	}
+	if r.Current() != before {
+		t.Error("Current changed by an invalid file")
+	}
+}
+
+// fileReloader reloads the file it writes raw to, validating it as the
+// node does
+func fileReloader(t *testing.T, raw string) (string, *Reloader) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), Filename)
+	writeFile(t, path, raw)
+	load := func() (*Config, error) {
+		c, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		return c, c.Validate()
+	}
+	c, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, NewReloader(c, load)
+}
+
+// reload reloads, failing the test rather than hanging if it deadlocks
+func reload(t *testing.T, r *Reloader) Report {
+	t.Helper()
+	done := make(chan Report, 1)
+	go func() { done <- r.Reload("test") }()
+	select {
+	case report := <-done:
+		return report
+	case <-time.After(5 * time.Second):
+		t.Fatal("reload did not finish")
+		return Report{}
+	}
+}
+
+func writeFile(t *testing.T, path, raw string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(raw), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustParse(t *testing.T, raw string) *Config {
+	t.Helper()
+	c, err := Parse(Filename, []byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// SchemaID names the schema, as editors refer to it
+const SchemaID = "https://codeberg.org/splitringresonator/multiband/config/v1.schema.json"
+
+// Schema is the JSON Schema of the config file, for editors to complete and
+// check it with. It is generated from the Config type and its tags.
+func Schema() ([]byte, error) {
+	s := schemaOf(reflect.TypeOf(Config{}))
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["$id"] = SchemaID
+	s["title"] = "multiband configuration"
+	s["required"] = []string{"version"}
+	props := s["properties"].(map[string]any)
+	props["version"].(map[string]any)["const"] = Version
+	return json.MarshalIndent(s, "", "  ")
+}
+
+func schemaOf(t reflect.Type) map[string]any {
+	if t == durationType {
+		return map[string]any{
+			"type":    "string",
+			"pattern": `^(\d+(\.\d+)?(ns|us|µs|ms|s|m|h))+$`,
+		}
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		props := map[string]any{}
+		required := []string{}
+		for i := range t.NumField() {
+			f := t.Field(i)
+			name := yamlName(f)
+			if name == "" {
+				continue
+			}
+			p := schemaOf(f.Type)
+			if doc := f.Tag.Get("doc"); doc != "" {
+				p["description"] = doc
+			}
+			if enum := f.Tag.Get("enum"); enum != "" {
+				values := []any{}
+				for _, v := range strings.Split(enum, ",") {
+					if n, err := strconv.Atoi(v); err == nil && p["type"] == "integer" {
+						values = append(values, n)
+					} else {
+						values = append(values, v)
+					}
+				}
+				p["enum"] = values
+			}
+			props[name] = p
+			// fields that cannot be left out, like the name of an interface
+			if !strings.Contains(f.Tag.Get("yaml"), "omitempty") && name != "version" {
+				required = append(required, name)
+			}
+		}
+		s := map[string]any{"type": "object", "properties": props, "additionalProperties": false}
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	return map[string]any{"type": "integer"}
+}
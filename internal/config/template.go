@@ -0,0 +1,85 @@
+package config
+
+// Template is the config file written by multiband config init: every
+// section, commented out but for the version, to be filled in
+const Template = `# yaml-language-server: $schema=` + SchemaFilename + `
+#
+# multiband configuration. Every setting can be overridden by an environment
+# variable named after it, eg. MULTIBAND_API_DOCS_LISTEN for api.docs.listen,
+# and the settings of a command by its flags. Check this file with
+# multiband config validate.
+version: 1
+
+# identities the node can speak as
+#identities:
+#  - name: field-team
+#    default: true
+#    # path: ~/.local/share/multiband/identities/field-team
+
+# radios and links the node talks over
+#interfaces:
+#  - name: lora0
+#    kind: lora
+#    frequency: 868100000
+#    bandwidth: 125000
+#    spreading_factor: 9
+#    coding_rate: 5
+#    tx_power: 14
+#    duty_cycle: 0.01
+#    options:
+#      port: /dev/ttyUSB0
+#  - name: uplink
+#    kind: tcp
+#    options:
+#      target_host: reticulum.example.net
+#      target_port: "4242"
+
+# which interfaces messages leave on, the first matching rule winning
+#routing:
+#  default: auto
+#  rules:
+#    - peer: hq
+#      via: [uplink, lora0]
+
+# where the node keeps its files
+#storage:
+#  data: ~/.local/share/multiband
+#  state: ~/.local/state/multiband
+
+# listeners for operators and clients
+#api:
+#  docs:
+#    listen: 127.0.0.1:8080
+#    token: change-me
+#  ssh:
+#    listen: :2222
+#  metrics:
+#    listen: 127.0.0.1:9464
+
+# built-in documentation
+#docs:
+#  resume: true
+
+# what the node logs, and where
+#logging:
+#  levels: iface=debug,queue=info,warn
+#  format: logfmt
+#  file: ~/.local/state/multiband/multiband.log
+#  max_size: 1024
+#  max_files: 3
+
+# where traces of messages through the node are exported
+#tracing:
+#  exporter: otlp
+#  endpoint: http://localhost:4318
+
+# rules raising alerts in the console
+#alerts:
+#  - name: HQ
+#    when: message from @hq
+#  - when: keyword SOS
+#    hook: notify-send "$MULTIBAND_ALERT_TEXT"
+#  - when: interface down >5m
+#  - when: battery <20%
+#    silent: true
+`
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"codeberg.org/splitringresonator/multiband/internal/alert"
+	"codeberg.org/splitringresonator/multiband/internal/logging"
+	"codeberg.org/splitringresonator/multiband/internal/tracing"
+)
+
+// Kinds are the interface drivers known
+var Kinds = []string{"lora", "tcp", "serial"}
+
+// Bandwidths are the LoRa bandwidths radios can be set to, in Hz
+var Bandwidths = []int{7800, 10400, 15600, 20800, 31250, 41700, 62500, 125000, 250000, 500000}
+
+// RenderModes are how docs can be rendered
+var RenderModes = []string{"ansi", "plain", "html", "markdown"}
+
+// Validate checks the configuration makes sense as a whole, returning an
+// *Error listing every problem found
+func (c *Config) Validate() error {
+	problems := []Problem{}
+	add := func(path, format string, args ...any) {
+		problems = append(problems, c.problem(path, format, args...))
+	}
+
+	switch {
+	case c.Version == 0:
+		add("version", "missing, add version: %d", Version)
+	case c.Version > Version:
+		add("version", "%d is newer than this build reads, upgrade multiband or write version: %d", c.Version, Version)
+	case c.Version < 0:
+		add("version", "expected %d", Version)
+	}
+
+	identities := map[string]bool{}
+	defaults := 0
+	for n, id := range c.Identities {
+		at := fmt.Sprintf("identities[%d]", n)
+		switch {
+		case id.Name == "":
+			add(at, "name missing")
+		case identities[id.Name]:
+			add(at+".name", "%q is used by another identity", id.Name)
+		}
+		identities[id.Name] = true
+		if id.Default {
+			defaults++
+			if defaults > 1 {
+				add(at+".default", "only one identity can be the default")
+			}
+		}
+	}
+
+	ifaces := map[string]bool{}
+	for n, i := range c.Interfaces {
+		at := fmt.Sprintf("interfaces[%d]", n)
+		switch {
+		case i.Name == "":
+			add(at, "name missing")
+		case ifaces[i.Name]:
+			add(at+".name", "%q is used by another interface", i.Name)
+		}
+		ifaces[i.Name] = true
+
+		if !slices.Contains(Kinds, i.Kind) {
+			if i.Kind == "" {
+				add(at, "kind missing, expected one of %s", strings.Join(Kinds, ", "))
+			} else {
+				add(at+".kind", "unknown kind %q, expected one of %s", i.Kind, strings.Join(Kinds, ", "))
+			}
+		}
+		if i.DutyCycle < 0 || i.DutyCycle > 1 {
+			add(at+".duty_cycle", "%g is not a fraction between 0 and 1, eg. 0.01 for 1%%", i.DutyCycle)
+		}
+
+		if i.Kind != "lora" {
+			for _, f := range []struct {
+				name string
+				set  bool
+			}{
+				{"frequency", i.Frequency != 0},
+				{"bandwidth", i.Bandwidth != 0},
+				{"spreading_factor", i.SpreadingFactor != 0},
+				{"coding_rate", i.CodingRate != 0},
+				{"tx_power", i.TxPower != 0},
+			} {
+				if f.set {
+					add(at+"."+f.name, "only lora interfaces have a %s", strings.ReplaceAll(f.name, "_", " "))
+				}
+			}
+			continue
+		}
+		if i.Frequency < 137_000_000 || i.Frequency > 1_020_000_000 {
+			add(at+".frequency", "%d Hz is outside what LoRa radios tune to, 137 to 1020 MHz", i.Frequency)
+		}
+		if !slices.Contains(Bandwidths, i.Bandwidth) {
+			bws := []string{}
+			for _, bw := range Bandwidths {
+				bws = append(bws, strconv.Itoa(bw))
+			}
+			add(at+".bandwidth", "%d Hz is not a LoRa bandwidth, expected one of %s", i.Bandwidth, strings.Join(bws, ", "))
+		}
+		if i.SpreadingFactor < 5 || i.SpreadingFactor > 12 {
+			add(at+".spreading_factor", "%d is not between 5 and 12", i.SpreadingFactor)
+		}
+		if i.CodingRate < 5 || i.CodingRate > 8 {
+			add(at+".coding_rate", "%d is not between 5 and 8, for 4/5 to 4/8", i.CodingRate)
+		}
+		if i.TxPower < -9 || i.TxPower > 30 {
+			add(at+".tx_power", "%d dBm is not between -9 and 30", i.TxPower)
+		}
+	}
+
+	// routes may only name interfaces that exist
+	via := func(path, name string) {
+		if !ifaces[name] {
+			add(path, "no interface named %q", name)
+		}
+	}
+	if c.Routing.Default != "" && c.Routing.Default != "auto" {
+		via("routing.default", c.Routing.Default)
+	}
+	for n, r := range c.Routing.Rules {
+		at := fmt.Sprintf("routing.rules[%d]", n)
+		if r.Peer == "" {
+			add(at, "peer missing, use * for any")
+		}
+		if len(r.Via) == 0 {
+			add(at, "via missing")
+		}
+		for v, name := range r.Via {
+			via(fmt.Sprintf("%s.via[%d]", at, v), name)
+		}
+	}
+
+	for _, api := range []struct {
+		at string
+		l  Listener
+	}{{"api.docs", c.API.Docs}, {"api.metrics", c.API.Metrics}} {
+		at, l := api.at, api.l
+		if (l.TLSCert == "") != (l.TLSKey == "") {
+			add(at, "tls_cert and tls_key go together")
+		}
+		if l.BasicAuth != "" && !strings.Contains(l.BasicAuth, ":") {
+			add(at+".basic_auth", "expected user:password")
+		}
+		if l.ShutdownTimeout < 0 {
+			add(at+".shutdown_timeout", "cannot be negative")
+		}
+	}
+
+	if c.Docs.Render != "" && !slices.Contains(RenderModes, c.Docs.Render) {
+		add("docs.render", "unknown mode %q, expected one of %s", c.Docs.Render, strings.Join(RenderModes, ", "))
+	}
+	if c.Docs.Width < 0 {
+		add("docs.width", "cannot be negative")
+	}
+
+	if _, err := logging.ParseLevels(c.Logging.Levels); err != nil {
+		add("logging.levels", "%s", err)
+	}
+	if c.Logging.Format != "" && !slices.Contains(logging.Formats, c.Logging.Format) {
+		add("logging.format", "unknown format %q, expected one of %s", c.Logging.Format, strings.Join(logging.Formats, ", "))
+	}
+	if c.Logging.MaxSize < 0 {
+		add("logging.max_size", "cannot be negative")
+	}
+	if c.Logging.MaxFiles < 0 {
+		add("logging.max_files", "cannot be negative")
+	}
+
+	if e := c.Tracing.Exporter; e != "" && !slices.Contains(tracing.Exporters, e) {
+		add("tracing.exporter", "unknown exporter %q, expected one of %s", e, strings.Join(tracing.Exporters, ", "))
+	}
+	if e := c.Tracing.Endpoint; e != "" {
+		if u, err := url.Parse(e); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("tracing.endpoint", "expected an http or https URL, eg. %s", tracing.DefaultEndpoint)
+		}
+	}
+
+	for n, r := range c.Alerts {
+		if err := alert.Check(r); err != nil {
+			add(fmt.Sprintf("alerts[%d].when", n), "%s", err)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &Error{File: c.path, Problems: problems}
+	}
+	return nil
+}
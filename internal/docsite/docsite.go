@@ -0,0 +1,225 @@
+package docsite
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+
+	"codeberg.org/splitringresonator/multiband/internal/preprocess"
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+	"gopkg.in/yaml.v3"
+)
+
+// Page is a single markdown document found in a docs filesystem
+type Page struct {
+	Path  string // slash separated path within the filesystem, eg. recipe/getting-started.md
+	Title string
+	Raw   []byte
+}
+
+// Pages walks fsys and returns every markdown document in lexical path order
+func Pages(fsys fs.FS) ([]Page, error) {
+	pages := []Page{}
+
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".md") {
+			return nil
+		}
+
+		raw, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+
+		pages = append(pages, Page{
+			Path:  p,
+			Title: Title(raw, p),
+			Raw:   raw,
+		})
+		return nil
+	})
+
+	return pages, err
+}
+
+// Meta is the YAML front matter a document may start with, as written by
+// `docgen -frontmatter`
+type Meta struct {
+	Title       string `yaml:"title"`
+	Slug        string `yaml:"slug"`
+	Description string `yaml:"description"`
+}
+
+// FrontMatter splits YAML front matter delimited by --- lines off raw. When
+// there is none, or it does not parse, meta is empty and body is raw.
+func FrontMatter(raw []byte) (meta Meta, body []byte) {
+	rest, ok := bytes.CutPrefix(raw, []byte("---\n"))
+	if !ok {
+		return meta, raw
+	}
+	head, body, ok := bytes.Cut(rest, []byte("\n---\n"))
+	if !ok {
+		return meta, raw
+	}
+	if err := yaml.Unmarshal(head, &meta); err != nil {
+		return Meta{}, raw
+	}
+	return meta, body
+}
+
+// WordCount counts whitespace separated words in the body of a document
+func WordCount(raw []byte) int {
+	_, body := FrontMatter(raw)
+	return len(bytes.Fields(body))
+}
+
+// Title returns the front matter title, or the text of the first heading in
+// raw, falling back to the file name
+func Title(raw []byte, p string) string {
+	meta, body := FrontMatter(raw)
+	if meta.Title != "" {
+		return meta.Title
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(body))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, "#") {
+			if t := strings.TrimSpace(strings.TrimLeft(line, "#")); t != "" {
+				return t
+			}
+		}
+	}
+	return strings.TrimSuffix(path.Base(p), ".md")
+}
+
+// Renderer converts markdown documents to HTML. The zero value renders the
+// same way `docs serve` always has.
+type Renderer struct {
+	// LinkExt replaces the .md extension of relative links when set, eg. ".html"
+	LinkExt string
+	// XHTML emits well formed XHTML without named entities, as required by EPUB
+	XHTML bool
+}
+
+// Render returns the HTML body fragment for raw markdown
+func (r Renderer) Render(raw []byte) []byte {
+	// parsers are single use, so build a fresh one every time
+	p := parser.NewWithExtensions(parser.CommonExtensions | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock)
+	_, body := FrontMatter(raw)
+	doc := p.Parse(preprocess.Markdown(body, preprocess.Options{Diagrams: preprocess.SVG}))
+
+	if r.LinkExt != "" {
+		ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+			if link, ok := node.(*ast.Link); ok && entering {
+				link.Destination = []byte(RewriteLink(string(link.Destination), r.LinkExt))
+			}
+			return ast.GoToNext
+		})
+	}
+
+	flags := html.CommonFlags | html.HrefTargetBlank
+	if r.XHTML {
+		flags = html.UseXHTML
+	}
+
+	return markdown.Render(doc, html.NewRenderer(html.RendererOptions{Flags: flags}))
+}
+
+// RewriteLink swaps the .md extension of a relative link for ext, keeping any
+// query or fragment. Absolute URLs are returned untouched.
+func RewriteLink(link, ext string) string {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "" || u.Host != "" || !strings.HasSuffix(u.Path, ".md") {
+		return link
+	}
+	u.Path = strings.TrimSuffix(u.Path, ".md") + ext
+	return u.String()
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width">
+<title>{{ .Title }}</title>
+</head>
+<body>
+<nav><a href="{{ .Root }}">index</a></nav>
+<main>
+{{ .Body }}
+</main>
+</body>
+</html>
+`))
+
+// PageData is what gets handed to the page template
+type PageData struct {
+	Title string
+	// Root is the href of the docs index, relative to the page being rendered
+	Root string
+	Body template.HTML
+}
+
+// WritePage wraps a rendered body in the shared page template
+func WritePage(w io.Writer, data PageData) error {
+	return pageTemplate.Execute(w, data)
+}
+
+// RelRoot returns the relative href from the page at p back to the root of the tree
+func RelRoot(p string) string {
+	depth := strings.Count(p, "/")
+	if depth == 0 {
+		return "./"
+	}
+	return strings.Repeat("../", depth)
+}
+
+// Revision records the last commit that touched a document
+type Revision struct {
+	Revision string `json:"revision"`
+	Date     string `json:"date"`
+}
+
+// ParseRevisions decodes the manifest written by `docgen -format revisions`,
+// keyed by document path
+func ParseRevisions(raw []byte) (map[string]Revision, error) {
+	revs := map[string]Revision{}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return revs, nil
+	}
+	err := json.Unmarshal(raw, &revs)
+	return revs, err
+}
+
+// ErrNoPage is returned by Find when no document matches
+var ErrNoPage = errors.New("no such document")
+
+// Find looks a document up by path, with or without the leading slash and
+// .md extension, eg. architecture/api for architecture/api.md
+func Find(pages []Page, name string) (Page, error) {
+	p := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if !strings.HasSuffix(p, ".md") {
+		p += ".md"
+	}
+	for _, page := range pages {
+		if page.Path == p {
+			return page, nil
+		}
+	}
+	return Page{}, fmt.Errorf("%w: %s", ErrNoPage, name)
+}
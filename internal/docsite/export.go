@@ -0,0 +1,394 @@
+package docsite
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatHTML     Format = "html"
+	FormatMarkdown Format = "markdown"
+	FormatEPUB     Format = "epub"
+)
+
+// Formats lists every supported export format
+var Formats = []Format{FormatHTML, FormatMarkdown, FormatEPUB}
+
+// EPUBFilename is the name of the book written into the output directory
+const EPUBFilename = "multiband-docs.epub"
+
+type ExportOptions struct {
+	Format Format
+	// Title of the index page and book
+	Title string
+	// BaseURL is prefixed to every location in sitemap.xml. Sitemaps only
+	// take absolute URLs, so none is written without it.
+	BaseURL string
+	// Modified is recorded in EPUB metadata and zip headers. Leave it fixed
+	// (eg. the build time) so repeated exports are byte for byte identical.
+	Modified time.Time
+}
+
+// Export renders every document in fsys into the directory out. Output is
+// deterministic for a given fsys and options: files are written in lexical
+// order, with fixed permissions and no timestamps beyond opts.Modified.
+func Export(fsys fs.FS, out string, opts ExportOptions) error {
+	pages, err := Pages(fsys)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		return err
+	}
+
+	switch opts.Format {
+	case FormatHTML:
+		return exportHTML(fsys, pages, out, opts)
+	case FormatMarkdown:
+		return exportMarkdown(fsys, pages, out, opts)
+	case FormatEPUB:
+		return exportEPUB(pages, out, opts)
+	default:
+		return fmt.Errorf("unknown export format: %q", opts.Format)
+	}
+}
+
+func writeFile(out, name string, data []byte) error {
+	dst := filepath.Join(out, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0o644)
+}
+
+// copyAssets copies everything that is not markdown verbatim, so images and
+// other attachments referenced by pages keep working
+func copyAssets(fsys fs.FS, out string) error {
+	return fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(p, ".md") {
+			return nil
+		}
+		raw, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		return writeFile(out, p, raw)
+	})
+}
+
+func withExt(p, ext string) string {
+	return strings.TrimSuffix(p, ".md") + ext
+}
+
+func exportHTML(fsys fs.FS, pages []Page, out string, opts ExportOptions) error {
+	r := Renderer{LinkExt: ".html"}
+	locs := []string{"index.html"}
+
+	for _, p := range pages {
+		var buf bytes.Buffer
+		if err := WritePage(&buf, PageData{
+			Title: p.Title,
+			Root:  RelRoot(p.Path) + "index.html",
+			Body:  template.HTML(r.Render(p.Raw)), //nolint:gosec
+		}); err != nil {
+			return err
+		}
+		name := withExt(p.Path, ".html")
+		if err := writeFile(out, name, buf.Bytes()); err != nil {
+			return err
+		}
+		locs = append(locs, name)
+	}
+
+	var buf bytes.Buffer
+	if err := WritePage(&buf, PageData{
+		Title: opts.Title,
+		Root:  "index.html",
+		Body:  indexHTML(opts.Title, pages, ".html"),
+	}); err != nil {
+		return err
+	}
+	if err := writeFile(out, "index.html", buf.Bytes()); err != nil {
+		return err
+	}
+
+	if err := writeSitemap(out, opts.BaseURL, locs); err != nil {
+		return err
+	}
+
+	return copyAssets(fsys, out)
+}
+
+func exportMarkdown(fsys fs.FS, pages []Page, out string, opts ExportOptions) error {
+	locs := []string{"index.md"}
+
+	for _, p := range pages {
+		if err := writeFile(out, p.Path, p.Raw); err != nil {
+			return err
+		}
+		locs = append(locs, p.Path)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s\n", opts.Title)
+	for _, group := range groupPages(pages) {
+		fmt.Fprintf(&buf, "\n## %s\n\n", group.name)
+		for _, p := range group.pages {
+			fmt.Fprintf(&buf, "* [%s](%s)\n", p.Title, p.Path)
+		}
+	}
+	if err := writeFile(out, "index.md", buf.Bytes()); err != nil {
+		return err
+	}
+
+	if err := writeSitemap(out, opts.BaseURL, locs); err != nil {
+		return err
+	}
+
+	return copyAssets(fsys, out)
+}
+
+type pageGroup struct {
+	name  string
+	pages []Page
+}
+
+// groupPages buckets pages by their top level directory, preserving order
+func groupPages(pages []Page) []pageGroup {
+	groups := []pageGroup{}
+	for _, p := range pages {
+		name := "."
+		if dir, _, ok := strings.Cut(p.Path, "/"); ok {
+			name = dir
+		}
+		if len(groups) == 0 || groups[len(groups)-1].name != name {
+			groups = append(groups, pageGroup{name: name})
+		}
+		groups[len(groups)-1].pages = append(groups[len(groups)-1].pages, p)
+	}
+	return groups
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<h1>{{ .Title }}</h1>
+{{ range .Groups }}<h2>{{ .Name }}</h2>
+<ul>
+{{ range .Links }}<li><a href="{{ .Href }}">{{ .Title }}</a></li>
+{{ end }}</ul>
+{{ end }}`))
+
+func indexHTML(title string, pages []Page, ext string) template.HTML {
+	type link struct{ Href, Title string }
+	type group struct {
+		Name  string
+		Links []link
+	}
+
+	data := struct {
+		Title  string
+		Groups []group
+	}{Title: title}
+
+	for _, g := range groupPages(pages) {
+		grp := group{Name: g.name}
+		for _, p := range g.pages {
+			grp.Links = append(grp.Links, link{Href: withExt(p.Path, ext), Title: p.Title})
+		}
+		data.Groups = append(data.Groups, grp)
+	}
+
+	var buf bytes.Buffer
+	// the template is static and the data is plain strings, so this cannot fail
+	_ = indexTemplate.Execute(&buf, data)
+	return template.HTML(buf.String()) //nolint:gosec
+}
+
+// writeSitemap lists locs in sitemap.xml, under baseURL. Without one there
+// is no sitemap.
+func writeSitemap(out, baseURL string, locs []string) error {
+	if baseURL == "" {
+		return nil
+	}
+	type urlEntry struct {
+		Loc string `xml:"loc"`
+	}
+	sitemap := struct {
+		XMLName xml.Name   `xml:"urlset"`
+		XMLNS   string     `xml:"xmlns,attr"`
+		URLs    []urlEntry `xml:"url"`
+	}{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+
+	for _, loc := range locs {
+		sitemap.URLs = append(sitemap.URLs, urlEntry{Loc: joinURL(baseURL, loc)})
+	}
+
+	raw, err := xml.MarshalIndent(sitemap, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(out, "sitemap.xml", append([]byte(xml.Header), append(raw, '\n')...))
+}
+
+func joinURL(base, p string) string {
+	return strings.TrimSuffix(base, "/") + "/" + p
+}
+
+const (
+	epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+	epubChapter = `<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>{{ .Title }}</title></head>
+<body>
+{{ .Body }}
+</body>
+</html>
+`
+	epubNav = `<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>{{ .Title }}</title></head>
+<body>
+<nav epub:type="toc" id="toc">
+<h1>{{ .Title }}</h1>
+<ol>
+{{ range .Chapters }}<li><a href="{{ .Href }}">{{ .Title }}</a></li>
+{{ end }}</ol>
+</nav>
+</body>
+</html>
+`
+	epubPackage = `<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:identifier id="uid">{{ .ID }}</dc:identifier>
+<dc:title>{{ .Title }}</dc:title>
+<dc:language>en</dc:language>
+<meta property="dcterms:modified">{{ .Modified }}</meta>
+</metadata>
+<manifest>
+<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+{{ range .Chapters }}<item id="{{ .ID }}" href="{{ .Href }}" media-type="application/xhtml+xml"/>
+{{ end }}</manifest>
+<spine>
+{{ range .Chapters }}<itemref idref="{{ .ID }}"/>
+{{ end }}</spine>
+</package>
+`
+)
+
+var (
+	epubChapterTemplate = template.Must(template.New("chapter").Parse(epubChapter))
+	epubNavTemplate     = template.Must(template.New("nav").Parse(epubNav))
+	epubPackageTemplate = template.Must(template.New("package").Parse(epubPackage))
+)
+
+func exportEPUB(pages []Page, out string, opts ExportOptions) error {
+	type chapter struct {
+		ID, Href, Title string
+		Body            template.HTML
+	}
+
+	r := Renderer{LinkExt: ".xhtml", XHTML: true}
+	sum := sha256.New()
+	chapters := []chapter{}
+	for i, p := range pages {
+		sum.Write([]byte(p.Path))
+		sum.Write(p.Raw)
+		chapters = append(chapters, chapter{
+			ID:    fmt.Sprintf("ch%03d", i),
+			Href:  withExt(p.Path, ".xhtml"),
+			Title: p.Title,
+			Body:  template.HTML(r.Render(p.Raw)), //nolint:gosec
+		})
+	}
+
+	modified := opts.Modified
+	if modified.IsZero() {
+		// earliest time representable in a zip header
+		modified = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name string, method uint16, render func(io.Writer) error) error {
+		h := &zip.FileHeader{Name: name, Method: method, Modified: modified.UTC()}
+		if name == "mimetype" {
+			// a time takes an extra field, which readers refuse on the
+			// mimetype
+			h.Modified = time.Time{}
+		}
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			return err
+		}
+		return render(w)
+	}
+	// html/template escapes processing instructions, so the XML declaration
+	// is written ahead of the templated documents
+	xmlDoc := func(t *template.Template, data any) func(io.Writer) error {
+		return func(w io.Writer) error {
+			if _, err := io.WriteString(w, xml.Header); err != nil {
+				return err
+			}
+			return t.Execute(w, data)
+		}
+	}
+	static := func(s string) func(io.Writer) error {
+		return func(w io.Writer) error {
+			_, err := io.WriteString(w, s)
+			return err
+		}
+	}
+
+	// the mimetype entry must come first and be stored uncompressed
+	if err := add("mimetype", zip.Store, static("application/epub+zip")); err != nil {
+		return err
+	}
+	if err := add("META-INF/container.xml", zip.Deflate, static(epubContainer)); err != nil {
+		return err
+	}
+	if err := add("OEBPS/content.opf", zip.Deflate, xmlDoc(epubPackageTemplate, map[string]any{
+		"ID":       fmt.Sprintf("urn:sha256:%x", sum.Sum(nil)),
+		"Title":    opts.Title,
+		"Modified": modified.UTC().Format(time.RFC3339),
+		"Chapters": chapters,
+	})); err != nil {
+		return err
+	}
+	if err := add("OEBPS/nav.xhtml", zip.Deflate, xmlDoc(epubNavTemplate, map[string]any{
+		"Title":    opts.Title,
+		"Chapters": chapters,
+	})); err != nil {
+		return err
+	}
+	for _, ch := range chapters {
+		if err := add(path.Join("OEBPS", ch.Href), zip.Deflate, xmlDoc(epubChapterTemplate, ch)); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	return writeFile(out, EPUBFilename, buf.Bytes())
+}
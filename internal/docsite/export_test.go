@@ -0,0 +1,204 @@
+package docsite
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func exportFS() fstest.MapFS {
+	return fstest.MapFS{
+		"index.md":        {Data: []byte("# Welcome\n\nStart with [setup](guide/setup.md#first) & read on.\n")},
+		"guide/setup.md":  {Data: []byte("# Setup\n\n![radio](../media/radio.png)\n\nBack to [the start](../index.md).\n")},
+		"media/radio.png": {Data: []byte("\x89PNG")},
+	}
+}
+
+func export(t *testing.T, format Format, baseURL string) string {
+	t.Helper()
+	out := t.TempDir()
+	err := Export(exportFS(), out, ExportOptions{
+		Format:   format,
+		Title:    "multiband",
+		BaseURL:  baseURL,
+		Modified: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func readOut(t *testing.T, out, name string) string {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(raw)
+}
+
+func TestExportHTML(t *testing.T) {
+	out := export(t, FormatHTML, "https://docs.example/multiband")
+
+	for _, tc := range []struct{ file, want string }{
+		{"index.html", `href="guide/setup.html"`},
+		{"index.md.html", ""},
+		{"guide/setup.html", `href="../index.html"`},
+		{"guide/setup.html", `src="../media/radio.png"`},
+		{"media/radio.png", "\x89PNG"},
+		{"sitemap.xml", "<loc>https://docs.example/multiband/guide/setup.html</loc>"},
+	} {
+		if tc.want == "" {
+			if _, err := os.Stat(filepath.Join(out, tc.file)); err == nil {
+				t.Errorf("%s written", tc.file)
+			}
+			continue
+		}
+		if got := readOut(t, out, tc.file); !strings.Contains(got, tc.want) {
+			t.Errorf("%s has no %s:\n%s", tc.file, tc.want, got)
+		}
+	}
+	if got := readOut(t, out, "guide/setup.html"); strings.Contains(got, ".md") {
+		t.Errorf("link to markdown left in:\n%s", got)
+	}
+}
+
+func TestExportMarkdown(t *testing.T) {
+	out := export(t, FormatMarkdown, "")
+
+	if got := readOut(t, out, "guide/setup.md"); got != string(exportFS()["guide/setup.md"].Data) {
+		t.Errorf("page rewritten:\n%s", got)
+	}
+	if got := readOut(t, out, "index.md"); !strings.Contains(got, "* [Setup](guide/setup.md)") {
+		t.Errorf("index does not list the page:\n%s", got)
+	}
+}
+
+func TestExportSitemap(t *testing.T) {
+	for _, format := range []Format{FormatHTML, FormatMarkdown} {
+		// sitemaps only take absolute URLs
+		out := export(t, format, "")
+		if _, err := os.Stat(filepath.Join(out, "sitemap.xml")); err == nil {
+			t.Errorf("%s: sitemap written without a base URL", format)
+		}
+
+		out = export(t, format, "https://docs.example/")
+		var sitemap struct {
+			URLs []string `xml:"url>loc"`
+		}
+		if err := xml.Unmarshal([]byte(readOut(t, out, "sitemap.xml")), &sitemap); err != nil {
+			t.Fatal(err)
+		}
+		for _, loc := range sitemap.URLs {
+			if !strings.HasPrefix(loc, "https://docs.example/") || strings.HasPrefix(loc, "https://docs.example//") {
+				t.Errorf("%s: location %s", format, loc)
+			}
+		}
+		if len(sitemap.URLs) != 3 {
+			t.Errorf("%s: %d locations, want the index and 2 pages", format, len(sitemap.URLs))
+		}
+	}
+}
+
+func TestExportEPUB(t *testing.T) {
+	out := export(t, FormatEPUB, "")
+	raw := readOut(t, out, EPUBFilename)
+	zr, err := zip.NewReader(strings.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// readers find the mimetype first, stored and with no extra field
+	if first := zr.File[0]; first.Name != "mimetype" || first.Method != zip.Store {
+		t.Fatalf("first entry %s, method %d", first.Name, first.Method)
+	}
+	if !bytes.HasPrefix([]byte(raw[30:]), []byte("mimetypeapplication/epub+zip")) {
+		t.Error("mimetype not at offset 30")
+	}
+
+	files := map[string]string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(b)
+	}
+
+	var pkg struct {
+		Title    string `xml:"metadata>title"`
+		Manifest []struct {
+			Href string `xml:"href,attr"`
+		} `xml:"manifest>item"`
+		Spine []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"spine>itemref"`
+	}
+	if err := xml.Unmarshal([]byte(files["OEBPS/content.opf"]), &pkg); err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Title != "multiband" || len(pkg.Spine) != 2 {
+		t.Errorf("package titled %q with %d chapters", pkg.Title, len(pkg.Spine))
+	}
+	if _, ok := files["META-INF/container.xml"]; !ok {
+		t.Error("no container.xml")
+	}
+
+	// every document in the manifest is there, and well formed
+	for _, item := range pkg.Manifest {
+		doc, ok := files["OEBPS/"+item.Href]
+		if !ok {
+			t.Errorf("%s in the manifest, not the book", item.Href)
+			continue
+		}
+		dec := xml.NewDecoder(strings.NewReader(doc))
+		for {
+			if _, err := dec.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Errorf("%s: %v", item.Href, err)
+				break
+			}
+		}
+	}
+	if got := files["OEBPS/index.xhtml"]; !strings.Contains(got, `href="guide/setup.xhtml#first"`) {
+		t.Errorf("link not rewritten:\n%s", got)
+	}
+}
+
+func TestExportDeterministic(t *testing.T) {
+	for _, format := range Formats {
+		a, b := export(t, format, "https://docs.example/"), export(t, format, "https://docs.example/")
+		files := 0
+		err := filepath.WalkDir(a, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			files++
+			rel, _ := filepath.Rel(a, p)
+			if readOut(t, a, rel) != readOut(t, b, rel) {
+				t.Errorf("%s: %s differs between runs", format, rel)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if files == 0 {
+			t.Errorf("%s: nothing exported", format)
+		}
+	}
+}
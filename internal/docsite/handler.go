@@ -0,0 +1,379 @@
+package docsite
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	stdlib_html "html"
+	"html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+)
+
+// CacheControl lets clients reuse a page without asking again for a while.
+// Conditional requests after that are answered with 304s from the ETag.
+const CacheControl = "public, max-age=3600"
+
+// PrivateCacheControl is CacheControl for docs behind auth, which shared
+// caches must not hand to anyone else
+const PrivateCacheControl = "private, max-age=3600"
+
+// MaxCached is the size up to which files are held in memory, compressed.
+// Larger ones, like images and archives, are streamed from the filesystem
+// as they are requested.
+const MaxCached = 1 << 20
+
+// Handler serves a docs filesystem over HTTP, rendering markdown to HTML
+// pages and listing directories
+type Handler struct {
+	fsys     fs.FS
+	renderer Renderer
+	private  bool
+
+	// cache holds prerendered responses keyed by fs name. It is only written
+	// by Prerender, before the handler starts serving.
+	cache map[string]*entry
+}
+
+// entry is a fully rendered response, along with its gzipped form, or
+// the validator of a file too large to hold, which is streamed instead
+type entry struct {
+	contentType string
+	modtime     time.Time
+	body, gz    []byte
+	etag        string
+	stream      bool
+}
+
+// NewHandler returns a handler for the documents in fsys
+func NewHandler(fsys fs.FS) *Handler {
+	return &Handler{fsys: fsys, cache: map[string]*entry{}}
+}
+
+// SetPrivate marks responses as only for the client asking, as they must be
+// when the server requires auth
+func (h *Handler) SetPrivate(private bool) {
+	h.private = private
+}
+
+// Prerender renders and compresses every file and directory listing up
+// front, so requests never do more work than copying bytes
+func (h *Handler) Prerender() error {
+	cache := map[string]*entry{}
+	err := fs.WalkDir(h.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		e, err := h.render(name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		cache[name] = e
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	h.cache = cache
+	return nil
+}
+
+// CleanPath maps a request path onto a name suitable for fs.FS. It rejects
+// anything that tries to escape the root, rather than silently resolving it.
+func CleanPath(urlPath string) (string, bool) {
+	if !strings.HasPrefix(urlPath, "/") {
+		urlPath = "/" + urlPath
+	}
+	if strings.ContainsAny(urlPath, "\\\x00") {
+		return "", false
+	}
+	for _, seg := range strings.Split(urlPath, "/") {
+		if seg == ".." {
+			return "", false
+		}
+	}
+
+	name := strings.TrimPrefix(path.Clean(urlPath), "/")
+	if name == "" {
+		name = "."
+	}
+	if !fs.ValidPath(name) {
+		return "", false
+	}
+	return name, true
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, ok := CleanPath(r.URL.Path)
+	if !ok {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+
+	fi, err := fs.Stat(h.fsys, name)
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+
+	if fi.IsDir() && !strings.HasSuffix(r.URL.Path, "/") {
+		http.Redirect(w, r, path.Base(r.URL.Path)+"/", http.StatusMovedPermanently)
+		return
+	}
+
+	e, ok := h.cache[name]
+	if !ok {
+		if e, err = h.render(name); err != nil {
+			h.error(w, err)
+			return
+		}
+	}
+
+	header := w.Header()
+	header.Add("Vary", "Accept-Encoding")
+	if h.private {
+		header.Set("Cache-Control", PrivateCacheControl)
+	} else {
+		header.Set("Cache-Control", CacheControl)
+	}
+	if e.contentType != "" {
+		header.Set("Content-Type", e.contentType)
+	}
+
+	if e.stream {
+		header.Set("ETag", strconv.Quote(e.etag))
+		h.stream(w, r, name, e)
+		return
+	}
+
+	body, etag := e.body, e.etag
+	if e.gz != nil && AcceptsGzip(r.Header.Get("Accept-Encoding")) {
+		// each representation needs its own strong validator
+		body, etag = e.gz, e.etag+"-gz"
+		header.Set("Content-Encoding", "gzip")
+	}
+	header.Set("ETag", strconv.Quote(etag))
+
+	http.ServeContent(w, r, name, e.modtime, bytes.NewReader(body))
+}
+
+// stream serves a file too large to cache straight from the filesystem.
+// Files that cannot seek are sent whole, without support for ranges.
+func (h *Handler) stream(w http.ResponseWriter, r *http.Request, name string, e *entry) {
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+	defer f.Close() //nolint:errcheck
+
+	if rs, ok := f.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, name, e.modtime, rs)
+		return
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		h.error(w, err)
+		return
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" && match == w.Header().Get("ETag") {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+	if r.Method == http.MethodHead {
+		return
+	}
+	io.Copy(w, f) //nolint:errcheck
+}
+
+// AcceptsGzip reports whether an Accept-Encoding header permits gzip. An
+// explicit gzip entry takes precedence over *, whatever the order.
+func AcceptsGzip(acceptEncoding string) bool {
+	gzip, star := -1.0, -1.0 // the q of each, -1 when absent
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			v, ok := strings.CutPrefix(strings.ReplaceAll(param, " ", ""), "q=")
+			if !ok {
+				continue
+			}
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "gzip":
+			gzip = q
+		case "*":
+			star = q
+		}
+	}
+	if gzip >= 0 {
+		return gzip > 0
+	}
+	return star > 0
+}
+
+// render produces the response for name, which must already be clean
+func (h *Handler) render(name string) (*entry, error) {
+	fi, err := fs.Stat(h.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &entry{modtime: fi.ModTime()}
+
+	switch {
+	case fi.IsDir():
+		body, err := h.dirList(name)
+		if err != nil {
+			return nil, err
+		}
+		e.body = body
+		e.contentType = "text/html; charset=utf-8"
+
+	case strings.HasSuffix(name, ".md"):
+		raw, err := fs.ReadFile(h.fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := WritePage(&buf, PageData{
+			Title: Title(raw, name),
+			Root:  "/",
+			Body:  template.HTML(h.renderer.Render(raw)), //nolint:gosec
+		}); err != nil {
+			return nil, err
+		}
+		e.body = buf.Bytes()
+		e.contentType = "text/html; charset=utf-8"
+
+	case fi.Size() > MaxCached:
+		etag, err := h.hash(name)
+		if err != nil {
+			return nil, err
+		}
+		e.etag = etag
+		e.stream = true
+		e.contentType = mime.TypeByExtension(path.Ext(name))
+		return e, nil
+
+	default:
+		raw, err := fs.ReadFile(h.fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		e.body = raw
+		e.contentType = mime.TypeByExtension(path.Ext(name))
+		if e.contentType == "" {
+			// sniffed here, as ServeContent would sniff the gzipped body
+			e.contentType = http.DetectContentType(raw)
+		}
+	}
+
+	// embedded files carry no modification time, so conditional requests
+	// are answered from a hash of what we would send
+	e.etag = fmt.Sprintf("%x", sha256.Sum256(e.body))
+
+	gz, err := compress(e.body)
+	if err != nil {
+		return nil, err
+	}
+	// not worth the header when it doesn't save anything, eg. images
+	if len(gz) < len(e.body) {
+		e.gz = gz
+	}
+
+	return e, nil
+}
+
+// hash is the validator of a file, read through rather than held
+func (h *Handler) hash(name string) (string, error) {
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close() //nolint:errcheck
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sum.Sum(nil)), nil
+}
+
+func compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (h *Handler) error(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, "File not found", http.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, "Error reading file", http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) dirList(name string) ([]byte, error) {
+	// fs.ReadDir returns entries sorted by name
+	entries, err := fs.ReadDir(h.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<!doctype html>\n")
+	fmt.Fprintf(&buf, "<meta name=\"viewport\" content=\"width=device-width\">\n")
+	fmt.Fprintf(&buf, "<pre>\n")
+	if name != "." {
+		fmt.Fprintf(&buf, "<a href=\"../\">..</a>\n")
+	}
+	for _, e := range entries {
+		displayName := e.Name()
+		href := e.Name()
+		if e.IsDir() {
+			displayName += "/"
+			href += "/"
+		}
+		// name may contain '?' or '#', which must be escaped to remain
+		// part of the URL path, and not indicate the start of a query
+		// string or fragment.
+		u := url.URL{Path: "./" + href}
+		fmt.Fprintf(&buf, "<a href=\"%s\">%s</a>\n", u.String(), stdlib_html.EscapeString(displayName))
+	}
+	fmt.Fprintf(&buf, "</pre>\n")
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,386 @@
+package docsite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var (
+	page  = "# Title\n\n" + strings.Repeat("Some text that compresses well. ", 100) + "\n"
+	style = strings.Repeat("body { margin: 0 }\n", 100)
+	large = bytes.Repeat([]byte("0123456789abcdef"), MaxCached/16+1)
+)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"index.md":        {Data: []byte(page)},
+		"style.css":       {Data: []byte(style)},
+		"guide/setup.md":  {Data: []byte("# Setup\n")},
+		"media/large.bin": {Data: large},
+	}
+}
+
+func serve(t *testing.T, h http.Handler, method, target string, header http.Header) *http.Response {
+	t.Helper()
+	r := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Result()
+}
+
+func body(t *testing.T, res *http.Response) []byte {
+	t.Helper()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func handlers(t *testing.T, fsys fs.FS) map[string]*Handler {
+	t.Helper()
+	prerendered := NewHandler(fsys)
+	if err := prerendered.Prerender(); err != nil {
+		t.Fatal(err)
+	}
+	return map[string]*Handler{"lazy": NewHandler(fsys), "prerendered": prerendered}
+}
+
+func TestStatus(t *testing.T) {
+	for name, h := range handlers(t, testFS()) {
+		t.Run(name, func(t *testing.T) {
+			for _, tc := range []struct {
+				method, target string
+				want           int
+			}{
+				{"GET", "/", http.StatusOK},
+				{"GET", "/index.md", http.StatusOK},
+				{"GET", "/style.css", http.StatusOK},
+				{"GET", "/guide/", http.StatusOK},
+				{"GET", "/guide", http.StatusMovedPermanently},
+				{"GET", "/missing.md", http.StatusNotFound},
+				{"GET", "/guide/missing/", http.StatusNotFound},
+				{"HEAD", "/index.md", http.StatusOK},
+				{"POST", "/index.md", http.StatusMethodNotAllowed},
+				{"DELETE", "/", http.StatusMethodNotAllowed},
+			} {
+				res := serve(t, h, tc.method, tc.target, nil)
+				if res.StatusCode != tc.want {
+					t.Errorf("%s %s = %d, want %d", tc.method, tc.target, res.StatusCode, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	res := serve(t, NewHandler(testFS()), "GET", "/guide", nil)
+	if got := res.Header.Get("Location"); got != "/guide/" {
+		t.Errorf("Location = %q, want /guide/", got)
+	}
+}
+
+func TestContent(t *testing.T) {
+	for name, h := range handlers(t, testFS()) {
+		t.Run(name, func(t *testing.T) {
+			res := serve(t, h, "GET", "/index.md", nil)
+			if got := res.Header.Get("Content-Type"); got != "text/html; charset=utf-8" {
+				t.Errorf("Content-Type = %q", got)
+			}
+			if b := body(t, res); !bytes.Contains(b, []byte("<h1")) {
+				t.Errorf("index.md not rendered: %.100q", b)
+			}
+
+			res = serve(t, h, "GET", "/style.css", nil)
+			if got := body(t, res); string(got) != style {
+				t.Errorf("style.css = %.40q, want it as is", got)
+			}
+
+			res = serve(t, h, "GET", "/guide/", nil)
+			if b := body(t, res); !bytes.Contains(b, []byte(`href="./setup.md"`)) {
+				t.Errorf("listing of guide/ has no link to setup.md: %q", b)
+			}
+		})
+	}
+}
+
+func TestHead(t *testing.T) {
+	for name, h := range handlers(t, testFS()) {
+		t.Run(name, func(t *testing.T) {
+			for _, target := range []string{"/style.css", "/media/large.bin"} {
+				get := serve(t, h, "GET", target, nil)
+				head := serve(t, h, "HEAD", target, nil)
+				if b := body(t, head); len(b) != 0 {
+					t.Errorf("HEAD %s sent %d bytes", target, len(b))
+				}
+				if got, want := head.Header.Get("Content-Length"), get.Header.Get("Content-Length"); got != want {
+					t.Errorf("HEAD %s Content-Length = %q, want %q", target, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRange(t *testing.T) {
+	for name, h := range handlers(t, testFS()) {
+		t.Run(name, func(t *testing.T) {
+			for _, tc := range []struct {
+				target string
+				full   []byte
+			}{
+				{"/style.css", []byte(style)},
+				{"/media/large.bin", large},
+			} {
+				res := serve(t, h, "GET", tc.target, http.Header{"Range": {"bytes=5-24"}})
+				if res.StatusCode != http.StatusPartialContent {
+					t.Fatalf("GET %s with a range = %d, want 206", tc.target, res.StatusCode)
+				}
+				if got := body(t, res); !bytes.Equal(got, tc.full[5:25]) {
+					t.Errorf("GET %s bytes 5-24 = %q, want %q", tc.target, got, tc.full[5:25])
+				}
+
+				res = serve(t, h, "GET", tc.target, http.Header{"Range": {"bytes=-10"}})
+				if got := body(t, res); !bytes.Equal(got, tc.full[len(tc.full)-10:]) {
+					t.Errorf("GET %s last 10 bytes = %q", tc.target, got)
+				}
+
+				res = serve(t, h, "GET", tc.target, http.Header{"Range": {"bytes=999999999-"}})
+				if res.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+					t.Errorf("GET %s past the end = %d, want 416", tc.target, res.StatusCode)
+				}
+			}
+		})
+	}
+}
+
+func TestETag(t *testing.T) {
+	for name, h := range handlers(t, testFS()) {
+		t.Run(name, func(t *testing.T) {
+			for _, target := range []string{"/index.md", "/style.css", "/guide/", "/media/large.bin"} {
+				for _, enc := range []string{"", "gzip"} {
+					header := http.Header{"Accept-Encoding": {enc}}
+					res := serve(t, h, "GET", target, header)
+					etag := res.Header.Get("ETag")
+					if etag == "" {
+						t.Fatalf("GET %s (%q) has no ETag", target, enc)
+					}
+
+					header.Set("If-None-Match", etag)
+					res = serve(t, h, "GET", target, header)
+					if res.StatusCode != http.StatusNotModified {
+						t.Errorf("GET %s (%q) If-None-Match %s = %d, want 304", target, enc, etag, res.StatusCode)
+					}
+					if b := body(t, res); len(b) != 0 {
+						t.Errorf("304 for %s sent %d bytes", target, len(b))
+					}
+
+					header.Set("If-None-Match", `"stale"`)
+					if res = serve(t, h, "GET", target, header); res.StatusCode != http.StatusOK {
+						t.Errorf("GET %s with a stale ETag = %d, want 200", target, res.StatusCode)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGzip(t *testing.T) {
+	h := NewHandler(testFS())
+
+	plain := serve(t, h, "GET", "/style.css", nil)
+	gz := serve(t, h, "GET", "/style.css", http.Header{"Accept-Encoding": {"gzip, deflate"}})
+	if got := gz.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if plain.Header.Get("ETag") == gz.Header.Get("ETag") {
+		t.Errorf("plain and gzipped style.css share the ETag %s", gz.Header.Get("ETag"))
+	}
+	zr, err := gzip.NewReader(gz.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(zr); string(got) != style {
+		t.Errorf("gunzipped style.css = %.40q", got)
+	}
+
+	// too large to hold compressed, so always sent as is
+	res := serve(t, h, "GET", "/media/large.bin", http.Header{"Accept-Encoding": {"gzip"}})
+	if got := res.Header.Get("Content-Encoding"); got != "" {
+		t.Errorf("large.bin Content-Encoding = %q", got)
+	}
+	if got := body(t, res); !bytes.Equal(got, large) {
+		t.Errorf("large.bin is %d bytes, want %d", len(got), len(large))
+	}
+}
+
+func TestGzipUnknownType(t *testing.T) {
+	fsys := testFS()
+	fsys["LICENSE"] = &fstest.MapFile{Data: []byte(style)}
+	for name, h := range handlers(t, fsys) {
+		for _, accept := range []string{"", "gzip"} {
+			res := serve(t, h, "GET", "/LICENSE", http.Header{"Accept-Encoding": {accept}})
+			// typed from the file, not the gzip of it
+			if got := res.Header.Get("Content-Type"); got != "text/plain; charset=utf-8" {
+				t.Errorf("%s, accepting %q: Content-Type = %q", name, accept, got)
+			}
+		}
+	}
+}
+
+// unseekable hides every method of its files but fs.File's
+type unseekable struct{ fs.FS }
+
+func (u unseekable) Open(name string) (fs.File, error) {
+	f, err := u.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return struct{ fs.File }{f}, nil
+}
+
+func TestLargeFile(t *testing.T) {
+	h := NewHandler(testFS())
+	if err := h.Prerender(); err != nil {
+		t.Fatal(err)
+	}
+	if e := h.cache["media/large.bin"]; !e.stream || e.body != nil {
+		t.Errorf("large.bin is held in memory")
+	}
+
+	h = NewHandler(unseekable{testFS()})
+	res := serve(t, h, "GET", "/media/large.bin", nil)
+	if got := body(t, res); !bytes.Equal(got, large) {
+		t.Errorf("unseekable large.bin is %d bytes, want %d", len(got), len(large))
+	}
+	etag := res.Header.Get("ETag")
+	res = serve(t, h, "GET", "/media/large.bin", http.Header{"If-None-Match": {etag}})
+	if res.StatusCode != http.StatusNotModified {
+		t.Errorf("unseekable large.bin If-None-Match = %d, want 304", res.StatusCode)
+	}
+}
+
+func TestTraversal(t *testing.T) {
+	fsys := testFS()
+	fsys["secret"] = &fstest.MapFile{Data: []byte("secret")}
+	h := NewHandler(fstest.MapFS(fsys))
+	for _, target := range []string{
+		"/../secret",
+		"/guide/../../secret",
+		"/%2e%2e/secret",
+		"/guide/%2e%2e/%2e%2e/secret",
+		"/..%2fsecret",
+		"/guide/..%5c..%5csecret",
+		"/guide%5c..%5csecret",
+		"/index.md%00.css",
+	} {
+		res := serve(t, h, "GET", target, nil)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", target, res.StatusCode)
+		}
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+		ok       bool
+	}{
+		{"/", ".", true},
+		{"", ".", true},
+		{"/index.md", "index.md", true},
+		{"index.md", "index.md", true},
+		{"/guide/", "guide", true},
+		{"//guide//setup.md", "guide/setup.md", true},
+		{"/guide/./setup.md", "guide/setup.md", true},
+		{"/..", "", false},
+		{"/guide/../index.md", "", false},
+		{"/a\\b", "", false},
+		{"/a\x00b", "", false},
+	} {
+		got, ok := CleanPath(tc.in)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("CleanPath(%q) = %q, %v, want %q, %v", tc.in, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func FuzzCleanPath(f *testing.F) {
+	for _, seed := range []string{"/", "/index.md", "/guide/", "/../secret", "/a/./b//c", "/a\\..\\b", "/\x00", "/%2e%2e"} {
+		f.Add(seed)
+	}
+	h := NewHandler(testFS())
+	f.Fuzz(func(t *testing.T, p string) {
+		name, ok := CleanPath(p)
+		if ok {
+			if !fs.ValidPath(name) {
+				t.Errorf("CleanPath(%q) = %q, not a valid path", p, name)
+			}
+			for _, seg := range strings.Split(name, "/") {
+				if seg == ".." {
+					t.Errorf("CleanPath(%q) = %q, escapes the root", p, name)
+				}
+			}
+		}
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r.URL.Path = "/" + p
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code >= 500 {
+			t.Errorf("GET %q = %d", p, w.Code)
+		}
+	})
+}
+
+func TestCacheControl(t *testing.T) {
+	h := NewHandler(testFS())
+	for _, target := range []string{"/index.md", "/media/large.bin"} {
+		if got := serve(t, h, "GET", target, nil).Header.Get("Cache-Control"); got != CacheControl {
+			t.Errorf("GET %s Cache-Control = %q, want %q", target, got, CacheControl)
+		}
+	}
+
+	h.SetPrivate(true)
+	for _, target := range []string{"/index.md", "/guide/", "/media/large.bin"} {
+		if got := serve(t, h, "GET", target, nil).Header.Get("Cache-Control"); got != PrivateCacheControl {
+			t.Errorf("GET %s behind auth Cache-Control = %q, want %q", target, got, PrivateCacheControl)
+		}
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"GZIP", true},
+		{"deflate, gzip;q=0.5", true},
+		{"br, deflate", false},
+		{"gzip;q=0", false},
+		{"gzip; q=0.0", false},
+		{"*", true},
+		{"*;q=0", false},
+		{"*, gzip;q=0", false},
+		{"gzip;q=0, *", false},
+		{"gzip;q=0, *;q=1", false},
+		{"gzip;q=0.1, *;q=0", true},
+		{"identity;q=1, *;q=0.5", true},
+		{"gzip;level=1;q=0", false},
+	} {
+		if got := AcceptsGzip(tc.header); got != tc.want {
+			t.Errorf("AcceptsGzip(%q) = %v, want %v", tc.header, got, tc.want)
+		}
+	}
+}
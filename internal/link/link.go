@@ -0,0 +1,99 @@
+// Package link describes the interfaces a node talks over, radios and
+// otherwise, and the feed of statistics they report
+package link
+
+import (
+	"errors"
+	"time"
+)
+
+// DutyWindow is the period duty cycle budgets are counted over
+const DutyWindow = time.Hour
+
+var ErrUnknownInterface = errors.New("unknown interface")
+
+type State uint8
+
+const (
+	Down State = iota
+	Up
+	// Degraded interfaces are up, but losing packets or barely hearing peers
+	Degraded
+)
+
+func (s State) String() string {
+	switch s {
+	case Down:
+		return "down"
+	case Up:
+		return "up"
+	case Degraded:
+		return "degraded"
+	}
+	return "unknown"
+}
+
+// Modem is the LoRa modulation of a radio interface
+type Modem struct {
+	// Bandwidth in Hz
+	Bandwidth       int
+	SpreadingFactor int
+	// CodingRate is the denominator of 4/5 to 4/8
+	CodingRate int
+	// TxPower in dBm
+	TxPower int
+}
+
+type Interface struct {
+	Name string
+	// Kind is the driver, eg. lora, tcp or serial
+	Kind string
+	// Frequency in Hz, zero for interfaces that are not radios
+	Frequency int64
+	Modem     *Modem
+	// DutyCycle is the fraction of DutyWindow the interface may transmit
+	// for, zero if unlimited
+	DutyCycle float64
+	// Config is the rest of the interface settings, as configured
+	Config map[string]string
+}
+
+// Budget is the airtime allowed per DutyWindow, zero if unlimited
+func (i Interface) Budget() time.Duration {
+	return time.Duration(i.DutyCycle * float64(DutyWindow))
+}
+
+// Sample is the state of an interface at a point in time
+type Sample struct {
+	Interface string
+	Time      time.Time
+	State     State
+	// RSSI in dBm and SNR in dB of the last packet heard, zero for
+	// interfaces that are not radios
+	RSSI       float64
+	SNR        float64
+	PacketsIn  uint64
+	PacketsOut uint64
+	BytesIn    uint64
+	BytesOut   uint64
+	// Airtime is how long the interface transmitted for over the last
+	// DutyWindow
+	Airtime time.Duration
+	// Battery is the charge left in percent of a radio running off its own
+	// battery, like a handheld RNode, or negative if it has none
+	Battery float64
+}
+
+// Feed reports on the interfaces of a node, and takes them up and down
+type Feed interface {
+	Interfaces() []Interface
+	Samples() <-chan Sample
+	SetUp(name string, up bool) error
+}
+
+// Configurer is implemented by feeds whose interfaces can be changed while
+// they run. Configure adds the interfaces not running yet, stops those left
+// out, and retunes the rest in place, keeping their statistics.
+type Configurer interface {
+	Configure(ifaces []Interface) error
+}
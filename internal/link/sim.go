@@ -0,0 +1,272 @@
+package link
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Demo is a small node to simulate: a LoRa radio on the EU band, a second
+// one on a busier channel and an uplink over TCP
+var Demo = []Interface{
+	{
+		Name:      "lora0",
+		Kind:      "lora",
+		Frequency: 868_100_000,
+		Modem:     &Modem{Bandwidth: 125_000, SpreadingFactor: 9, CodingRate: 5, TxPower: 14},
+		DutyCycle: 0.01,
+		Config:    map[string]string{"port": "/dev/ttyUSB0", "flow_control": "false"},
+	},
+	{
+		Name:      "lora1",
+		Kind:      "lora",
+		Frequency: 869_525_000,
+		Modem:     &Modem{Bandwidth: 250_000, SpreadingFactor: 7, CodingRate: 5, TxPower: 27},
+		DutyCycle: 0.1,
+		Config:    map[string]string{"port": "/dev/ttyACM0", "flow_control": "false"},
+	},
+	{
+		Name:   "uplink",
+		Kind:   "tcp",
+		Config: map[string]string{"target_host": "reticulum.example.net", "target_port": "4242"},
+	},
+}
+
+// packetSize is the size in bytes of every simulated packet
+const packetSize = 64
+
+type simState struct {
+	up         bool
+	rssi, snr  float64
+	in, out    uint64
+	bytesIn    uint64
+	bytesOut   uint64
+	tx         []time.Time
+	txDuration []time.Duration
+	battery    float64
+}
+
+// Sim is a feed of made up but plausible statistics: radio signal wanders,
+// packets come and go, and airtime adds up against the duty cycle. Samples
+// must be drained for Step to return.
+type Sim struct {
+	mu      sync.Mutex
+	ifaces  []Interface
+	state   map[string]*simState
+	rng     *rand.Rand
+	samples chan Sample
+	// logger is the logger of an interface, if they log
+	logger func(name string) *slog.Logger
+}
+
+// NewSim simulates ifaces, all of them up, the same way every time for the
+// same seed
+func NewSim(seed uint64, ifaces ...Interface) *Sim {
+	s := &Sim{
+		ifaces:  ifaces,
+		state:   map[string]*simState{},
+		rng:     rand.New(rand.NewPCG(seed, seed)),
+		samples: make(chan Sample, 64),
+	}
+	for _, i := range ifaces {
+		s.state[i.Name] = s.newState(i)
+	}
+	return s
+}
+
+// SetLogger has each interface log what it does through logger(name)
+func (s *Sim) SetLogger(logger func(name string) *slog.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logger = logger
+}
+
+// log is the logger of an interface, discarding everything if unset
+func (s *Sim) log(name string) *slog.Logger {
+	if s.logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return s.logger(name)
+}
+
+func (s *Sim) newState(i Interface) *simState {
+	st := &simState{up: true, rssi: -90, snr: 5, battery: -1}
+	// radios run off batteries, part charged
+	if i.Modem != nil {
+		st.battery = 25 + s.rng.Float64()*75
+	}
+	return st
+}
+
+func (s *Sim) Interfaces() []Interface {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.ifaces)
+}
+
+func (s *Sim) Configure(ifaces []Interface) error {
+	names := map[string]bool{}
+	for _, i := range ifaces {
+		if names[i.Name] {
+			return fmt.Errorf("interface %q given twice", i.Name)
+		}
+		names[i.Name] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name := range s.state {
+		if !names[name] {
+			delete(s.state, name)
+			s.log(name).Info("removed")
+		}
+	}
+	for _, i := range ifaces {
+		st, ok := s.state[i.Name]
+		if !ok {
+			s.log(i.Name).Info("added", "kind", i.Kind)
+		} else if n := slices.IndexFunc(s.ifaces, func(was Interface) bool { return was.Name == i.Name }); n >= 0 && !sameInterface(s.ifaces[n], i) {
+			s.log(i.Name).Info("retuned", "frequency", i.Frequency, "duty_cycle", i.DutyCycle)
+		}
+		switch {
+		case !ok:
+			s.state[i.Name] = s.newState(i)
+		case i.Modem == nil:
+			st.rssi, st.snr, st.battery = 0, 0, -1
+		case st.battery < 0:
+			// a radio now, where it was not before
+			s.state[i.Name] = s.newState(i)
+		}
+	}
+	s.ifaces = slices.Clone(ifaces)
+	return nil
+}
+
+func (s *Sim) Samples() <-chan Sample {
+	return s.samples
+}
+
+func (s *Sim) SetUp(name string, up bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.state[name]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownInterface, name)
+	}
+	if st.up != up {
+		state := "down"
+		if up {
+			state = "up"
+		}
+		s.log(name).Info("taken " + state)
+	}
+	st.up = up
+	return nil
+}
+
+// Run steps the simulation every interval until ctx is done
+func (s *Sim) Run(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.Step(now)
+		}
+	}
+}
+
+// Step reports a sample of every interface as of now
+func (s *Sim) Step(now time.Time) {
+	samples := []Sample{}
+
+	s.mu.Lock()
+	for _, i := range s.ifaces {
+		st := s.state[i.Name]
+		sample := Sample{Interface: i.Name, Time: now, PacketsIn: st.in, PacketsOut: st.out, BytesIn: st.bytesIn, BytesOut: st.bytesOut, Battery: st.battery}
+		if !st.up {
+			samples = append(samples, sample)
+			continue
+		}
+
+		if i.Modem != nil {
+			st.rssi = clamp(st.rssi+s.rng.NormFloat64()*2, -125, -40)
+			st.snr = clamp(st.snr+s.rng.NormFloat64(), -20, 12)
+			sample.RSSI, sample.SNR = st.rssi, st.snr
+		}
+		// forget what was sent before the duty cycle window
+		for len(st.tx) > 0 && now.Sub(st.tx[0]) > DutyWindow {
+			st.tx, st.txDuration = st.tx[1:], st.txDuration[1:]
+		}
+		for _, d := range st.txDuration {
+			sample.Airtime += d
+		}
+
+		heard := uint64(s.rng.IntN(4))
+		st.in += heard
+		st.bytesIn += heard * packetSize
+		// radios hold packets back once their budget is spent
+		for range s.rng.IntN(3) {
+			d := airtime(i.Modem, packetSize)
+			if budget := i.Budget(); budget > 0 && sample.Airtime+d > budget {
+				s.log(i.Name).Debug("holding packet, duty cycle spent", "airtime", sample.Airtime, "budget", budget)
+				break
+			}
+			st.out++
+			st.bytesOut += packetSize
+			st.tx = append(st.tx, now)
+			st.txDuration = append(st.txDuration, d)
+			sample.Airtime += d
+		}
+		// batteries drain a little while listening, and more sending
+		if st.battery >= 0 {
+			st.battery = max(0, st.battery-0.005-0.02*float64(st.out-sample.PacketsOut))
+			sample.Battery = st.battery
+		}
+
+		sample.State = Up
+		if i.Modem != nil && st.snr < -10 {
+			sample.State = Degraded
+		}
+		sample.PacketsIn, sample.PacketsOut = st.in, st.out
+		sample.BytesIn, sample.BytesOut = st.bytesIn, st.bytesOut
+		samples = append(samples, sample)
+		s.log(i.Name).Debug("sample", "state", sample.State.String(), "rssi", sample.RSSI, "snr", sample.SNR, "in", sample.PacketsIn, "out", sample.PacketsOut)
+	}
+	s.mu.Unlock()
+
+	for _, sample := range samples {
+		s.samples <- sample
+	}
+}
+
+// airtime is roughly how long a LoRa packet of size bytes is on air, and
+// nothing for interfaces that are not radios
+func airtime(m *Modem, size int) time.Duration {
+	if m == nil || m.Bandwidth == 0 {
+		return 0
+	}
+	symbol := time.Duration(float64(uint(1)<<m.SpreadingFactor) / float64(m.Bandwidth) * float64(time.Second))
+	// preamble, header and payload at about one symbol per SF bits, padded
+	// for the coding rate
+	symbols := 12.25 + 8 + float64(size*8*m.CodingRate)/float64(4*m.SpreadingFactor)
+	return time.Duration(symbols * float64(symbol))
+}
+
+// sameInterface reports whether a and b are configured alike
+func sameInterface(a, b Interface) bool {
+	return a.Kind == b.Kind && a.Frequency == b.Frequency && a.DutyCycle == b.DutyCycle &&
+		(a.Modem == nil) == (b.Modem == nil) && (a.Modem == nil || *a.Modem == *b.Modem) &&
+		maps.Equal(a.Config, b.Config)
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return min(max(v, lo), hi)
+}
@@ -0,0 +1,144 @@
+package link
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// step steps s at now and collects the sample of every interface
+func step(t *testing.T, s *Sim, now time.Time) map[string]Sample {
+	t.Helper()
+	s.Step(now)
+	samples := map[string]Sample{}
+	for range s.Interfaces() {
+		select {
+		case sample := <-s.Samples():
+			samples[sample.Interface] = sample
+		default:
+			t.Fatalf("step at %s reported %d of %d interfaces", now, len(samples), len(s.Interfaces()))
+		}
+	}
+	return samples
+}
+
+func run(t *testing.T, seed uint64, steps int) []Sample {
+	t.Helper()
+	s := NewSim(seed, Demo...)
+	out := []Sample{}
+	for n := range steps {
+		samples := step(t, s, t0.Add(time.Duration(n)*time.Second))
+		for _, i := range Demo {
+			out = append(out, samples[i.Name])
+		}
+	}
+	return out
+}
+
+func TestSimSeed(t *testing.T) {
+	a, b := run(t, 7, 100), run(t, 7, 100)
+	if !slices.Equal(a, b) {
+		t.Errorf("the same seed simulated differently")
+	}
+	if slices.Equal(a, run(t, 8, 100)) {
+		t.Errorf("different seeds simulated the same")
+	}
+}
+
+func TestSimDutyCycle(t *testing.T) {
+	radio := Demo[0]
+	radio.DutyCycle = 0.0005
+	budget, d := radio.Budget(), airtime(radio.Modem, packetSize)
+	fits := uint64(budget / d)
+	if fits < 2 {
+		t.Fatalf("budget %s holds %d packets of %s", budget, fits, d)
+	}
+	s := NewSim(1, radio)
+
+	var last Sample
+	for n := range 600 {
+		last = step(t, s, t0.Add(time.Duration(n)*time.Second))[radio.Name]
+		if last.Airtime > budget {
+			t.Fatalf("after %ds airtime %s is over the budget of %s", n, last.Airtime, budget)
+		}
+	}
+	// the budget is spent within minutes, and everything else held back
+	if last.PacketsOut != fits {
+		t.Errorf("sent %d packets, want the %d the budget holds", last.PacketsOut, fits)
+	}
+	if want := time.Duration(fits) * d; last.Airtime != want {
+		t.Errorf("airtime %s, want %s", last.Airtime, want)
+	}
+
+	// once the window has passed, the radio sends again
+	later := t0.Add(DutyWindow + time.Hour)
+	resumed := step(t, s, later)[radio.Name]
+	for n := 1; n < 60 && resumed.PacketsOut == last.PacketsOut; n++ {
+		resumed = step(t, s, later.Add(time.Duration(n)*time.Second))[radio.Name]
+	}
+	if resumed.PacketsOut == last.PacketsOut {
+		t.Errorf("radio still holding packets an hour after its budget was spent")
+	}
+}
+
+func TestSimUnlimited(t *testing.T) {
+	uplink := Demo[2]
+	s := NewSim(1, uplink)
+	var last Sample
+	for n := range 100 {
+		last = step(t, s, t0.Add(time.Duration(n)*time.Second))[uplink.Name]
+	}
+	if last.Airtime != 0 || last.PacketsOut < 50 {
+		t.Errorf("uplink sent %d packets in %s of airtime, want no limit and none", last.PacketsOut, last.Airtime)
+	}
+}
+
+func TestSimSetUp(t *testing.T) {
+	s := NewSim(3, Demo...)
+	if err := s.SetUp("nope", false); !errors.Is(err, ErrUnknownInterface) {
+		t.Errorf("SetUp of an unknown interface = %v", err)
+	}
+
+	now := t0
+	tick := func() Sample {
+		now = now.Add(time.Second)
+		return step(t, s, now)["lora0"]
+	}
+	for range 10 {
+		tick()
+	}
+	before := tick()
+
+	if err := s.SetUp("lora0", false); err != nil {
+		t.Fatal(err)
+	}
+	for range 10 {
+		down := tick()
+		if down.State != Down {
+			t.Fatalf("lora0 is %s, want down", down.State)
+		}
+		if down.PacketsIn != before.PacketsIn || down.PacketsOut != before.PacketsOut || down.BytesOut != before.BytesOut {
+			t.Fatalf("lora0 moved packets while down: %+v, was %+v", down, before)
+		}
+		if down.RSSI != 0 || down.SNR != 0 {
+			t.Fatalf("lora0 heard a signal while down: %+v", down)
+		}
+	}
+
+	if err := s.SetUp("lora0", true); err != nil {
+		t.Fatal(err)
+	}
+	up := tick()
+	if up.State == Down {
+		t.Fatalf("lora0 still down")
+	}
+	for range 20 {
+		up = tick()
+	}
+	if up.PacketsIn <= before.PacketsIn || up.PacketsOut <= before.PacketsOut {
+		t.Errorf("lora0 moved no packets once back up: %+v, was %+v", up, before)
+	}
+}
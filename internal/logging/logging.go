@@ -0,0 +1,326 @@
+// Package logging is the node's log. Each subsystem logs through a logger
+// of its own, at a level of its own, to stderr or a rotated file as text,
+// JSON or logfmt, and the latest entries are kept for the console to show.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	charmlog "github.com/charmbracelet/log"
+	"github.com/mattn/go-isatty"
+	"github.com/muesli/termenv"
+)
+
+// Formats are how entries can be written
+var Formats = []string{"text", "json", "logfmt"}
+
+// Off is a level above every other, to silence a subsystem
+const Off = slog.LevelError + 4
+
+const (
+	DefaultMaxSize  = 1 << 20
+	DefaultMaxFiles = 3
+	DefaultKeep     = 1000
+)
+
+type Config struct {
+	// Levels is the level of each subsystem, eg. iface.rnode=debug,queue=info,
+	// and of the rest alone or as *=warn. Subsystems not listed take the
+	// level of the nearest one above them, so iface=debug covers
+	// iface.rnode. The default is info.
+	Levels string
+	// Format is text, json or logfmt, text if empty
+	Format string
+	// File is written instead of stderr if set, rotated at MaxSize bytes
+	// with MaxFiles of the older ones kept
+	File     string
+	MaxSize  int64
+	MaxFiles int
+	// Keep is how many entries the console can show, DefaultKeep if zero
+	Keep int
+}
+
+// Logs hands out the loggers of the subsystems, all writing to the same
+// place
+type Logs struct {
+	format string
+	out    *output
+	ring   *Ring
+	// file is closed with the logs, if there is one
+	file io.Closer
+
+	mu     sync.RWMutex
+	levels Levels
+}
+
+// New sets up logging as c says
+func New(c Config) (*Logs, error) {
+	levels, err := ParseLevels(c.Levels)
+	if err != nil {
+		return nil, err
+	}
+	if c.Format == "" {
+		c.Format = "text"
+	}
+	if !slices.Contains(Formats, c.Format) {
+		return nil, fmt.Errorf("unknown log format %q, expected one of %s", c.Format, strings.Join(Formats, ", "))
+	}
+	if c.Keep == 0 {
+		c.Keep = DefaultKeep
+	}
+
+	l := &Logs{format: c.Format, out: &output{w: os.Stderr}, ring: NewRing(c.Keep), levels: levels}
+	if c.File != "" {
+		if c.MaxSize == 0 {
+			c.MaxSize = DefaultMaxSize
+		}
+		if c.MaxFiles == 0 {
+			c.MaxFiles = DefaultMaxFiles
+		}
+		r, err := OpenRotator(c.File, c.MaxSize, c.MaxFiles)
+		if err != nil {
+			return nil, err
+		}
+		l.out.w, l.file = r, r
+	}
+	return l, nil
+}
+
+// Default logs text at info to stderr, until configured otherwise
+func Default() *Logs {
+	l, err := New(Config{})
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+// Logger is the logger of a subsystem, eg. iface.rnode
+func (l *Logs) Logger(subsystem string) *slog.Logger {
+	return slog.New(&handler{logs: l, subsystem: subsystem, out: l.handler(subsystem)})
+}
+
+// handler writes the entries of subsystem in the format configured. Levels
+// are left to the handler in front of it.
+func (l *Logs) handler(subsystem string) slog.Handler {
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug - 4}
+	sub := []slog.Attr{slog.String("subsystem", subsystem)}
+	switch l.format {
+	case "json":
+		return slog.NewJSONHandler(l.out, opts).WithAttrs(sub)
+	case "logfmt":
+		return slog.NewTextHandler(l.out, opts).WithAttrs(sub)
+	}
+	text := charmlog.NewWithOptions(l.out, charmlog.Options{
+		ReportTimestamp: true,
+		TimeFormat:      time.DateTime,
+		Level:           charmlog.DebugLevel,
+		Prefix:          subsystem,
+	})
+	if l.out.terminal() {
+		text.SetColorProfile(termenv.NewOutput(os.Stderr).ColorProfile())
+	}
+	return text
+}
+
+// Ring holds the latest entries of every subsystem, whatever the output
+func (l *Logs) Ring() *Ring { return l.ring }
+
+// SetLevels replaces the levels of the subsystems, as Config.Levels
+func (l *Logs) SetLevels(spec string) error {
+	levels, err := ParseLevels(spec)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.levels = levels
+	return nil
+}
+
+// Level is the level a subsystem logs at
+func (l *Logs) Level(subsystem string) slog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.levels.Of(subsystem)
+}
+
+// SetOutput has entries written to w instead, eg. io.Discard while the
+// console has the terminal. Entries are kept for the console either way.
+func (l *Logs) SetOutput(w io.Writer) {
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.w = w
+}
+
+// ToFile reports whether entries go to a file rather than stderr
+func (l *Logs) ToFile() bool { return l.file != nil }
+
+func (l *Logs) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// Levels are the levels of subsystems, and of the rest
+type Levels struct {
+	Default    slog.Level
+	Subsystems map[string]slog.Level
+}
+
+// ParseLevels reads levels like iface.rnode=debug,queue=info,warn
+func ParseLevels(spec string) (Levels, error) {
+	levels := Levels{Default: slog.LevelInfo, Subsystems: map[string]slog.Level{}}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		subsystem, name, ok := strings.Cut(part, "=")
+		if !ok {
+			subsystem, name = "*", subsystem
+		}
+		level, err := ParseLevel(strings.TrimSpace(name))
+		if err != nil {
+			return levels, err
+		}
+		if subsystem = strings.TrimSpace(subsystem); subsystem == "*" {
+			levels.Default = level
+		} else {
+			levels.Subsystems[subsystem] = level
+		}
+	}
+	return levels, nil
+}
+
+// Of is the level of a subsystem, or of the nearest one above it
+func (l Levels) Of(subsystem string) slog.Level {
+	for s := subsystem; s != ""; {
+		if level, ok := l.Subsystems[s]; ok {
+			return level
+		}
+		i := strings.LastIndex(s, ".")
+		if i < 0 {
+			break
+		}
+		s = s[:i]
+	}
+	return l.Default
+}
+
+// ParseLevel reads debug, info, warn, error or off
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	case "off":
+		return Off, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn, error or off", name)
+}
+
+// output is where entries are written, swapped when the console takes over
+// the terminal. Each entry is written whole, so loggers can share it.
+type output struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.w.Write(p)
+}
+
+func (o *output) terminal() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	f, ok := o.w.(*os.File)
+	return ok && isatty.IsTerminal(f.Fd())
+}
+
+// handler filters by the level of its subsystem, and keeps what passes in
+// the ring before writing it out
+type handler struct {
+	logs      *Logs
+	subsystem string
+	out       slog.Handler
+	// attrs are those given With, rendered for the ring, and group the
+	// prefix of those to come
+	attrs []string
+	group string
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.logs.Level(h.subsystem)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	attrs := slices.Clone(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = appendAttr(attrs, h.group, a)
+		return true
+	})
+	h.logs.ring.add(Entry{
+		Time:      r.Time,
+		Level:     r.Level,
+		Subsystem: h.subsystem,
+		Message:   r.Message,
+		Attrs:     strings.Join(attrs, " "),
+	})
+	return h.out.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	next.attrs = slices.Clone(h.attrs)
+	for _, a := range attrs {
+		next.attrs = appendAttr(next.attrs, h.group, a)
+	}
+	next.out = h.out.WithAttrs(attrs)
+	return &next
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	next := *h
+	next.group = h.group + name + "."
+	next.out = h.out.WithGroup(name)
+	return &next
+}
+
+// appendAttr renders a as key=value, as logfmt would
+func appendAttr(attrs []string, group string, a slog.Attr) []string {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return attrs
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, g := range a.Value.Group() {
+			attrs = appendAttr(attrs, group+a.Key+".", g)
+		}
+		return attrs
+	}
+	v := a.Value.String()
+	if v == "" || strings.ContainsAny(v, " \"=\t\n") {
+		v = fmt.Sprintf("%q", v)
+	}
+	return append(attrs, group+a.Key+"="+v)
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutput(t *testing.T) {
+	if Default().ToFile() {
+		t.Error("default logs go to a file")
+	}
+
+	path := filepath.Join(t.TempDir(), "node.log")
+	logs, err := New(Config{File: path, Format: "logfmt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logs.Close() //nolint:errcheck
+	if !logs.ToFile() {
+		t.Error("logs to a file not reported as such")
+	}
+
+	logger := logs.Logger("queue")
+	logger.Info("to the file")
+	var buf bytes.Buffer
+	logs.SetOutput(&buf)
+	logger.Info("to the buffer")
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file := string(raw); !strings.Contains(file, `msg="to the file"`) || strings.Contains(file, "to the buffer") {
+		t.Errorf("file has:\n%s", file)
+	}
+	if got := buf.String(); !strings.Contains(got, `msg="to the buffer" subsystem=queue`) || strings.Contains(got, "to the file") {
+		t.Errorf("buffer has:\n%s", got)
+	}
+
+	// the console is shown both, wherever they were written
+	entries, _ := logs.Ring().Entries()
+	if len(entries) != 2 || entries[0].Message != "to the file" || entries[1].Message != "to the buffer" {
+		t.Errorf("ring has %+v", entries)
+	}
+}
+
+func TestLevels(t *testing.T) {
+	levels, err := ParseLevels("iface=debug, iface.tcp=error,warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for subsystem, want := range map[string]slog.Level{
+		"iface":       slog.LevelDebug,
+		"iface.rnode": slog.LevelDebug,
+		"iface.tcp":   slog.LevelError,
+		"queue":       slog.LevelWarn,
+		"ifaces":      slog.LevelWarn,
+	} {
+		if got := levels.Of(subsystem); got != want {
+			t.Errorf("%s logs at %s, want %s", subsystem, got, want)
+		}
+	}
+	if _, err := ParseLevels("queue=loud"); err == nil {
+		t.Error("unknown level accepted")
+	}
+}
@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Entry is a line of the log as the console shows it
+type Entry struct {
+	Time      time.Time
+	Level     slog.Level
+	Subsystem string
+	Message   string
+	// Attrs are the entry's values as key=value pairs
+	Attrs string
+}
+
+// Ring keeps the latest entries logged, dropping the oldest
+type Ring struct {
+	mu      sync.Mutex
+	entries []Entry
+	next    int
+	full    bool
+	// total counts every entry added, so readers can tell what is new
+	total uint64
+}
+
+func NewRing(size int) *Ring {
+	return &Ring{entries: make([]Entry, size)}
+}
+
+func (r *Ring) add(e Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[r.next] = e
+	r.next = (r.next + 1) % len(r.entries)
+	r.full = r.full || r.next == 0
+	r.total++
+}
+
+// Entries are those kept, oldest first, and the count of every entry added
+// so far
+func (r *Ring) Entries() ([]Entry, uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]Entry(nil), r.entries[:r.next]...), r.total
+	}
+	return append(append([]Entry(nil), r.entries[r.next:]...), r.entries[:r.next]...), r.total
+}
+
+// Total is the count of every entry added so far
+func (r *Ring) Total() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.total
+}
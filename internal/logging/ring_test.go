@@ -0,0 +1,37 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	for _, tc := range []struct {
+		added int
+		want  string
+	}{
+		{0, ""},
+		{2, "0 1"},
+		{3, "0 1 2"},
+		// the oldest are dropped, the rest kept in order
+		{4, "1 2 3"},
+		{8, "5 6 7"},
+	} {
+		r := NewRing(3)
+		for i := range tc.added {
+			r.add(Entry{Message: fmt.Sprint(i)})
+		}
+		entries, total := r.Entries()
+		got := []string{}
+		for _, e := range entries {
+			got = append(got, e.Message)
+		}
+		if strings.Join(got, " ") != tc.want {
+			t.Errorf("after %d: kept %q, want %q", tc.added, got, tc.want)
+		}
+		if total != uint64(tc.added) || r.Total() != total {
+			t.Errorf("after %d: total %d, %d", tc.added, total, r.Total())
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// Rotator is a log file moved aside as file.1 once it reaches MaxSize,
+// file.1 becoming file.2 and so on, MaxFiles of them kept. Small files suit
+// the SD cards nodes often run from: the log takes a bounded amount of
+// space, and rotating renames files rather than rewriting them.
+type Rotator struct {
+	Path     string
+	MaxSize  int64
+	MaxFiles int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// OpenRotator appends to the file at path, creating it if missing
+func OpenRotator(path string, maxSize int64, maxFiles int) (*Rotator, error) {
+	r := &Rotator{Path: path, MaxSize: maxSize, MaxFiles: maxFiles}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Rotator) open() error {
+	f, err := os.OpenFile(r.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, fi.Size()
+	return nil
+}
+
+// Write appends p, rotating first if it would take the file past MaxSize.
+// Entries are never split across files.
+func (r *Rotator) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return 0, fs.ErrClosed
+	}
+	if r.size > 0 && r.size+int64(len(p)) > r.MaxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *Rotator) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	r.f = nil
+	// the oldest goes, and the rest move up one; with none kept, that is
+	// the file itself, which starts over
+	if err := os.Remove(r.name(r.MaxFiles)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for i := r.MaxFiles - 1; i >= 0; i-- {
+		if err := os.Rename(r.name(i), r.name(i+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return r.open()
+}
+
+// name is the path of the i-th file, the current one being the 0th
+func (r *Rotator) name(i int) string {
+	if i == 0 {
+		return r.Path
+	}
+	return fmt.Sprintf("%s.%d", r.Path, i)
+}
+
+func (r *Rotator) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
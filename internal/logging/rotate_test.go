@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// files reads the log and the files rotated out of it, missing ones as ""
+func files(t *testing.T, path string, n int) []string {
+	t.Helper()
+	r := &Rotator{Path: path}
+	got := []string{}
+	for i := range n {
+		raw, err := os.ReadFile(r.name(i))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			t.Fatal(err)
+		}
+		got = append(got, string(raw))
+	}
+	return got
+}
+
+func write(t *testing.T, w io.Writer, entries ...string) {
+	t.Helper()
+	for _, e := range entries {
+		if _, err := io.WriteString(w, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.log")
+	r, err := OpenRotator(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close() //nolint:errcheck
+
+	for _, tc := range []struct {
+		write string
+		want  []string
+	}{
+		{"aaaaa\n", []string{"aaaaa\n", "", "", ""}},
+		// an entry that would take the file past the limit starts a new one
+		{"bbbbb\n", []string{"bbbbb\n", "aaaaa\n", "", ""}},
+		// one that reaches it does not
+		{"ccc\n", []string{"bbbbb\nccc\n", "aaaaa\n", "", ""}},
+		{"ddddd\n", []string{"ddddd\n", "bbbbb\nccc\n", "aaaaa\n", ""}},
+		// the oldest goes once MaxFiles are kept
+		{"eeeee\n", []string{"eeeee\n", "ddddd\n", "bbbbb\nccc\n", ""}},
+		// entries bigger than the limit are written whole
+		{"ffffffffffff\n", []string{"ffffffffffff\n", "eeeee\n", "ddddd\n", ""}},
+		{"g\n", []string{"g\n", "ffffffffffff\n", "eeeee\n", ""}},
+	} {
+		write(t, r, tc.write)
+		got := files(t, path, 4)
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("after %q: file %d is %q, want %q", tc.write, i, got[i], tc.want[i])
+			}
+		}
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Write([]byte("h\n")); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("err = %v writing after Close, want fs.ErrClosed", err)
+	}
+}
+
+func TestRotateReopened(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.log")
+	if err := os.WriteFile(path, []byte("aaaaaaaa\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	// the size of what is there already counts
+	r, err := OpenRotator(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(t, r, "bb\n")
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := files(t, path, 3); got[0] != "bb\n" || got[1] != "aaaaaaaa\n" || got[2] != "" {
+		t.Errorf("files %q", got)
+	}
+}
+
+func TestRotateKeepingNone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.log")
+	r, err := OpenRotator(path, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close() //nolint:errcheck
+
+	// the file starts over
+	write(t, r, "aaaaa\n", "bbbbb\n")
+	if got := files(t, path, 2); got[0] != "bbbbb\n" || got[1] != "" {
+		t.Errorf("files %q", got)
+	}
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"codeberg.org/splitringresonator/multiband/internal/chat"
+)
+
+// backend passes updates on from its Backend, recording how the queue moves
+type backend struct {
+	chat.Backend
+	m       *Metrics
+	updates chan chat.Message
+	// pending are the outgoing messages not acked or failed yet, as last
+	// seen
+	pending map[string]chat.Message
+}
+
+// Chat is b with every update recorded on the way through, until ctx is
+// done. Updates must be drained from it in place of b.
+func (m *Metrics) Chat(ctx context.Context, b chat.Backend) chat.Backend {
+	w := &backend{Backend: b, m: m, updates: make(chan chat.Message, 64), pending: map[string]chat.Message{}}
+	go w.run(ctx)
+	return w
+}
+
+func (w *backend) Updates() <-chan chat.Message { return w.updates }
+
+func (w *backend) run(ctx context.Context) {
+	defer close(w.updates)
+	defer w.forget()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-w.Backend.Updates():
+			if !ok {
+				return
+			}
+			w.record(msg)
+			select {
+			case w.updates <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (w *backend) record(msg chat.Message) {
+	m := w.m
+	if !msg.Outgoing {
+		m.received.WithLabelValues(msg.Network).Inc()
+		return
+	}
+
+	prev, seen := w.pending[msg.ID]
+	if seen {
+		m.queue.WithLabelValues(prev.Status.String()).Dec()
+	}
+	if msg.Attempts > 1 {
+		m.retries.WithLabelValues(msg.Network).Add(float64(msg.Attempts - max(prev.Attempts, 1)))
+	}
+
+	switch msg.Status {
+	case chat.Queued, chat.Sent:
+		w.pending[msg.ID] = msg
+		m.queue.WithLabelValues(msg.Status.String()).Inc()
+	case chat.Acked:
+		delete(w.pending, msg.ID)
+		m.latency.WithLabelValues(msg.Network).Observe(time.Since(msg.Time).Seconds())
+	case chat.Failed:
+		delete(w.pending, msg.ID)
+		m.failed.WithLabelValues(msg.Network).Inc()
+	}
+}
+
+// forget takes the messages still pending off the queue, as the backend
+// they are in is no longer watched
+func (w *backend) forget() {
+	for _, msg := range w.pending {
+		w.m.queue.WithLabelValues(msg.Status.String()).Dec()
+	}
+	clear(w.pending)
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"context"
+
+	"codeberg.org/splitringresonator/multiband/internal/link"
+)
+
+// feed passes samples on from its Feed, recording each in the metrics
+type feed struct {
+	link.Feed
+	m       *Metrics
+	samples chan link.Sample
+	// last is the previous sample of each interface, its counts being
+	// totals to add the difference of
+	last map[string]link.Sample
+}
+
+// Links is f with every sample recorded on the way through, until ctx is
+// done. Samples must be drained from it in place of f.
+func (m *Metrics) Links(ctx context.Context, f link.Feed) link.Feed {
+	w := &feed{Feed: f, m: m, samples: make(chan link.Sample, 64), last: map[string]link.Sample{}}
+	go w.run(ctx)
+	return w
+}
+
+func (w *feed) Samples() <-chan link.Sample { return w.samples }
+
+func (w *feed) run(ctx context.Context) {
+	defer close(w.samples)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s, ok := <-w.Feed.Samples():
+			if !ok {
+				return
+			}
+			w.record(s)
+			select {
+			case w.samples <- s:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (w *feed) record(s link.Sample) {
+	m, name := w.m, s.Interface
+	prev := w.last[name]
+	w.last[name] = s
+
+	m.packets.WithLabelValues(name, "in").Add(grown(prev.PacketsIn, s.PacketsIn))
+	m.packets.WithLabelValues(name, "out").Add(grown(prev.PacketsOut, s.PacketsOut))
+	m.bytes.WithLabelValues(name, "in").Add(grown(prev.BytesIn, s.BytesIn))
+	m.bytes.WithLabelValues(name, "out").Add(grown(prev.BytesOut, s.BytesOut))
+	m.airtime.WithLabelValues(name).Set(s.Airtime.Seconds())
+
+	up := 0.0
+	if s.State != link.Down {
+		up = 1
+	}
+	m.up.WithLabelValues(name).Set(up)
+
+	for _, i := range w.Interfaces() {
+		if i.Name != name {
+			continue
+		}
+		m.budget.WithLabelValues(name).Set(i.Budget().Seconds())
+		// radios only, and only while they hear anything
+		if i.Modem != nil && s.State != link.Down {
+			m.rssi.WithLabelValues(name).Observe(s.RSSI)
+			m.snr.WithLabelValues(name).Observe(s.SNR)
+		}
+	}
+}
+
+// grown is how much a total went up by, all of it if it started over, as
+// an interface removed and added again does
+func grown(prev, next uint64) float64 {
+	if next < prev {
+		return float64(next)
+	}
+	return float64(next - prev)
+}
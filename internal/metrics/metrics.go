@@ -0,0 +1,138 @@
+// Package metrics exposes what a node does to Prometheus: traffic, airtime
+// and signal of each interface, the message queue and its deliveries, and
+// requests to the docs server
+package metrics
+
+import (
+	"net/http"
+	"runtime"
+
+	"codeberg.org/splitringresonator/multiband/internal/version"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes every metric
+const Namespace = "multiband"
+
+// Metrics are the collectors of a node. Feeds and backends are observed by
+// wrapping them with Links and Chat, and HTTP handlers with HTTP.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	packets *prometheus.CounterVec
+	bytes   *prometheus.CounterVec
+	up      *prometheus.GaugeVec
+	airtime *prometheus.GaugeVec
+	budget  *prometheus.GaugeVec
+	rssi    *prometheus.HistogramVec
+	snr     *prometheus.HistogramVec
+
+	queue    *prometheus.GaugeVec
+	latency  *prometheus.HistogramVec
+	retries  *prometheus.CounterVec
+	failed   *prometheus.CounterVec
+	received *prometheus.CounterVec
+
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		packets: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Subsystem: "interface", Name: "packets_total",
+			Help: "Packets heard and sent by an interface.",
+		}, []string{"interface", "direction"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Subsystem: "interface", Name: "bytes_total",
+			Help: "Bytes heard and sent by an interface.",
+		}, []string{"interface", "direction"}),
+		up: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace, Subsystem: "interface", Name: "up",
+			Help: "Whether an interface is up, degraded counting as up.",
+		}, []string{"interface"}),
+		airtime: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace, Subsystem: "interface", Name: "airtime_seconds",
+			Help: "Time an interface transmitted for over the last duty cycle window.",
+		}, []string{"interface"}),
+		budget: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace, Subsystem: "interface", Name: "airtime_budget_seconds",
+			Help: "Airtime an interface is allowed per duty cycle window, 0 if unlimited.",
+		}, []string{"interface"}),
+		rssi: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace, Subsystem: "interface", Name: "rssi_dbm",
+			Help:    "RSSI of the packets a radio hears, in dBm.",
+			Buckets: prometheus.LinearBuckets(-130, 10, 10),
+		}, []string{"interface"}),
+		snr: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace, Subsystem: "interface", Name: "snr_db",
+			Help:    "SNR of the packets a radio hears, in dB.",
+			Buckets: prometheus.LinearBuckets(-20, 4, 9),
+		}, []string{"interface"}),
+
+		queue: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace, Subsystem: "queue", Name: "messages",
+			Help: "Outgoing messages waiting for a path (queued) or for their peer to confirm them (sent).",
+		}, []string{"status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace, Subsystem: "queue", Name: "delivery_seconds",
+			Help:    "Time from queueing a message to its peer confirming it, by network.",
+			Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+		}, []string{"network"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Subsystem: "queue", Name: "retries_total",
+			Help: "Transmissions of messages beyond their first, by network.",
+		}, []string{"network"}),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Subsystem: "queue", Name: "failed_total",
+			Help: "Messages given up on, by network.",
+		}, []string{"network"}),
+		received: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Subsystem: "queue", Name: "received_total",
+			Help: "Messages received from peers, by network.",
+		}, []string{"network"}),
+
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Subsystem: "http", Name: "requests_total",
+			Help: "HTTP requests served, by handler, method and status code.",
+		}, []string{"handler", "method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace, Subsystem: "http", Name: "request_duration_seconds",
+			Help:    "Time taken to serve HTTP requests, by handler.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"handler"}),
+	}
+
+	build := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace, Name: "build_info",
+		Help:        "Always 1, labelled with the version and commit the node was built from.",
+		ConstLabels: prometheus.Labels{"version": version.Short, "commit": version.Commit, "goversion": runtime.Version()},
+	})
+	build.Set(1)
+
+	m.registry.MustRegister(
+		build,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.packets, m.bytes, m.up, m.airtime, m.budget, m.rssi, m.snr,
+		m.queue, m.latency, m.retries, m.failed, m.received,
+		m.requests, m.duration,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// HTTP has the requests next serves counted as those of the handler name
+func (m *Metrics) HTTP(name string, next http.Handler) http.Handler {
+	labels := prometheus.Labels{"handler": name}
+	return promhttp.InstrumentHandlerDuration(m.duration.MustCurryWith(labels),
+		promhttp.InstrumentHandlerCounter(m.requests.MustCurryWith(labels), next))
+}
@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"codeberg.org/splitringresonator/multiband/internal/chat"
+	"codeberg.org/splitringresonator/multiband/internal/link"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeFeed hands out the samples sent on its channel
+type fakeFeed struct {
+	interfaces []link.Interface
+	samples    chan link.Sample
+}
+
+func (f fakeFeed) Interfaces() []link.Interface     { return f.interfaces }
+func (f fakeFeed) Samples() <-chan link.Sample      { return f.samples }
+func (f fakeFeed) SetUp(name string, up bool) error { return nil }
+
+// fakeBackend hands out the updates sent on its channel
+type fakeBackend struct {
+	chat.Backend
+	updates chan chat.Message
+}
+
+func (b fakeBackend) Updates() <-chan chat.Message { return b.updates }
+
+func TestLinks(t *testing.T) {
+	m := New()
+	f := fakeFeed{
+		interfaces: []link.Interface{
+			{Name: "lora0", Kind: "lora", DutyCycle: 0.01, Modem: &link.Modem{SpreadingFactor: 9}},
+			{Name: "tcp0", Kind: "tcp"},
+		},
+		samples: make(chan link.Sample),
+	}
+	feed := m.Links(t.Context(), f)
+
+	for _, s := range []link.Sample{
+		{Interface: "lora0", State: link.Up, RSSI: -95, SNR: 7, PacketsIn: 3, PacketsOut: 1, BytesIn: 300, Airtime: time.Second},
+		{Interface: "lora0", State: link.Up, RSSI: -105, SNR: 2, PacketsIn: 5, PacketsOut: 2, BytesIn: 420, Airtime: 2 * time.Second},
+		{Interface: "tcp0", State: link.Up, PacketsIn: 10},
+		// the interface started over, so its totals all count
+		{Interface: "tcp0", State: link.Down, PacketsIn: 4},
+	} {
+		f.samples <- s
+		<-feed.Samples()
+	}
+
+	for _, tc := range []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"lora0 packets in", testutil.ToFloat64(m.packets.WithLabelValues("lora0", "in")), 5},
+		{"lora0 packets out", testutil.ToFloat64(m.packets.WithLabelValues("lora0", "out")), 2},
+		{"lora0 bytes in", testutil.ToFloat64(m.bytes.WithLabelValues("lora0", "in")), 420},
+		{"lora0 airtime", testutil.ToFloat64(m.airtime.WithLabelValues("lora0")), 2},
+		{"lora0 budget", testutil.ToFloat64(m.budget.WithLabelValues("lora0")), 36},
+		{"lora0 up", testutil.ToFloat64(m.up.WithLabelValues("lora0")), 1},
+		{"tcp0 packets in", testutil.ToFloat64(m.packets.WithLabelValues("tcp0", "in")), 14},
+		{"tcp0 up", testutil.ToFloat64(m.up.WithLabelValues("tcp0")), 0},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s = %g, want %g", tc.name, tc.got, tc.want)
+		}
+	}
+
+	// signal is only observed for radios
+	if n := testutil.CollectAndCount(m.rssi); n != 1 {
+		t.Errorf("rssi observed for %d interfaces, want 1", n)
+	}
+	want := `
+# HELP multiband_interface_snr_db SNR of the packets a radio hears, in dB.
+# TYPE multiband_interface_snr_db histogram
+multiband_interface_snr_db_bucket{interface="lora0",le="-20"} 0
+multiband_interface_snr_db_bucket{interface="lora0",le="-16"} 0
+multiband_interface_snr_db_bucket{interface="lora0",le="-12"} 0
+multiband_interface_snr_db_bucket{interface="lora0",le="-8"} 0
+multiband_interface_snr_db_bucket{interface="lora0",le="-4"} 0
+multiband_interface_snr_db_bucket{interface="lora0",le="0"} 0
+multiband_interface_snr_db_bucket{interface="lora0",le="4"} 1
+multiband_interface_snr_db_bucket{interface="lora0",le="8"} 2
+multiband_interface_snr_db_bucket{interface="lora0",le="12"} 2
+multiband_interface_snr_db_bucket{interface="lora0",le="+Inf"} 2
+multiband_interface_snr_db_sum{interface="lora0"} 9
+multiband_interface_snr_db_count{interface="lora0"} 2
+`
+	if err := testutil.CollectAndCompare(m.snr, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChat(t *testing.T) {
+	m := New()
+	b := fakeBackend{updates: make(chan chat.Message)}
+	ctx, cancel := context.WithCancel(t.Context())
+	backend := m.Chat(ctx, b)
+
+	queued := time.Now().Add(-3 * time.Second)
+	for _, msg := range []chat.Message{
+		{ID: "1", Outgoing: true, Network: "lora", Status: chat.Queued, Time: queued},
+		{ID: "2", Outgoing: true, Network: "lora", Status: chat.Queued, Time: queued},
+		{ID: "3", Outgoing: true, Network: "tcp", Status: chat.Queued, Time: queued},
+		{ID: "1", Outgoing: true, Network: "lora", Status: chat.Sent, Attempts: 1, Time: queued},
+		{ID: "2", Outgoing: true, Network: "lora", Status: chat.Sent, Attempts: 1, Time: queued},
+		{ID: "2", Outgoing: true, Network: "lora", Status: chat.Sent, Attempts: 2, Time: queued},
+		{ID: "2", Outgoing: true, Network: "lora", Status: chat.Sent, Attempts: 3, Time: queued},
+		{ID: "1", Outgoing: true, Network: "lora", Status: chat.Acked, Attempts: 1, Time: queued},
+		{ID: "2", Outgoing: true, Network: "lora", Status: chat.Failed, Attempts: 3, Time: queued},
+		{ID: "4", Network: "tcp", Status: chat.Acked},
+	} {
+		b.updates <- msg
+		<-backend.Updates()
+	}
+
+	for _, tc := range []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"queued", testutil.ToFloat64(m.queue.WithLabelValues("queued")), 1},
+		{"sent", testutil.ToFloat64(m.queue.WithLabelValues("sent")), 0},
+		{"lora retries", testutil.ToFloat64(m.retries.WithLabelValues("lora")), 2},
+		{"lora failed", testutil.ToFloat64(m.failed.WithLabelValues("lora")), 1},
+		{"tcp received", testutil.ToFloat64(m.received.WithLabelValues("tcp")), 1},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s = %g, want %g", tc.name, tc.got, tc.want)
+		}
+	}
+	if n := testutil.CollectAndCount(m.latency); n != 1 {
+		t.Errorf("latency observed for %d networks, want 1", n)
+	}
+
+	// messages still pending are taken off the queue once nothing watches it
+	cancel()
+	for range backend.Updates() {
+	}
+	if got := testutil.ToFloat64(m.queue.WithLabelValues("queued")); got != 0 {
+		t.Errorf("queued = %g after the backend stopped being watched, want 0", got)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	m := New()
+	h := m.HTTP("docs", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+		}
+	}))
+	for _, path := range []string{"/", "/", "/missing"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	if got := testutil.ToFloat64(m.requests.WithLabelValues("docs", "get", "200")); got != 2 {
+		t.Errorf("200s = %g, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.requests.WithLabelValues("docs", "get", "404")); got != 1 {
+		t.Errorf("404s = %g, want 1", got)
+	}
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), `multiband_http_requests_total{code="404",handler="docs",method="get"} 1`) {
+		t.Errorf("requests not exposed:\n%s", rec.Body.String())
+	}
+}
@@ -0,0 +1,421 @@
+package preprocess
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported diagram")
+	// ErrEmpty is a diagram with a header but no nodes to draw
+	ErrEmpty = errors.New("diagram has no nodes")
+)
+
+type Direction uint8
+
+const (
+	TopDown Direction = iota
+	LeftRight
+)
+
+type Node struct {
+	ID    string
+	Label string
+}
+
+type Edge struct {
+	From, To string
+	Label    string
+	// Directed edges are drawn with an arrow head
+	Directed bool
+}
+
+// Graph is a flowchart, as parsed from mermaid or dot
+type Graph struct {
+	Dir   Direction
+	Nodes []Node
+	Edges []Edge
+
+	index map[string]int
+}
+
+// node declares id, relabelling it if it was already declared
+func (g *Graph) node(id, label string) {
+	if g.index == nil {
+		g.index = map[string]int{}
+	}
+	if i, ok := g.index[id]; ok {
+		if label != "" {
+			g.Nodes[i].Label = label
+		}
+		return
+	}
+	if label == "" {
+		label = id
+	}
+	g.index[id] = len(g.Nodes)
+	g.Nodes = append(g.Nodes, Node{ID: id, Label: label})
+}
+
+func (g *Graph) edge(from, to, label string, directed bool) {
+	g.node(from, "")
+	g.node(to, "")
+	g.Edges = append(g.Edges, Edge{From: from, To: to, Label: label, Directed: directed})
+}
+
+var (
+	mermaidHeaderRe = regexp.MustCompile(`^(?:graph|flowchart)(?:\s+(TD|TB|BT|LR|RL))?\s*;?$`)
+	mermaidIDRe     = regexp.MustCompile(`^[\p{L}\p{N}_.-]+`)
+	// --> --- -.-> ==> with an optional |label|
+	mermaidArrowRe = regexp.MustCompile(`^\s*(<?[-=.]*[-=][-=.]*[>ox]?)\s*(?:\|([^|]*)\|)?\s*`)
+	// -- label --> and friends
+	mermaidTextArrowRe = regexp.MustCompile(`^\s*(?:--|==|-\.)\s+(.+?)\s+(-->|---|==>|===|\.->|\.-)\s*`)
+	mermaidSkipRe      = regexp.MustCompile(`^(?:classDef|class|style|linkStyle|click|subgraph|end|direction)\b`)
+)
+
+// ParseMermaid reads a mermaid flowchart. Styling statements and subgraphs are
+// ignored, other diagram types are ErrUnsupported.
+func ParseMermaid(src string) (*Graph, error) {
+	g := &Graph{}
+	header := false
+	for _, line := range strings.Split(src, "\n") {
+		if i := strings.Index(line, "%%"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !header {
+			m := mermaidHeaderRe.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("%w: %q", ErrUnsupported, line)
+			}
+			if m[1] == "LR" || m[1] == "RL" {
+				g.Dir = LeftRight
+			}
+			header = true
+			continue
+		}
+		for _, stmt := range strings.Split(line, ";") {
+			stmt = strings.TrimSpace(stmt)
+			if stmt == "" || mermaidSkipRe.MatchString(stmt) {
+				continue
+			}
+			if err := g.mermaidStatement(stmt); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !header {
+		return nil, fmt.Errorf("%w: empty", ErrUnsupported)
+	}
+	return g, nil
+}
+
+// mermaidStatement parses a chain of node groups joined by arrows, eg.
+// A[Start] --> B & C -->|yes| D
+func (g *Graph) mermaidStatement(stmt string) error {
+	rest := stmt
+	prev, rest, err := g.mermaidGroup(rest)
+	if err != nil {
+		return err
+	}
+	for strings.TrimSpace(rest) != "" {
+		var arrow, label string
+		if m := mermaidTextArrowRe.FindStringSubmatch(rest); m != nil {
+			label, arrow = m[1], m[2]
+			rest = rest[len(m[0]):]
+		} else if m := mermaidArrowRe.FindStringSubmatch(rest); m != nil && len(m[1]) >= 2 {
+			arrow, label = m[1], m[2]
+			rest = rest[len(m[0]):]
+		} else {
+			return fmt.Errorf("expected an arrow at %q", rest)
+		}
+
+		var next []string
+		next, rest, err = g.mermaidGroup(rest)
+		if err != nil {
+			return err
+		}
+		directed := strings.HasSuffix(arrow, ">")
+		for _, from := range prev {
+			for _, to := range next {
+				g.edge(from, to, cleanLabel(label), directed)
+			}
+		}
+		prev = next
+	}
+	return nil
+}
+
+// mermaidGroup parses nodes joined with &
+func (g *Graph) mermaidGroup(s string) ([]string, string, error) {
+	ids := []string{}
+	for {
+		id, rest, err := g.mermaidNode(s)
+		if err != nil {
+			return nil, s, err
+		}
+		ids = append(ids, id)
+		trimmed := strings.TrimLeft(rest, " \t")
+		if !strings.HasPrefix(trimmed, "&") {
+			return ids, rest, nil
+		}
+		s = trimmed[1:]
+	}
+}
+
+var closers = map[rune]rune{'[': ']', '(': ')', '{': '}', '>': ']'}
+
+// mermaidNode parses an id with an optional shape, eg. A, A[label], A((label))
+func (g *Graph) mermaidNode(s string) (string, string, error) {
+	s = strings.TrimLeft(s, " \t")
+	id := mermaidIDRe.FindString(s)
+	// ids may contain dashes, but an arrow may follow without a space
+	if i := strings.Index(id, "--"); i > 0 {
+		id = id[:i]
+	}
+	id = strings.TrimRight(id, "-.")
+	if id == "" {
+		return "", s, fmt.Errorf("expected a node at %q", s)
+	}
+	rest := s[len(id):]
+
+	label := ""
+	if rest != "" {
+		open := []rune(rest)[0]
+		if end, ok := closers[open]; ok {
+			// shapes nest their brackets, eg. [( )] or (( )), so the label
+			// runs until the first closing bracket of any kind
+			body := rest[1:]
+			close := strings.IndexFunc(body, func(r rune) bool { return r == end || r == ']' || r == ')' || r == '}' })
+			if quoted := strings.TrimLeft(body, "([{/\\"); strings.HasPrefix(quoted, `"`) {
+				if q := strings.Index(quoted[1:], `"`); q >= 0 {
+					offset := len(body) - len(quoted)
+					after := strings.IndexAny(body[offset+q+2:], "])}")
+					if after >= 0 {
+						close = offset + q + 2 + after
+					}
+				}
+			}
+			if close < 0 {
+				return "", s, fmt.Errorf("unterminated label at %q", rest)
+			}
+			label = cleanLabel(body[:close])
+			rest = strings.TrimLeft(body[close:], "])}")
+		}
+	}
+
+	g.node(id, label)
+	return id, rest, nil
+}
+
+// cleanLabel strips shape punctuation and quotes, turning <br> into newlines
+func cleanLabel(s string) string {
+	s = strings.Trim(strings.TrimSpace(s), `([{/\)]}`)
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	for _, br := range []string{"<br/>", "<br />", "<br>", `\n`} {
+		s = strings.ReplaceAll(s, br, "\n")
+	}
+	return strings.TrimSpace(s)
+}
+
+// ParseDot reads a graphviz graph or digraph. Attributes other than label and
+// rankdir are ignored, and subgraphs are flattened.
+func ParseDot(src string) (*Graph, error) {
+	p := &dotParser{toks: dotTokens(src)}
+	g := &Graph{}
+
+	if p.peek() == "strict" {
+		p.next()
+	}
+	kind := p.next()
+	if kind != "graph" && kind != "digraph" {
+		return nil, fmt.Errorf("%w: expected graph or digraph, got %q", ErrUnsupported, kind)
+	}
+	p.directed = kind == "digraph"
+	if p.peek() != "{" {
+		p.next() // graph name
+	}
+	if p.next() != "{" {
+		return nil, errors.New("expected {")
+	}
+	if err := p.stmts(g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+type dotParser struct {
+	toks     []string
+	pos      int
+	directed bool
+}
+
+func (p *dotParser) peek() string {
+	if p.pos >= len(p.toks) {
+		return ""
+	}
+	return p.toks[p.pos]
+}
+
+func (p *dotParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// stmts parses statements up to the closing brace
+func (p *dotParser) stmts(g *Graph) error {
+	for {
+		switch t := p.peek(); t {
+		case "":
+			return errors.New("expected }")
+		case "}":
+			p.next()
+			return nil
+		case ";", ",":
+			p.next()
+		case "graph", "node", "edge":
+			p.next()
+			if p.peek() == "[" {
+				p.attrs()
+			}
+		case "subgraph", "{":
+			if t == "subgraph" {
+				p.next()
+				if p.peek() != "{" {
+					p.next()
+				}
+			}
+			if p.next() != "{" {
+				return errors.New("expected { after subgraph")
+			}
+			if err := p.stmts(g); err != nil {
+				return err
+			}
+		default:
+			if err := p.stmt(g); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (p *dotParser) stmt(g *Graph) error {
+	id := unquote(p.next())
+	if p.peek() == "=" {
+		p.next()
+		if v := unquote(p.next()); id == "rankdir" && (v == "LR" || v == "RL") {
+			g.Dir = LeftRight
+		}
+		return nil
+	}
+
+	chain := []string{id}
+	for p.peek() == "->" || p.peek() == "--" {
+		p.next()
+		next := p.next()
+		if next == "" || next == "{" || next == "}" {
+			return fmt.Errorf("expected a node after %s", id)
+		}
+		chain = append(chain, unquote(next))
+	}
+
+	attrs := map[string]string{}
+	if p.peek() == "[" {
+		attrs = p.attrs()
+	}
+
+	if len(chain) == 1 {
+		g.node(id, cleanLabel(attrs["label"]))
+		return nil
+	}
+	for i := 0; i+1 < len(chain); i++ {
+		g.edge(chain[i], chain[i+1], cleanLabel(attrs["label"]), p.directed)
+	}
+	return nil
+}
+
+// attrs parses a [key=value, ...] list
+func (p *dotParser) attrs() map[string]string {
+	attrs := map[string]string{}
+	p.next() // [
+	for {
+		t := p.next()
+		switch t {
+		case "", "]":
+			return attrs
+		case ",", ";":
+			continue
+		}
+		if p.peek() == "=" {
+			p.next()
+			attrs[t] = unquote(p.next())
+		}
+	}
+}
+
+// dotTokens splits dot source into ids, quoted strings and punctuation,
+// dropping comments
+func dotTokens(src string) []string {
+	edgeOp := func(i int) bool {
+		return src[i] == '-' && i+1 < len(src) && (src[i+1] == '>' || src[i+1] == '-')
+	}
+
+	toks := []string{}
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#' || strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				return toks
+			}
+			i += end
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return toks
+			}
+			i += 2 + end + 2
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j+1, len(src))
+			toks = append(toks, src[i:j])
+			i = j
+		case edgeOp(i):
+			toks = append(toks, src[i:i+2])
+			i += 2
+		case strings.IndexByte("{}[];,=", c) >= 0:
+			toks = append(toks, src[i:i+1])
+			i++
+		default:
+			j := i
+			for j < len(src) && !strings.ContainsRune(" \t\r\n{}[];,=\"", rune(src[j])) && !edgeOp(j) {
+				j++
+			}
+			toks = append(toks, src[i:j])
+			i = j
+		}
+	}
+	return toks
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return strings.ReplaceAll(s[1:len(s)-1], `\"`, `"`)
+	}
+	return s
+}
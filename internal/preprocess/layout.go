@@ -0,0 +1,303 @@
+package preprocess
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Layouts are measured in terminal cells, and scaled up for SVG
+
+const (
+	// rankGap is the space between ranks taken up by edges, plus room for
+	// labels in left to right layouts
+	rankGap = 3
+	// nodeGap separates nodes within a rank
+	nodeGap = 3
+)
+
+type point struct{ x, y int }
+
+type box struct {
+	x, y, w, h int
+	lines      []string
+}
+
+func (b box) center() point { return point{b.x + b.w/2, b.y + b.h/2} }
+
+// route is an edge drawn as a polyline. The first and last points lie on the
+// borders of the boxes it joins.
+type route struct {
+	points   []point
+	label    string
+	labelAt  point
+	directed bool
+}
+
+type layout struct {
+	dir    Direction
+	boxes  []box
+	routes []route
+	w, h   int
+}
+
+// ranks assigns each node the length of the longest path reaching it,
+// ignoring edges that close a cycle
+func ranks(g *Graph) []int {
+	n := len(g.Nodes)
+	out := make([][]int, n)
+	for _, e := range g.Edges {
+		out[g.index[e.From]] = append(out[g.index[e.From]], g.index[e.To])
+	}
+
+	// depth first search in declaration order, dropping back edges
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, n)
+	order := []int{}
+	forward := make([][]int, n)
+	var visit func(int)
+	visit = func(u int) {
+		state[u] = visiting
+		for _, v := range out[u] {
+			switch state[v] {
+			case unvisited:
+				forward[u] = append(forward[u], v)
+				visit(v)
+			case done:
+				forward[u] = append(forward[u], v)
+			}
+		}
+		state[u] = done
+		order = append(order, u)
+	}
+	for u := range n {
+		if state[u] == unvisited {
+			visit(u)
+		}
+	}
+
+	rank := make([]int, n)
+	for i := len(order) - 1; i >= 0; i-- {
+		u := order[i]
+		for _, v := range forward[u] {
+			rank[v] = max(rank[v], rank[u]+1)
+		}
+	}
+	return rank
+}
+
+// arrange orders the nodes within each rank by the average position of
+// their predecessors, to cut down on crossings
+func arrange(g *Graph, rank []int) [][]int {
+	layers := [][]int{}
+	for u, r := range rank {
+		for len(layers) <= r {
+			layers = append(layers, []int{})
+		}
+		layers[r] = append(layers[r], u)
+	}
+	if len(layers) == 0 {
+		return layers
+	}
+
+	preds := make([][]int, len(g.Nodes))
+	for _, e := range g.Edges {
+		from, to := g.index[e.From], g.index[e.To]
+		if rank[from] < rank[to] {
+			preds[to] = append(preds[to], from)
+		}
+	}
+
+	pos := make([]float64, len(g.Nodes))
+	for sweep := 0; sweep < 2; sweep++ {
+		for _, layer := range layers {
+			for i, u := range layer {
+				pos[u] = float64(i)
+			}
+		}
+		for _, layer := range layers[1:] {
+			bary := map[int]float64{}
+			for _, u := range layer {
+				if len(preds[u]) == 0 {
+					bary[u] = pos[u]
+					continue
+				}
+				sum := 0.0
+				for _, p := range preds[u] {
+					sum += pos[p]
+				}
+				bary[u] = sum / float64(len(preds[u]))
+			}
+			slices.SortStableFunc(layer, func(a, b int) int {
+				switch {
+				case bary[a] < bary[b]:
+					return -1
+				case bary[a] > bary[b]:
+					return 1
+				}
+				return 0
+			})
+			for i, u := range layer {
+				pos[u] = float64(i)
+			}
+		}
+	}
+	return layers
+}
+
+func newBox(label string) box {
+	lines := strings.Split(label, "\n")
+	w := 0
+	for _, l := range lines {
+		w = max(w, ansi.StringWidth(l))
+	}
+	return box{w: w + 4, h: len(lines) + 2, lines: lines}
+}
+
+// Layout places the nodes in ranks along the direction of the graph and
+// routes the edges between them. Edges between neighbouring ranks take the
+// gap between those ranks; any other edge goes around the outside.
+func (g *Graph) layout() layout {
+	rank := ranks(g)
+	layers := arrange(g, rank)
+
+	l := layout{dir: g.Dir, boxes: make([]box, len(g.Nodes))}
+	for i, n := range g.Nodes {
+		l.boxes[i] = newBox(n.Label)
+	}
+
+	// labels need room along the edges of left to right layouts
+	labelRoom := 0
+	for _, e := range g.Edges {
+		labelRoom = max(labelRoom, ansi.StringWidth(e.Label))
+	}
+
+	// across is the extent of a rank perpendicular to the flow, along its
+	// size in the direction of flow
+	spacing := nodeGap
+	if g.Dir == LeftRight {
+		spacing = 1
+	}
+	across := make([]int, len(layers))
+	along := make([]int, len(layers))
+	for r, layer := range layers {
+		for i, u := range layer {
+			b := l.boxes[u]
+			a, d := b.w, b.h
+			if g.Dir == LeftRight {
+				a, d = b.h, b.w
+			}
+			if i > 0 {
+				across[r] += spacing
+			}
+			across[r] += a
+			along[r] = max(along[r], d)
+		}
+	}
+	widest := 0
+	if len(across) > 0 {
+		widest = slices.Max(across)
+	}
+
+	gap := rankGap
+	if g.Dir == LeftRight && labelRoom > 0 {
+		gap += labelRoom + 2
+	}
+	// a gap before the first rank leaves room for edges coming back around
+	offset := rankGap
+	starts := make([]int, len(layers))
+	for r, layer := range layers {
+		starts[r] = offset
+		cursor := (widest - across[r]) / 2
+		for _, u := range layer {
+			b := &l.boxes[u]
+			if g.Dir == TopDown {
+				b.x, b.y = cursor, offset
+				cursor += b.w + spacing
+			} else {
+				b.x, b.y = offset, cursor
+				cursor += b.h + spacing
+			}
+		}
+		offset += along[r] + gap
+	}
+
+	if g.Dir == TopDown {
+		l.w, l.h = widest, offset
+	} else {
+		l.w, l.h = offset, widest
+	}
+
+	lanes := 0
+	for _, e := range g.Edges {
+		from, to := g.index[e.From], g.index[e.To]
+		src, dst := l.boxes[from], l.boxes[to]
+		rt := route{label: e.Label, directed: e.Directed}
+
+		// the first free row or column after the rank of the source
+		end := starts[rank[from]] + along[rank[from]]
+		if rank[to] == rank[from]+1 {
+			rt.points, rt.labelAt = l.direct(src, dst, end)
+		} else {
+			rt.points, rt.labelAt = l.around(src, dst, end, lanes)
+			lanes++
+		}
+		l.routes = append(l.routes, rt)
+	}
+
+	// grow to fit the lanes and labels
+	for _, rt := range l.routes {
+		for _, p := range rt.points {
+			l.w, l.h = max(l.w, p.x+1), max(l.h, p.y+1)
+		}
+		if rt.label != "" {
+			l.w = max(l.w, rt.labelAt.x+ansi.StringWidth(rt.label))
+			l.h = max(l.h, rt.labelAt.y+1)
+		}
+	}
+	return l
+}
+
+// direct routes an edge across the gap after the rank of src, which
+// starts at end
+func (l *layout) direct(src, dst box, end int) ([]point, point) {
+	s, d := src.center(), dst.center()
+	// leave straight towards dst when the boxes overlap, rather than jogging
+	// between their centres
+	if l.dir == TopDown && d.x > src.x && d.x < src.x+src.w-1 {
+		s.x = d.x
+	}
+	if l.dir == LeftRight && d.y > src.y && d.y < src.y+src.h-1 {
+		s.y = d.y
+	}
+	bend := end + 1
+	if l.dir == TopDown {
+		pts := []point{{s.x, src.y + src.h - 1}, {s.x, bend}, {d.x, bend}, {d.x, dst.y}}
+		return pts, point{d.x + 2, dst.y - 1}
+	}
+	pts := []point{{src.x + src.w - 1, s.y}, {bend, s.y}, {bend, d.y}, {dst.x, d.y}}
+	return pts, point{bend + 2, d.y}
+}
+
+// around routes an edge out to its own lane beyond the laid out ranks and
+// back, for edges that skip ranks, stay within one or point backwards
+func (l *layout) around(src, dst box, end, lane int) ([]point, point) {
+	// keep to the far side of the boxes, clear of the direct edges
+	s := point{src.x + src.w - 2, src.y + src.h - 2}
+	d := point{dst.x + dst.w - 2, dst.y + dst.h - 2}
+	if l.dir == TopDown {
+		x := l.w + 1 + 2*lane
+		above := dst.y - 2
+		pts := []point{{s.x, src.y + src.h - 1}, {s.x, end}, {x, end}, {x, above}, {d.x, above}, {d.x, dst.y}}
+		return pts, point{x + 2, (end + above) / 2}
+	}
+	y := l.h + 1 + lane
+	before := dst.x - 2
+	pts := []point{{src.x + src.w - 1, s.y}, {end, s.y}, {end, y}, {before, y}, {before, d.y}, {dst.x, d.y}}
+	return pts, point{(end + before) / 2, y}
+}
@@ -0,0 +1,125 @@
+// Package preprocess rewrites markdown before it is rendered: fenced mermaid
+// and dot flowcharts become box drawings or SVG, and tables too wide for the
+// terminal are reflowed into lists
+package preprocess
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Format is what diagrams are turned into
+type Format uint8
+
+const (
+	// Code leaves diagrams as fenced code
+	Code Format = iota
+	// Text draws diagrams with box drawing characters, for terminals
+	Text
+	// SVG draws diagrams as inline SVG, for HTML
+	SVG
+)
+
+type Options struct {
+	Diagrams Format
+	// Width reflows tables wider than this many cells, unless zero
+	Width int
+}
+
+var fenceOpenRe = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})\\s*([\\w-]*)")
+
+// Parse reads a diagram given the info string of its fence. Diagrams
+// without nodes are ErrEmpty, there being nothing to draw.
+func Parse(lang, src string) (*Graph, error) {
+	var (
+		g   *Graph
+		err error
+	)
+	switch lang {
+	case "mermaid":
+		g, err = ParseMermaid(src)
+	case "dot", "graphviz":
+		g, err = ParseDot(src)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(g.Nodes) == 0 {
+		return nil, ErrEmpty
+	}
+	return g, nil
+}
+
+// Markdown applies opts to raw. Diagrams that fail to parse are left as code.
+func Markdown(raw []byte, opts Options) []byte {
+	if opts.Diagrams == Code && opts.Width <= 0 {
+		return raw
+	}
+
+	lines := strings.Split(string(raw), "\n")
+	out := make([]string, 0, len(lines))
+	diagrams := 0
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if m := fenceOpenRe.FindStringSubmatch(line); m != nil {
+			// find the closing fence, or the end of the document
+			end := i + 1
+			for end < len(lines) && !closesFence(lines[end], m[1]) {
+				end++
+			}
+			body := strings.Join(lines[i+1:min(end, len(lines))], "\n")
+			block := lines[i:min(end+1, len(lines))]
+			i = end
+
+			if opts.Diagrams != Code {
+				if g, err := Parse(m[2], body); err == nil {
+					diagrams++
+					out = append(out, diagram(g, opts.Diagrams, diagrams)...)
+					continue
+				}
+			}
+			out = append(out, block...)
+			continue
+		}
+
+		if opts.Width > 0 && strings.Contains(line, "|") && i+1 < len(lines) && tableDelimRe.MatchString(lines[i+1]) {
+			header := splitRow(line)
+			end := i + 2
+			rows := [][]string{}
+			for end < len(lines) && strings.TrimSpace(lines[end]) != "" && strings.Contains(lines[end], "|") {
+				rows = append(rows, splitRow(lines[end]))
+				end++
+			}
+			if tableWidth(append([][]string{header}, rows...)) > opts.Width {
+				out = append(out, reflowTable(header, rows)...)
+			} else {
+				out = append(out, lines[i:end]...)
+			}
+			i = end - 1
+			continue
+		}
+
+		out = append(out, line)
+	}
+
+	return []byte(strings.Join(out, "\n"))
+}
+
+// diagram renders g in place of its fenced block
+func diagram(g *Graph, f Format, n int) []string {
+	if f == SVG {
+		// a raw HTML block, which must not contain blank lines
+		return []string{"", `<figure class="diagram">` + g.SVG(strconv.Itoa(n)) + `</figure>`, ""}
+	}
+	return []string{"```text", g.Text(), "```"}
+}
+
+func closesFence(line, open string) bool {
+	t := strings.TrimSpace(line)
+	return strings.HasPrefix(t, open[:1]) && len(t) >= len(open) && strings.Trim(t, open[:1]) == ""
+}
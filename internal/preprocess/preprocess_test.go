@@ -0,0 +1,60 @@
+package preprocess
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEmptyDiagramLeftAsCode(t *testing.T) {
+	for _, src := range []string{
+		"```mermaid\ngraph\n```",
+		"```mermaid\nflowchart LR\n%% nothing here\n```",
+		"```dot\ndigraph {}\n```",
+	} {
+		for _, f := range []Format{Text, SVG} {
+			got := string(Markdown([]byte(src), Options{Diagrams: f}))
+			if got != src {
+				t.Errorf("Markdown(%q, %d) = %q, want it unchanged", src, f, got)
+			}
+		}
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	if _, err := Parse("mermaid", "graph"); !errors.Is(err, ErrEmpty) {
+		t.Errorf("Parse of a bare header: got %v, want ErrEmpty", err)
+	}
+	if _, err := Parse("mermaid", "graph\nA --> B"); err != nil {
+		t.Errorf("Parse of A --> B: %v", err)
+	}
+}
+
+func TestEmptyGraphLayout(t *testing.T) {
+	g := &Graph{}
+	if got := g.Text(); strings.TrimSpace(got) != "" {
+		t.Errorf("Text of an empty graph = %q", got)
+	}
+	if got := g.SVG("1"); !strings.HasPrefix(got, "<svg") {
+		t.Errorf("SVG of an empty graph = %q", got)
+	}
+}
+
+func FuzzMarkdown(f *testing.F) {
+	for _, seed := range []string{
+		"```mermaid\ngraph\n```",
+		"```mermaid\ngraph TD\nA[Start] --> B{Ok?}\nB -->|yes| C\nB -->|no| A\n```",
+		"```mermaid\nflowchart LR\nA & B --> C;C -.-> A\n```",
+		"```dot\ndigraph g { rankdir=LR; a -> b [label=x]; b -> a }\n```",
+		"```dot\ngraph {}\n```",
+		"| a | b |\n|---|---|\n| long cell | another long cell |\n",
+		"```mermaid\n",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		for _, f := range []Format{Text, SVG} {
+			Markdown([]byte(src), Options{Diagrams: f, Width: 20})
+		}
+	})
+}
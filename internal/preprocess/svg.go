@@ -0,0 +1,59 @@
+package preprocess
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// cell size in pixels, chosen to fit a 13px monospace font
+const (
+	cellW = 8
+	cellH = 16
+)
+
+func px(p point) (int, int) {
+	return p.x*cellW + cellW/2, p.y*cellH + cellH/2
+}
+
+// SVG draws the graph as a standalone inline SVG element. id keeps the arrow
+// marker distinct when a page holds several diagrams.
+func (g *Graph) SVG(id string) string {
+	l := g.layout()
+	marker := "arrow-" + id
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" class="diagram" viewBox="0 0 %d %d" width="%d" height="%d" role="img" font-family="monospace" font-size="13" fill="none" stroke="currentColor">`,
+		l.w*cellW, l.h*cellH, l.w*cellW, l.h*cellH)
+	fmt.Fprintf(&b, `<defs><marker id="%s" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto-start-reverse"><path d="M0,0L10,5L0,10z" fill="currentColor" stroke="none"/></marker></defs>`, marker)
+
+	for _, bx := range l.boxes {
+		x, y := px(point{bx.x, bx.y})
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" rx="4"/>`, x, y, (bx.w-1)*cellW, (bx.h-1)*cellH)
+		cx := x + (bx.w-1)*cellW/2
+		for i, line := range bx.lines {
+			_, ty := px(point{0, bx.y + 1 + i})
+			fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" dominant-baseline="central" fill="currentColor" stroke="none">%s</text>`, cx, ty, html.EscapeString(line))
+		}
+	}
+
+	for _, rt := range l.routes {
+		pts := []string{}
+		for _, p := range rt.points {
+			x, y := px(p)
+			pts = append(pts, fmt.Sprintf("%d,%d", x, y))
+		}
+		end := ""
+		if rt.directed {
+			end = fmt.Sprintf(` marker-end="url(#%s)"`, marker)
+		}
+		fmt.Fprintf(&b, `<polyline points="%s"%s/>`, strings.Join(pts, " "), end)
+		if rt.label != "" {
+			x, y := px(rt.labelAt)
+			fmt.Fprintf(&b, `<text x="%d" y="%d" dominant-baseline="central" fill="currentColor" stroke="none">%s</text>`, x-cellW/2, y, html.EscapeString(rt.label))
+		}
+	}
+
+	b.WriteString(`</svg>`)
+	return b.String()
+}
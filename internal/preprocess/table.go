@@ -0,0 +1,77 @@
+package preprocess
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+var tableDelimRe = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+
+// splitRow splits a table row into trimmed cells, honouring escaped pipes
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+
+	cells := []string{}
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// tableWidth is how wide the table renders: every column at its widest cell,
+// padded and separated by a border
+func tableWidth(rows [][]string) int {
+	widths := []int{}
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], ansi.StringWidth(cell))
+		}
+	}
+	w := 1
+	for _, cw := range widths {
+		w += cw + 3
+	}
+	return w
+}
+
+// reflowTable lays a table out as one block per row, headed by its first
+// cell and listing the other columns under it
+func reflowTable(header []string, rows [][]string) []string {
+	out := []string{""}
+	for n, row := range rows {
+		title := fmt.Sprintf("Row %d", n+1)
+		if len(row) > 0 && row[0] != "" {
+			title = row[0]
+		}
+		out = append(out, "**"+title+"**", "")
+		for i := 1; i < len(row); i++ {
+			name := fmt.Sprintf("Column %d", i+1)
+			if i < len(header) && header[i] != "" {
+				name = header[i]
+			}
+			out = append(out, fmt.Sprintf("- %s: %s", name, row[i]))
+		}
+		out = append(out, "")
+	}
+	return out
+}
@@ -0,0 +1,226 @@
+package preprocess
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// connections of a line cell to its neighbours
+const (
+	up uint8 = 1 << iota
+	down
+	left
+	right
+)
+
+var lineGlyphs = map[uint8]rune{
+	up:                       '│',
+	down:                     '│',
+	up | down:                '│',
+	left:                     '─',
+	right:                    '─',
+	left | right:             '─',
+	down | right:             '┌',
+	down | left:              '┐',
+	up | right:               '└',
+	up | left:                '┘',
+	up | down | right:        '├',
+	up | down | left:         '┤',
+	down | left | right:      '┬',
+	up | left | right:        '┴',
+	up | down | left | right: '┼',
+}
+
+var arrows = map[uint8]rune{up: '▲', down: '▼', left: '◀', right: '▶'}
+
+type canvas struct {
+	text  [][]rune
+	lines [][]uint8
+}
+
+func newCanvas(w, h int) *canvas {
+	c := &canvas{text: make([][]rune, h), lines: make([][]uint8, h)}
+	for y := range h {
+		c.text[y] = make([]rune, w)
+		c.lines[y] = make([]uint8, w)
+	}
+	return c
+}
+
+func (c *canvas) in(p point) bool {
+	return p.y >= 0 && p.y < len(c.text) && p.x >= 0 && p.x < len(c.text[p.y])
+}
+
+func (c *canvas) set(p point, r rune) {
+	if c.in(p) {
+		c.text[p.y][p.x] = r
+	}
+}
+
+// write puts s on the canvas from p, skipping the second cell of wide runes
+func (c *canvas) write(p point, s string) {
+	for _, r := range s {
+		c.set(p, r)
+		p.x += max(1, ansi.StringWidth(string(r)))
+	}
+}
+
+func (c *canvas) box(b box) {
+	for x := b.x; x < b.x+b.w; x++ {
+		c.set(point{x, b.y}, '─')
+		c.set(point{x, b.y + b.h - 1}, '─')
+	}
+	for y := b.y; y < b.y+b.h; y++ {
+		c.set(point{b.x, y}, '│')
+		c.set(point{b.x + b.w - 1, y}, '│')
+	}
+	c.set(point{b.x, b.y}, '┌')
+	c.set(point{b.x + b.w - 1, b.y}, '┐')
+	c.set(point{b.x, b.y + b.h - 1}, '└')
+	c.set(point{b.x + b.w - 1, b.y + b.h - 1}, '┘')
+	for i, line := range b.lines {
+		pad := (b.w - 2 - ansi.StringWidth(line)) / 2
+		c.write(point{b.x + 1 + pad, b.y + 1 + i}, line)
+	}
+}
+
+// cells expands a polyline into every cell it passes through
+func cells(pts []point) []point {
+	out := []point{pts[0]}
+	for i := 1; i < len(pts); i++ {
+		p := out[len(out)-1]
+		q := pts[i]
+		for p != q {
+			switch {
+			case p.x < q.x:
+				p.x++
+			case p.x > q.x:
+				p.x--
+			case p.y < q.y:
+				p.y++
+			default:
+				p.y--
+			}
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// towards is the connection from p to its neighbour q
+func towards(p, q point) uint8 {
+	switch {
+	case q.y < p.y:
+		return up
+	case q.y > p.y:
+		return down
+	case q.x < p.x:
+		return left
+	}
+	return right
+}
+
+var opposite = map[uint8]uint8{up: down, down: up, left: right, right: left}
+
+// edge draws a route between the borders of two boxes
+func (c *canvas) edge(rt route) {
+	path := cells(rt.points)
+	if len(path) < 3 {
+		return
+	}
+	for i := 0; i+1 < len(path); i++ {
+		p, q := path[i], path[i+1]
+		if c.in(p) && c.in(q) {
+			c.lines[p.y][p.x] |= towards(p, q)
+			c.lines[q.y][q.x] |= opposite[towards(p, q)]
+		}
+	}
+
+	// tee off the border the edge leaves from
+	start := path[0]
+	switch towards(start, path[1]) {
+	case down:
+		c.set(start, '┬')
+	case right:
+		c.set(start, '├')
+	case up:
+		c.set(start, '┴')
+	case left:
+		c.set(start, '┤')
+	}
+
+	last, end := path[len(path)-2], path[len(path)-1]
+	if rt.directed {
+		c.set(last, arrows[towards(last, end)])
+		return
+	}
+	switch towards(last, end) {
+	case down:
+		c.set(end, '┴')
+	case right:
+		c.set(end, '┤')
+	case up:
+		c.set(end, '┬')
+	case left:
+		c.set(end, '├')
+	}
+}
+
+// Text draws the graph with box drawing characters
+func (g *Graph) Text() string {
+	l := g.layout()
+	c := newCanvas(l.w, l.h)
+	for _, b := range l.boxes {
+		c.box(b)
+	}
+	for _, rt := range l.routes {
+		c.edge(rt)
+	}
+	for _, rt := range l.routes {
+		if rt.label != "" {
+			c.write(rt.labelAt, rt.label)
+		}
+	}
+
+	rows := []string{}
+	for y := range c.text {
+		var b strings.Builder
+		for x, r := range c.text[y] {
+			switch {
+			case r == -1:
+			case r != 0:
+				b.WriteRune(r)
+				// wide runes cover the next cell
+				if ansi.StringWidth(string(r)) > 1 && x+1 < len(c.text[y]) {
+					c.text[y][x+1] = -1
+				}
+			case c.lines[y][x] != 0:
+				b.WriteRune(lineGlyphs[c.lines[y][x]])
+			default:
+				b.WriteByte(' ')
+			}
+		}
+		rows = append(rows, strings.TrimRight(b.String(), " "))
+	}
+
+	// drop the empty margins left for edges that were not needed
+	for len(rows) > 0 && rows[0] == "" {
+		rows = rows[1:]
+	}
+	for len(rows) > 0 && rows[len(rows)-1] == "" {
+		rows = rows[:len(rows)-1]
+	}
+	indent := -1
+	for _, row := range rows {
+		if row != "" && (indent < 0 || len(row)-len(strings.TrimLeft(row, " ")) < indent) {
+			indent = len(row) - len(strings.TrimLeft(row, " "))
+		}
+	}
+	for i, row := range rows {
+		if len(row) >= indent {
+			rows[i] = row[max(indent, 0):]
+		}
+	}
+	return strings.Join(rows, "\n")
+}
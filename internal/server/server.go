@@ -0,0 +1,196 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Config describes how an HTTP listener is exposed
+type Config struct {
+	// Listen is either host:port, or a unix socket given as unix:/path/to.sock
+	Listen string
+
+	// TLSCert and TLSKey are PEM files. When both are empty and SelfSigned is
+	// set, an ephemeral certificate is generated at startup.
+	TLSCert    string
+	TLSKey     string
+	SelfSigned bool
+
+	// BasicAuth is user:password. Token is compared against a bearer token
+	// in the Authorization header. Requests must satisfy either when set.
+	BasicAuth string
+	Token     string
+
+	// ShutdownTimeout bounds how long in-flight requests get to finish
+	ShutdownTimeout time.Duration
+}
+
+const DefaultShutdownTimeout = 10 * time.Second
+
+// Network splits Listen into the arguments for net.Listen
+func (c Config) Network() (network, address string) {
+	if path, ok := strings.CutPrefix(c.Listen, "unix:"); ok {
+		return "unix", path
+	}
+	if strings.HasPrefix(c.Listen, "/") || strings.HasPrefix(c.Listen, "./") {
+		return "unix", c.Listen
+	}
+	return "tcp", c.Listen
+}
+
+func (c Config) TLS() bool {
+	return c.TLSCert != "" || c.TLSKey != "" || c.SelfSigned
+}
+
+// Auth reports whether clients must authenticate
+func (c Config) Auth() bool {
+	return c.BasicAuth != "" || c.Token != ""
+}
+
+// URL is a best effort description of where the server can be reached
+func (c Config) URL() string {
+	network, address := c.Network()
+	if network == "unix" {
+		return "unix:" + address
+	}
+	scheme := "http"
+	if c.TLS() {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/", scheme, address)
+}
+
+func (c Config) validate() error {
+	if c.Listen == "" {
+		return errors.New("listen address is required")
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return errors.New("tls cert and key must be provided together")
+	}
+	if c.TLSCert != "" && c.SelfSigned {
+		return errors.New("self signed certificates cannot be combined with a provided cert")
+	}
+	if c.BasicAuth != "" && !strings.Contains(c.BasicAuth, ":") {
+		return errors.New("basic auth must be given as user:password")
+	}
+	return nil
+}
+
+// StallTimeout is how long a write of a response may be stuck before the
+// response is cut off
+const StallTimeout = 2 * time.Minute
+
+// New wraps handler with auth and request logging, and applies conservative
+// timeouts suitable for slow links. Responses are cut off once writing them
+// stalls, rather than after a fixed time, so large downloads over slow links
+// finish.
+func New(c Config, handler http.Handler, logger *slog.Logger) (*http.Server, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	handler = Auth(c.BasicAuth, c.Token, handler)
+	handler = Logging(logger, handler)
+	handler = Deadline(StallTimeout, handler)
+
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    64 << 10,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+
+	switch {
+	case c.SelfSigned:
+		_, address := c.Network()
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		cert, err := SelfSignedCert(host)
+		if err != nil {
+			return nil, err
+		}
+		srv.TLSConfig = &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{cert},
+		}
+	case c.TLSCert != "":
+		cert, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		srv.TLSConfig = &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{cert},
+		}
+	}
+
+	return srv, nil
+}
+
+// Listen opens the configured socket. Stale unix sockets left behind by a
+// previous process are removed first, but not those still listened on.
+func Listen(c Config) (net.Listener, error) {
+	network, address := c.Network()
+	if network == "unix" {
+		if fi, err := os.Stat(address); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			conn, err := net.Dial("unix", address)
+			if err == nil {
+				conn.Close() //nolint:errcheck
+				return nil, fmt.Errorf("%s is in use by another process", address)
+			}
+			if !errors.Is(err, syscall.ECONNREFUSED) {
+				return nil, err
+			}
+			if err := os.Remove(address); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return net.Listen(network, address)
+}
+
+// Serve runs srv on l until ctx is cancelled, then shuts down gracefully
+func Serve(ctx context.Context, srv *http.Server, l net.Listener, shutdownTimeout time.Duration) error {
+	if shutdownTimeout == 0 {
+		shutdownTimeout = DefaultShutdownTimeout
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			errc <- srv.Serve(tls.NewListener(l, srv.TLSConfig))
+		} else {
+			errc <- srv.Serve(l)
+		}
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
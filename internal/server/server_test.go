@@ -0,0 +1,282 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tc := range []struct {
+		name            string
+		userpass, token string
+		request         func(r *http.Request)
+		want            int
+		challenge       bool
+	}{
+		{name: "open", want: 200},
+		{name: "no credentials", userpass: "ops:hunter2", want: 401, challenge: true},
+		{name: "basic", userpass: "ops:hunter2", request: func(r *http.Request) { r.SetBasicAuth("ops", "hunter2") }, want: 200},
+		{name: "wrong password", userpass: "ops:hunter2", request: func(r *http.Request) { r.SetBasicAuth("ops", "hunter") }, want: 401, challenge: true},
+		{name: "wrong user", userpass: "ops:hunter2", request: func(r *http.Request) { r.SetBasicAuth("root", "hunter2") }, want: 401, challenge: true},
+		{name: "no token", token: "s3cret", want: 401},
+		{name: "token", token: "s3cret", request: bearer("s3cret"), want: 200},
+		{name: "wrong token", token: "s3cret", request: bearer("s3cre"), want: 401},
+		{name: "token not basic", token: "s3cret", request: func(r *http.Request) { r.SetBasicAuth("s3cret", "s3cret") }, want: 401},
+		{name: "either, token", userpass: "ops:hunter2", token: "s3cret", request: bearer("s3cret"), want: 200},
+		{name: "either, basic", userpass: "ops:hunter2", token: "s3cret", request: func(r *http.Request) { r.SetBasicAuth("ops", "hunter2") }, want: 200},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tc.request != nil {
+				tc.request(r)
+			}
+			rec := httptest.NewRecorder()
+			Auth(tc.userpass, tc.token, ok).ServeHTTP(rec, r)
+			if rec.Code != tc.want {
+				t.Errorf("status %d, want %d", rec.Code, tc.want)
+			}
+			if got := rec.Header().Get("WWW-Authenticate") != ""; got != tc.challenge {
+				t.Errorf("challenged %v, want %v", got, tc.challenge)
+			}
+		})
+	}
+}
+
+func bearer(token string) func(r *http.Request) {
+	return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+}
+
+func TestEqual(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want bool
+	}{
+		{"s3cret", "s3cret", true},
+		{"s3cret", "s3cre", false},
+		{"s3cret", "s3cret!", false},
+		{"", "", true},
+		{"", "s3cret", false},
+	} {
+		if got := equal(tc.a, tc.b); got != tc.want {
+			t.Errorf("equal(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestSelfSignedCert(t *testing.T) {
+	for _, tc := range []struct {
+		host    string
+		dns     []string
+		ips     int
+		verify  string
+		refused string
+	}{
+		{host: "", dns: []string{"localhost"}, ips: 2, verify: "localhost", refused: "node.example"},
+		{host: "node.example", dns: []string{"localhost", "node.example"}, ips: 2, verify: "node.example"},
+		{host: "192.0.2.7", dns: []string{"localhost"}, ips: 3, verify: "192.0.2.7"},
+		{host: "0.0.0.0", dns: []string{"localhost"}, ips: 2, verify: "127.0.0.1"},
+	} {
+		t.Run(tc.host, func(t *testing.T) {
+			cert, err := SelfSignedCert(tc.host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			leaf, err := x509.ParseCertificate(cert.Certificate[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(leaf.DNSNames, ",") != strings.Join(tc.dns, ",") {
+				t.Errorf("DNS names %v, want %v", leaf.DNSNames, tc.dns)
+			}
+			if len(leaf.IPAddresses) != tc.ips {
+				t.Errorf("IPs %v, want %d", leaf.IPAddresses, tc.ips)
+			}
+			if now := time.Now(); now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+				t.Errorf("not valid now, but %s to %s", leaf.NotBefore, leaf.NotAfter)
+			}
+			if err := leaf.VerifyHostname(tc.verify); err != nil {
+				t.Error(err)
+			}
+			if tc.refused != "" && leaf.VerifyHostname(tc.refused) == nil {
+				t.Errorf("valid for %s", tc.refused)
+			}
+		})
+	}
+}
+
+func TestServeSelfSigned(t *testing.T) {
+	c := Config{Listen: "127.0.0.1:0", SelfSigned: true}
+	srv, err := New(c, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello") //nolint:errcheck
+	}), slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := Listen(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go Serve(t.Context(), srv, l, time.Second) //nolint:errcheck
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + l.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	body, _ := io.ReadAll(resp.Body)
+	if resp.TLS == nil || string(body) != "hello" {
+		t.Errorf("got %q, over TLS %v", body, resp.TLS != nil)
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	dir, err := os.MkdirTemp("", "multiband")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) }) //nolint:errcheck
+	path := filepath.Join(dir, "docs.sock")
+	c := Config{Listen: "unix:" + path}
+
+	// a socket left behind by a process gone is taken over
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close() //nolint:errcheck
+	l, err := Listen(c)
+	if err != nil {
+		t.Fatalf("stale socket not taken over: %v", err)
+	}
+	defer l.Close() //nolint:errcheck
+
+	// one still listened on is not
+	if _, err := Listen(c); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("err = %v, want the socket in use", err)
+	}
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			conn.Close() //nolint:errcheck
+		}
+	}()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("socket in use removed: %v", err)
+	}
+	conn.Close() //nolint:errcheck
+
+	// nor is a file that is not a socket
+	file := filepath.Join(dir, "notes")
+	if err := os.WriteFile(file, []byte("keep"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen(Config{Listen: file}); err == nil {
+		t.Error("listened in place of a file")
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- Serve(ctx, srv, l, 200*time.Millisecond) }()
+	go http.Get("http://" + l.Addr().String() + "/") //nolint:errcheck,bodyclose
+	<-started
+
+	cancel()
+	start := time.Now()
+	select {
+	case err := <-served:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("err = %v, want the shutdown timed out", err)
+		}
+		if waited := time.Since(start); waited > 2*time.Second {
+			t.Errorf("shut down after %s", waited)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("still serving the request in flight")
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+	stuck := make(chan error, 1)
+	ts := httptest.NewServer(Deadline(timeout, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		chunk := []byte(strings.Repeat("x", 64<<10))
+		if r.URL.Path == "/stuck" {
+			// more than the socket buffers hold, for a client not reading
+			for range 1 << 10 {
+				if _, err := w.Write(chunk); err != nil {
+					stuck <- err
+					return
+				}
+			}
+			stuck <- nil
+			return
+		}
+		for range 5 {
+			time.Sleep(timeout / 2)
+			w.Write(chunk) //nolint:errcheck
+			rc.Flush()     //nolint:errcheck
+		}
+	})))
+	defer ts.Close()
+
+	// a response still going may take longer than the timeout
+	resp, err := http.Get(ts.URL + "/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close() //nolint:errcheck
+	if err != nil || len(body) != 5*64<<10 {
+		t.Errorf("slow response cut off after %d bytes: %v", len(body), err)
+	}
+
+	// one to a client that stopped reading is cut off
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() //nolint:errcheck
+	if _, err := io.WriteString(conn, "GET /stuck HTTP/1.1\r\nHost: test\r\n\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-stuck:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("err = %v, want the write deadline exceeded", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("response to a client not reading still going")
+	}
+}
@@ -1,20 +1,24 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 
 	"codeberg.org/splitringresonator/multiband/cmd"
+	"codeberg.org/splitringresonator/multiband/internal/docsite"
 	"github.com/spf13/cobra/doc"
 )
 
 func main() {
 	out := flag.String("out", "./docs/cli", "output directory")
-	format := flag.String("format", "markdown", "markdown|man|rest")
+	format := flag.String("format", "markdown", "markdown|man|rest|revisions")
 	front := flag.Bool("frontmatter", false, "prepend simple YAML front matter to markdown")
 	flag.Parse()
 
@@ -52,7 +56,52 @@ func main() {
 		if err := doc.GenReSTTree(root, *out); err != nil {
 			log.Fatal(err)
 		}
+	case "revisions":
+		// records the last commit touching each document under -out, for
+		// the docs browser to show. Run from within the git checkout.
+		if err := genRevisions(*out); err != nil {
+			log.Fatal(err)
+		}
 	default:
 		log.Fatalf("unknown format: %s", *format)
 	}
 }
+
+func genRevisions(dir string) error {
+	revs := map[string]docsite.Revision{}
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, ".md") {
+			return nil
+		}
+
+		out, err := exec.Command("git", "log", "-1", "--format=%h%x09%cs", "--", p).Output()
+		if err != nil {
+			return fmt.Errorf("git log %s: %w", p, err)
+		}
+		rev, date, ok := strings.Cut(strings.TrimSpace(string(out)), "\t")
+		if !ok {
+			// not committed yet
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		revs[filepath.ToSlash(rel)] = docsite.Revision{Revision: rev, Date: date}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.MarshalIndent(revs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "revisions.json"), append(raw, '\n'), 0o644)
+}
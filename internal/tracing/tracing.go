@@ -0,0 +1,156 @@
+// Package tracing follows messages through the node with OpenTelemetry:
+// from the queue, through scheduling and every transmit attempt, to the
+// peer's ack, and on receipt at the far end. Messages carry their trace in a
+// compact form, so nodes relaying them add to the same trace.
+package tracing
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"codeberg.org/splitringresonator/multiband/internal/version"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Name is the instrumentation scope of the node's spans
+const Name = "codeberg.org/splitringresonator/multiband"
+
+// Exporters are where spans can be sent
+var Exporters = []string{"otlp", "stdout"}
+
+// DefaultEndpoint is a collector on the same host, over OTLP/HTTP
+const DefaultEndpoint = "http://localhost:4318"
+
+var ErrCompact = errors.New("not a compact trace")
+
+type Config struct {
+	// Exporter is otlp or stdout, tracing nothing if empty
+	Exporter string
+	// Endpoint is the URL of the OTLP/HTTP collector, DefaultEndpoint if
+	// empty
+	Endpoint string
+	// File is where the stdout exporter appends spans, one JSON object
+	// each, stderr if empty. Stdout is left to the console.
+	File string
+}
+
+// Tracing is the tracer provider spans are exported through
+type Tracing struct {
+	provider trace.TracerProvider
+	shutdown func(context.Context) error
+}
+
+// Off traces nothing
+func Off() *Tracing {
+	return &Tracing{provider: noop.NewTracerProvider(), shutdown: func(context.Context) error { return nil }}
+}
+
+// New exports spans as c says. Close flushes those not sent yet.
+func New(c Config) (*Tracing, error) {
+	var (
+		exporter sdktrace.SpanExporter
+		out      io.WriteCloser = nopCloser{os.Stderr}
+		err      error
+	)
+	switch c.Exporter {
+	case "":
+		return Off(), nil
+	case "otlp":
+		endpoint := c.Endpoint
+		if endpoint == "" {
+			endpoint = DefaultEndpoint
+		}
+		exporter, err = otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint))
+	case "stdout":
+		if c.File != "" {
+			if out, err = os.OpenFile(c.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640); err != nil {
+				return nil, err
+			}
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(out))
+	default:
+		return nil, fmt.Errorf("unknown exporter %q", c.Exporter)
+	}
+	if err != nil {
+		out.Close() //nolint:errcheck
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "multiband"),
+			attribute.String("service.version", version.Short),
+		)),
+	)
+	shutdown := func(ctx context.Context) error {
+		return errors.Join(provider.Shutdown(ctx), out.Close())
+	}
+	return &Tracing{provider: provider, shutdown: shutdown}, nil
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// Tracer is the tracer of the subsystem name, eg. queue
+func (t *Tracing) Tracer(name string) trace.Tracer {
+	return t.provider.Tracer(Name + "/" + name)
+}
+
+// Close exports the spans left, giving up when ctx is done
+func (t *Tracing) Close(ctx context.Context) error {
+	return t.shutdown(ctx)
+}
+
+// compactLen is the size of a trace and span ID together
+const compactLen = 16 + 8
+
+// Compact is sc as messages carry it: the trace and span IDs, 32 characters
+// of unpadded URL safe base64, or empty if sc is not valid
+func Compact(sc trace.SpanContext) string {
+	if !sc.IsValid() {
+		return ""
+	}
+	tid, sid := sc.TraceID(), sc.SpanID()
+	return base64.RawURLEncoding.EncodeToString(append(tid[:], sid[:]...))
+}
+
+// Parse reads a compact trace, as the remote span its message was sent in
+func Parse(s string) (trace.SpanContext, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(raw) != compactLen {
+		return trace.SpanContext{}, fmt.Errorf("%w: %q", ErrCompact, s)
+	}
+	var (
+		tid trace.TraceID
+		sid trace.SpanID
+	)
+	copy(tid[:], raw[:16])
+	copy(sid[:], raw[16:])
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: tid, SpanID: sid, TraceFlags: trace.FlagsSampled, Remote: true})
+	if !sc.IsValid() {
+		return trace.SpanContext{}, fmt.Errorf("%w: %q", ErrCompact, s)
+	}
+	return sc, nil
+}
+
+// Remote is ctx with the span a message carrying compact was sent in as its
+// parent, if compact is a trace
+func Remote(ctx context.Context, compact string) context.Context {
+	sc, err := Parse(compact)
+	if err != nil {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
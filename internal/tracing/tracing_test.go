@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestCompact(t *testing.T) {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:  trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+	})
+	compact := Compact(sc)
+	if len(compact) != 32 {
+		t.Errorf("compact %q is %d characters, want 32", compact, len(compact))
+	}
+
+	got, err := Parse(compact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TraceID() != sc.TraceID() || got.SpanID() != sc.SpanID() {
+		t.Errorf("parsed %s/%s, want %s/%s", got.TraceID(), got.SpanID(), sc.TraceID(), sc.SpanID())
+	}
+	if !got.IsRemote() || !got.IsSampled() {
+		t.Errorf("parsed remote %v, sampled %v", got.IsRemote(), got.IsSampled())
+	}
+
+	if got := Compact(trace.SpanContext{}); got != "" {
+		t.Errorf("invalid span compacted to %q", got)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	valid := Compact(trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}}))
+	for _, s := range []string{
+		"",
+		"not a trace",
+		valid[:31],
+		valid + "AA",
+		// padded or standard base64
+		base64.URLEncoding.EncodeToString(make([]byte, 23)) + "=",
+		strings.Repeat("+", 32),
+		// the IDs of an invalid span
+		strings.Repeat("A", 32),
+		base64.RawURLEncoding.EncodeToString(append(make([]byte, 16), 1, 0, 0, 0, 0, 0, 0, 0)),
+	} {
+		if _, err := Parse(s); !errors.Is(err, ErrCompact) {
+			t.Errorf("Parse(%q) = %v, want ErrCompact", s, err)
+		}
+		// messages carrying them are traced afresh
+		if sc := trace.SpanContextFromContext(Remote(context.Background(), s)); sc.IsValid() {
+			t.Errorf("Remote(%q) has a parent", s)
+		}
+	}
+}
+
+func TestStdoutFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	tr, err := New(Config{Exporter: "stdout", File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := tr.Tracer("queue").Start(context.Background(), "message")
+	compact := Compact(span.SpanContext())
+	span.End()
+	if err := tr.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Name        string
+		SpanContext struct{ TraceID, SpanID string }
+	}
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("%v:\n%s", err, raw)
+	}
+	sc, _ := Parse(compact)
+	if got.Name != "message" || got.SpanContext.TraceID != sc.TraceID().String() || got.SpanContext.SpanID != sc.SpanID().String() {
+		t.Errorf("exported %+v, want the message span %s", got, compact)
+	}
+}
+
+func TestUnknownExporter(t *testing.T) {
+	if _, err := New(Config{Exporter: "zipkin"}); err == nil {
+		t.Error("unknown exporter accepted")
+	}
+}